@@ -0,0 +1,178 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+//go:embed licenses
+var licenseFiles embed.FS
+
+const modulePath = "github.com/iwehrman/serve"
+
+type aboutComponent struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	License  string `json:"license,omitempty"`
+	Purl     string `json:"purl,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+	file     string
+}
+
+type aboutResponse struct {
+	Name       string            `json:"name"`
+	Version    string            `json:"version"`
+	Revision   string            `json:"revision,omitempty"`
+	GoVersion  string            `json:"goVersion"`
+	Components []*aboutComponent `json:"components"`
+}
+
+var externalTools = []*aboutComponent{
+	{Name: "imagemagick", License: "ImageMagick", Optional: true},
+	{Name: "libvips", License: "LGPL-2.1-or-later", Optional: true},
+	{Name: "libjpeg-turbo", License: "IJG AND BSD-3-Clause AND Zlib", Optional: true},
+	{Name: "brotli", License: "MIT", Optional: true},
+	{Name: "zstd", License: "BSD-3-Clause OR GPL-2.0-only", Optional: true},
+	{Name: "exiftool", License: "Artistic-1.0-Perl OR GPL-1.0-or-later", Optional: true},
+	{Name: "git", License: "GPL-2.0-only", Optional: true},
+	{Name: "tesseract", License: "Apache-2.0", Optional: true},
+	{Name: "poppler", License: "GPL-2.0-or-later", Optional: true},
+}
+
+func getAbout() *aboutResponse {
+	goVersion := strings.TrimPrefix(runtime.Version(), "go")
+	about := &aboutResponse{
+		Name:      "serve",
+		Version:   "(devel)",
+		GoVersion: goVersion,
+		Components: []*aboutComponent{{
+			Name:    "go",
+			Version: goVersion,
+			License: "BSD-3-Clause",
+			Purl:    "pkg:golang/std@" + goVersion,
+			file:    "licenses/go.txt"}}}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Version != "" {
+			about.Version = info.Main.Version
+		}
+
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				about.Revision = setting.Value
+			}
+		}
+
+		for _, dep := range info.Deps {
+			about.Components = append(about.Components, &aboutComponent{
+				Name:    dep.Path,
+				Version: dep.Version,
+				License: "NOASSERTION",
+				Purl:    "pkg:golang/" + dep.Path + "@" + dep.Version})
+		}
+	}
+
+	about.Components = append(about.Components, externalTools...)
+	return about
+}
+
+func handleAbout(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, getAbout())
+}
+
+func handleLicenses(w http.ResponseWriter, r *http.Request) {
+	var builder strings.Builder
+	for _, component := range getAbout().Components {
+		if component.file == "" {
+			continue
+		}
+
+		text, err := licenseFiles.ReadFile(component.file)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+
+		builder.WriteString(component.Name + " " + component.Version + " (" + component.License + ")\n\n")
+		builder.Write(text)
+		builder.WriteString("\n")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(builder.String()))
+}
+
+type cycloneDXLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cycloneDXComponent struct {
+	Type     string             `json:"type"`
+	Name     string             `json:"name"`
+	Version  string             `json:"version,omitempty"`
+	Purl     string             `json:"purl,omitempty"`
+	Scope    string             `json:"scope,omitempty"`
+	Licenses []cycloneDXLicense `json:"licenses,omitempty"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXBOM struct {
+	BOMFormat   string               `json:"bomFormat"`
+	SpecVersion string               `json:"specVersion"`
+	Version     int                  `json:"version"`
+	Metadata    cycloneDXMetadata    `json:"metadata"`
+	Components  []cycloneDXComponent `json:"components"`
+}
+
+func handleSBOM(w http.ResponseWriter, r *http.Request) {
+	about := getAbout()
+
+	bom := &cycloneDXBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: now().UTC().Format(time.RFC3339),
+			Component: cycloneDXComponent{
+				Type:    "application",
+				Name:    about.Name,
+				Version: about.Version,
+				Purl:    "pkg:golang/" + modulePath + "@" + about.Version}}}
+
+	for _, component := range about.Components {
+		entry := cycloneDXComponent{
+			Type:    "library",
+			Name:    component.Name,
+			Version: component.Version,
+			Purl:    component.Purl}
+
+		if component.Optional {
+			entry.Type = "application"
+			entry.Scope = "optional"
+		}
+
+		if component.License != "" && component.License != "NOASSERTION" {
+			entry.Licenses = []cycloneDXLicense{{Expression: component.License}}
+		}
+
+		bom.Components = append(bom.Components, entry)
+	}
+
+	encoded, err := json.Marshal(bom)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.cyclonedx+json")
+	w.Write(encoded)
+}
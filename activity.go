@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const activityFile = "/.activity.json"
+const maxActivity = 1000
+const defaultActivityLimit = 100
+
+const activityUpload = "upload"
+const activityDelete = "delete"
+const activityShare = "share"
+const activityComment = "comment"
+
+type activity struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	User string    `json:"user,omitempty"`
+	Path string    `json:"path"`
+}
+
+var activityMutex sync.Mutex
+var activities []*activity
+
+func getActivityPath() string {
+	return cacheDir + activityFile
+}
+
+func initActivity() {
+	data, err := ioutil.ReadFile(getActivityPath())
+	if err == nil {
+		err = json.Unmarshal(data, &activities)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal("Unable to load activity file:", err)
+	}
+}
+
+func saveActivity() error {
+	data, err := json.Marshal(activities)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := getActivityPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, getActivityPath())
+}
+
+func recordActivity(kind, user, globalPath string) {
+	activityMutex.Lock()
+	defer activityMutex.Unlock()
+
+	activities = append(activities, &activity{
+		Time: now(),
+		Type: kind,
+		User: user,
+		Path: globalPath})
+	if len(activities) > maxActivity {
+		activities = append([]*activity{}, activities[len(activities)-maxActivity:]...)
+	}
+
+	if err := saveActivity(); err != nil {
+		log.Print("Unable to save activity file: ", err)
+	}
+}
+
+func canonicalizeUser(query url.Values) bool {
+	if _, present := query["user"]; !present {
+		return true
+	}
+
+	if query.Get("user") == "" {
+		query.Del("user")
+		return false
+	}
+
+	if len(query["user"]) > 1 {
+		query.Set("user", query.Get("user"))
+		return false
+	}
+
+	return true
+}
+
+func canonicalizeActivity(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeUser(query) && canon
+	canon = canonicalizeCount(query, "limit", maxActivity) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleActivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !canonicalizeActivity(r.URL) && allowsRedirects(r) {
+		redirect(w, r)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	user := r.URL.Query().Get("user")
+	limit := getCount(r, "limit", defaultActivityLimit)
+
+	activityMutex.Lock()
+	feed := make([]*activity, 0)
+	for i := len(activities) - 1; i >= 0 && len(feed) < limit; i-- {
+		a := activities[i]
+		if user != "" && a.User != user {
+			continue
+		}
+
+		virtualPath, ok := unmapPath(r, a.Path)
+		if !ok || !isWithin(virtualPath, path) {
+			continue
+		}
+
+		entry := *a
+		entry.Path = virtualPath
+		feed = append(feed, &entry)
+	}
+	activityMutex.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, feed)
+}
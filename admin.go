@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/iwehrman/serve/users"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type adminUserRequest struct {
+	Name     string `json:"name"`
+	Home     string `json:"home"`
+	Password string `json:"password"`
+	Admin    bool   `json:"admin"`
+}
+
+type adminUserResponse struct {
+	Name     string `json:"name"`
+	Home     string `json:"home"`
+	Admin    bool   `json:"admin"`
+	HasToken bool   `json:"hasToken"`
+}
+
+type adminTokenResponse struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+func newAdminUserResponse(user *users.User) *adminUserResponse {
+	return &adminUserResponse{
+		Name:     user.Name,
+		Home:     user.Home,
+		Admin:    user.Admin,
+		HasToken: user.Token != ""}
+}
+
+func isAdminPath(path string) bool {
+	return strings.HasPrefix(path, "/admin/")
+}
+
+// isSameOrigin rejects cross-site requests, which a browser holding cached
+// credentials would otherwise send to the admin API on the user's behalf.
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == r.Host
+}
+
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if userStore == nil {
+		http.Error(w, "Admin API requires a users file", http.StatusForbidden)
+		return false
+	}
+
+	if user := getUserFromRequest(r); user == nil || !user.Admin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+
+	if !isSameOrigin(r) {
+		http.Error(w, "Cross-origin admin requests are not allowed", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// requireJSON refuses bodies that a cross-site form could send without a
+// CORS preflight.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	return true
+}
+
+func saveUsers(w http.ResponseWriter) bool {
+	if err := userStore.Save(); err != nil {
+		log.Print("Unable to save users file: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		list := userStore.List()
+		response := make([]*adminUserResponse, len(list))
+		for index := range list {
+			response[index] = newAdminUserResponse(&list[index])
+		}
+
+		writeJSON(w, http.StatusOK, response)
+	case "POST":
+		if !requireJSON(w, r) {
+			return
+		}
+
+		var request adminUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if request.Password == "" {
+			http.Error(w, "Password must not be empty", http.StatusBadRequest)
+			return
+		}
+
+		user, err := userStore.Add(request.Name, request.Home, request.Password)
+		if err == users.ErrExists {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if request.Admin {
+			userStore.SetAdmin(user.Name, true)
+			user.Admin = true
+		}
+
+		if err := os.MkdirAll(root+user.Home, 0755); err != nil {
+			userStore.Remove(user.Name)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !saveUsers(w) {
+			return
+		}
+
+		log.Printf("Added user: %s", user.Name)
+		writeJSON(w, http.StatusCreated, newAdminUserResponse(user))
+	case "DELETE":
+		name := r.URL.Query().Get("name")
+		if current := getUserFromRequest(r); current.Name == name {
+			http.Error(w, "Cannot remove the current user", http.StatusBadRequest)
+			return
+		}
+
+		if err := userStore.Remove(name); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if !saveUsers(w) {
+			return
+		}
+
+		log.Printf("Removed user: %s", name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleAdminTokens(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	token, err := userStore.RotateToken(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if !saveUsers(w) {
+		return
+	}
+
+	log.Printf("Rotated token for user: %s", name)
+	writeJSON(w, http.StatusOK, &adminTokenResponse{Name: name, Token: token})
+}
+
+func handleAdminMounts(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, listMounts())
+	case "POST":
+		if !requireJSON(w, r) {
+			return
+		}
+
+		var request Mount
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mount, err := addMount(request.Path, request.Dir)
+		if err == errMountExists {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := saveConfig(); err != nil {
+			log.Print("Unable to save config: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Attached mount: %s -> %s", mount.Path, mount.Dir)
+		writeJSON(w, http.StatusCreated, mount)
+	case "DELETE":
+		path := r.URL.Query().Get("path")
+		if err := removeMount(path); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err := saveConfig(); err != nil {
+			log.Print("Unable to save config: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Detached mount: %s", path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+type appendLock struct {
+	sync.Mutex
+	refs int
+}
+
+var appendMutex sync.Mutex
+var appendLocks = make(map[string]*appendLock)
+
+func lockAppend(fullPath string) func() {
+	appendMutex.Lock()
+	lock, present := appendLocks[fullPath]
+	if !present {
+		lock = &appendLock{}
+		appendLocks[fullPath] = lock
+	}
+	lock.refs++
+	appendMutex.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		appendMutex.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(appendLocks, fullPath)
+		}
+		appendMutex.Unlock()
+	}
+}
+
+func canonicalizeAppend(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func appendFile(fullPath string, size int64, body io.Reader, expected map[string]string) error {
+	var file *os.File
+	err := runWithTimeout("open", fullPath, func() error {
+		var err error
+		file, err = os.OpenFile(fullPath, os.O_WRONLY|os.O_APPEND, 0)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	checksums := newChecksumWriter()
+	_, err = io.Copy(io.MultiWriter(file, checksums), body)
+	if err == nil {
+		err = verifyChecksums(expected, checksums.sums())
+	}
+	if err != nil {
+		file.Truncate(size)
+	}
+	if err == nil && fsyncEnabled() {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func handleAppend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeAppend(r.URL)
+
+	if !limitUploadBody(w, r) {
+		return
+	}
+
+	expected, err := getExpectedChecksums(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	unlock := lockAppend(fullPath)
+	defer unlock()
+
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !fileInfo.Mode().IsRegular() {
+		http.Error(w, "Not a file: "+path, http.StatusConflict)
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, path)) {
+		return
+	}
+
+	if err := appendFile(fullPath, fileInfo.Size(), r.Body, expected); err != nil {
+		serveWriteError(w, err)
+		return
+	}
+
+	serveWrittenFile(w, r, path, fullPath, true, nil)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+type tarArchive struct {
+	writer   *tar.Writer
+	gzip     *gzip.Writer
+	progress *job
+}
+
+type sizeArchive struct {
+	total int64
+}
+
+func newTarArchive(w io.Writer, compressed bool, progress *job) *tarArchive {
+	archive := &tarArchive{progress: progress}
+	if compressed {
+		archive.gzip = gzip.NewWriter(w)
+		w = archive.gzip
+	}
+	archive.writer = tar.NewWriter(w)
+
+	return archive
+}
+
+func (t *tarArchive) addDir(name string, fileInfo os.FileInfo) error {
+	header, err := tar.FileInfoHeader(fileInfo, "")
+	if err != nil {
+		return err
+	}
+
+	header.Name = name + "/"
+	header.ModTime = modTime(fileInfo)
+	return t.writer.WriteHeader(header)
+}
+
+func (t *tarArchive) addFile(fullPath, name string, fileInfo os.FileInfo) error {
+	header, err := tar.FileInfoHeader(fileInfo, "")
+	if err != nil {
+		return err
+	}
+
+	header.Name = name
+	header.ModTime = modTime(fileInfo)
+
+	file, err := fsOpen(fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := t.writer.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(t.writer, t.progress.reader(file), header.Size)
+	return err
+}
+
+func (t *tarArchive) Close() error {
+	err := t.writer.Close()
+	if t.gzip != nil {
+		if gzipErr := t.gzip.Close(); err == nil {
+			err = gzipErr
+		}
+	}
+
+	return err
+}
+
+func (s *sizeArchive) addDir(name string, fileInfo os.FileInfo) error {
+	return nil
+}
+
+func (s *sizeArchive) addFile(fullPath, name string, fileInfo os.FileInfo) error {
+	s.total += fileInfo.Size()
+	return nil
+}
+
+func (s *sizeArchive) Close() error {
+	return nil
+}
+
+func newArchiveWriter(w io.Writer, suffix string, progress *job) archiveWriter {
+	switch suffix {
+	case ".zip":
+		return &zipArchive{writer: zip.NewWriter(w), progress: progress}
+	case ".tar":
+		return newTarArchive(w, false, progress)
+	default:
+		return newTarArchive(w, true, progress)
+	}
+}
+
+func canonicalizeArchive(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePathList(query, "path") && canon
+	canon = canonicalizePathParam(query, "target") && canon
+	canon = canonicalizeOverwrite(query) && canon
+	canon = canonicalizeSidecars(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func writeArchive(ctx context.Context, r *http.Request, w io.Writer, suffix string, paths, fullPaths []string, progress *job) error {
+	archive := newArchiveWriter(w, suffix, progress)
+
+	var err error
+	for i, path := range paths {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		if err = addPathToArchive(r, archive, fullPaths[i], getArchivePrefix(path)); err != nil {
+			break
+		}
+	}
+
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func handleArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeArchive(r.URL)
+
+	paths := r.URL.Query()["path"]
+	if len(paths) == 0 {
+		http.Error(w, "No paths selected", http.StatusBadRequest)
+		return
+	}
+
+	if hasSidecars(r) {
+		paths = expandSidecars(r, paths)
+	}
+
+	fullPaths := make([]string, len(paths))
+	for i, path := range paths {
+		fullPaths[i] = resolvePath(mapPath(r, path))
+		if _, err := fsStat(fullPaths[i]); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+
+	target := r.URL.Query().Get("target")
+	suffix := getArchiveSuffix(target)
+	if suffix == "" {
+		http.Error(w, "Unsupported archive type: "+target, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	targetPath := resolvePath(mapPath(r, target))
+	if isCachePath(targetPath) {
+		http.Error(w, "Refusing to modify protected path", http.StatusForbidden)
+		return
+	}
+
+	targetInfo, err := fsLstat(targetPath)
+	if err != nil && !os.IsNotExist(err) {
+		serveError(w, err)
+		return
+	}
+
+	overwrite := hasOverwrite(r)
+	if targetInfo != nil && (targetInfo.IsDir() || !overwrite) {
+		http.Error(w, "Target already exists: "+target, http.StatusConflict)
+		return
+	}
+
+	if !checkPreconditions(w, r, targetInfo) {
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, target)) {
+		return
+	}
+
+	j, err := startJob(r, "archive", target, func(ctx context.Context, j *job) (*Stats, error) {
+		sizes := &sizeArchive{}
+		for i, path := range paths {
+			if err := addPathToArchive(r, sizes, fullPaths[i], getArchivePrefix(path)); err != nil {
+				return nil, err
+			}
+		}
+		j.setTotal(sizes.total)
+
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(writeArchive(ctx, r, writer, suffix, paths, fullPaths, j))
+		}()
+
+		_, err := writeFile(targetPath, reader, overwrite, nil)
+		reader.CloseWithError(err)
+		if err != nil {
+			return nil, err
+		}
+
+		fileInfo, err := fsLstat(targetPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return newStats(r, targetPath, target, fileInfo), nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	serveJobStarted(w, j)
+}
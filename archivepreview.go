@@ -0,0 +1,180 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const previewerArchive = "archive"
+const maxArchivePreviewMembers = 1000
+
+type archiveMember struct {
+	Name  string    `json:"name"`
+	IsDir bool      `json:"isDir"`
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime,omitzero"`
+	Count int       `json:"count,omitempty"`
+}
+
+type archivePreview struct {
+	Name      string           `json:"name"`
+	Path      string           `json:"path"`
+	Members   []*archiveMember `json:"members"`
+	Truncated bool             `json:"truncated,omitempty"`
+}
+
+type archivePreviewPage struct {
+	*archivePreview
+	Locale     *locale
+	Style      template.CSS
+	ParentHref string
+	Rows       []*archivePreviewRow
+}
+
+type archivePreviewRow struct {
+	*archiveMember
+	SizeText  string
+	MtimeText string
+}
+
+func getTopLevelName(name string) (string, bool) {
+	name = strings.TrimLeft(filepath.ToSlash(name), "/")
+	for strings.HasPrefix(name, "./") {
+		name = strings.TrimLeft(name[2:], "/")
+	}
+
+	top, rest, nested := strings.Cut(name, "/")
+	if top == "" || top == "." || top == ".." {
+		return "", false
+	}
+
+	return top, nested && rest != ""
+}
+
+func listArchiveMembers(fullPath string) ([]*archiveMember, bool, error) {
+	walk, err := getArchiveWalker(fullPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	members := make(map[string]*archiveMember)
+	truncated := false
+	err = walk(func(entry *archiveEntry) error {
+		top, nested := getTopLevelName(entry.name)
+		if top == "" {
+			return nil
+		}
+
+		member, present := members[top]
+		if !present {
+			if len(members) >= maxArchivePreviewMembers {
+				truncated = true
+				return nil
+			}
+			member = &archiveMember{Name: top}
+			members[top] = member
+		}
+
+		if nested || entry.isDir {
+			member.IsDir = true
+		}
+		if nested {
+			member.Count++
+		}
+		member.Size += entry.size
+		if entry.mtime.After(member.Mtime) {
+			member.Mtime = entry.mtime
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	list := make([]*archiveMember, 0, len(members))
+	for _, member := range members {
+		list = append(list, member)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].IsDir != list[j].IsDir {
+			return list[i].IsDir
+		}
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+
+	return list, truncated, nil
+}
+
+func prefersHTML(r *http.Request) bool {
+	accepted := parseQualityValues(r.Header.Get("Accept"))
+	return accepted["text/html"] > accepted["application/json"]
+}
+
+func serveArchivePreview(w http.ResponseWriter, r *http.Request) {
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	header := w.Header()
+	addVary(header, "Accept")
+
+	if !isModified(fileInfo, r.Header) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	members, truncated, err := listArchiveMembers(fullPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	preview := &archivePreview{
+		Name:      filepath.Base(path),
+		Path:      path,
+		Members:   members,
+		Truncated: truncated}
+
+	setCacheHeaders(fileInfo, &header)
+
+	if !prefersHTML(r) {
+		writeJSON(w, http.StatusOK, preview)
+		return
+	}
+
+	loc := negotiateLocale(r)
+	page := &archivePreviewPage{
+		archivePreview: preview,
+		Locale:         loc,
+		Style:          loadThemeStyle(getThemeFromRequest(r)),
+		ParentHref:     browseURL(filepath.Dir(path), "")}
+	for _, member := range members {
+		row := &archivePreviewRow{archiveMember: member}
+		if !member.Mtime.IsZero() {
+			row.MtimeText = loc.formatTime(member.Mtime)
+		}
+		row.SizeText = loc.formatSize(member.Size)
+		page.Rows = append(page.Rows, row)
+	}
+
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Language", loc.Tag)
+	addVary(header, "Accept-Language")
+	addVary(header, "Cookie")
+
+	if err := uiTemplates.ExecuteTemplate(w, "archive.html", page); err != nil {
+		log.Print("Unable to render archive preview: ", err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/iwehrman/serve/audit"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const defaultAuditMaxSize = 100 << 20
+const defaultAuditMaxFiles = 5
+
+var auditLogger *audit.Logger
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func initAudit(auditConfig AuditConfig) {
+	maxSize := auditConfig.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultAuditMaxSize
+	}
+
+	maxFiles := auditConfig.MaxFiles
+	if maxFiles == 0 {
+		maxFiles = defaultAuditMaxFiles
+	}
+
+	logger, err := audit.Open(auditConfig.File, maxSize, maxFiles, auditConfig.Webhook)
+	if err != nil {
+		log.Fatal("Unable to open audit log:", err)
+	}
+
+	auditLogger = logger
+}
+
+func recordAudit(r *http.Request, status int) {
+	if auditLogger == nil {
+		return
+	}
+
+	entry := &audit.Entry{
+		Time:   now(),
+		Remote: r.RemoteAddr,
+		Action: strings.TrimPrefix(r.URL.Path, "/"),
+		Method: r.Method,
+		Status: status}
+
+	if user := getUserFromRequest(r); user != nil {
+		entry.User = user.Name
+	}
+
+	if path := getPathFromRequest(r); path != "" {
+		entry.Path = mapPath(r, path)
+	}
+
+	auditLogger.Log(entry)
+}
@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const webhookQueueSize = 1024
+
+type Entry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user,omitempty"`
+	Remote string    `json:"remote"`
+	Action string    `json:"action"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+}
+
+type Logger struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	webhook  string
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+	queue chan []byte
+}
+
+func Open(path string, maxSize int64, maxFiles int, webhook string) (*Logger, error) {
+	logger := &Logger{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		webhook:  webhook}
+
+	if err := logger.open(); err != nil {
+		return nil, err
+	}
+
+	if webhook != "" {
+		logger.queue = make(chan []byte, webhookQueueSize)
+		go logger.ship()
+	}
+
+	return logger, nil
+}
+
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = fileInfo.Size()
+
+	return nil
+}
+
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	for i := l.maxFiles - 1; i > 0; i-- {
+		oldPath := l.path + "." + strconv.Itoa(i)
+		newPath := l.path + "." + strconv.Itoa(i+1)
+		if err := os.Rename(oldPath, newPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if l.maxFiles > 0 {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+func (l *Logger) Log(entry *Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Print("Unable to encode audit entry: ", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mutex.Lock()
+	if l.maxSize > 0 && l.size+int64(len(line)) > l.maxSize && l.size > 0 {
+		if err := l.rotate(); err != nil {
+			log.Print("Unable to rotate audit log: ", err)
+		}
+	}
+
+	if count, err := l.file.Write(line); err != nil {
+		log.Printf("Only wrote %v bytes of audit entry before error: %v\n", count, err)
+	} else {
+		l.size = l.size + int64(count)
+	}
+	l.mutex.Unlock()
+
+	if l.queue != nil {
+		select {
+		case l.queue <- line:
+		default:
+			log.Print("Audit webhook queue is full; dropping entry")
+		}
+	}
+}
+
+func (l *Logger) ship() {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	for line := range l.queue {
+		response, err := client.Post(l.webhook, "application/json", bytes.NewReader(line))
+		if err != nil {
+			log.Print("Unable to ship audit entry: ", err)
+			continue
+		}
+
+		response.Body.Close()
+		if response.StatusCode >= 300 {
+			log.Printf("Audit webhook returned status: %d", response.StatusCode)
+		}
+	}
+}
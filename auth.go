@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"github.com/iwehrman/serve/users"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	dropKey
+	profileKey
+	shareKey
+)
+
+var userStore *users.Store
+
+func initUsers(usersFile string) {
+	store, err := users.Open(usersFile)
+	if err != nil {
+		log.Fatal("Unable to open users file:", err)
+	}
+
+	for _, user := range store.List() {
+		if err := os.MkdirAll(root+user.Home, 0755); err != nil {
+			log.Fatal("Unable to create home directory:", err)
+		}
+	}
+
+	userStore = store
+}
+
+func getUserFromRequest(r *http.Request) *users.User {
+	user, _ := r.Context().Value(userKey).(*users.User)
+	return user
+}
+
+func getUserName(r *http.Request) string {
+	if user := getUserFromRequest(r); user != nil {
+		return user.Name
+	}
+
+	return ""
+}
+
+func mapPath(r *http.Request, path string) string {
+	user := getUserFromRequest(r)
+	if user == nil {
+		return path
+	}
+
+	return filepath.Join(user.Home, filepath.Join("/", path))
+}
+
+func unmapPath(r *http.Request, globalPath string) (string, bool) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		return globalPath, true
+	}
+
+	if !isWithin(globalPath, user.Home) {
+		return "", false
+	}
+
+	return filepath.Join("/", strings.TrimPrefix(globalPath, user.Home)), true
+}
+
+func authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if strings.HasPrefix(r.URL.Path, dropPrefix) {
+		return authenticateDrop(w, r)
+	}
+
+	if strings.HasPrefix(r.URL.Path, sharePrefix) {
+		return authenticateShare(w, r)
+	}
+
+	if userStore == nil {
+		return r, true
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if user, ok := userStore.AuthenticateToken(token); ok {
+			ctx := context.WithValue(r.Context(), userKey, user)
+			return r.WithContext(ctx), true
+		}
+		log.Print("Authentication failed for bearer token")
+	} else if name, password, ok := r.BasicAuth(); ok {
+		if user, ok := userStore.Authenticate(name, password); ok {
+			ctx := context.WithValue(r.Context(), userKey, user)
+			return r.WithContext(ctx), true
+		}
+		log.Printf("Authentication failed for user: %s", name)
+	}
+
+	header := w.Header()
+	header.Set("WWW-Authenticate", "Basic realm=\"serve\"")
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+
+	return r, false
+}
+
+func runAddUser(args []string) {
+	flags := flag.NewFlagSet("adduser", flag.ExitOnError)
+	usersFile := flags.String("users", "users.json", "path to the users file")
+	home := flags.String("home", "", "home directory relative to the root; defaults to the user name")
+	admin := flags.Bool("admin", false, "grant access to the admin API")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: serve adduser [-users file] [-home dir] [-admin] name")
+	}
+
+	store, err := users.Open(*usersFile)
+	if err != nil {
+		log.Fatal("Unable to open users file:", err)
+	}
+
+	log.Print("Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		log.Fatal("Unable to read password:", err)
+	}
+
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		log.Fatal("Password must not be empty")
+	}
+
+	name := flags.Arg(0)
+	if _, err := store.Add(name, *home, password); err != nil {
+		log.Fatal("Unable to add user:", err)
+	}
+
+	if err := store.SetAdmin(name, *admin); err != nil {
+		log.Fatal("Unable to add user:", err)
+	}
+
+	if err := store.Save(); err != nil {
+		log.Fatal("Unable to save users file:", err)
+	}
+
+	log.Printf("Added user: %s", name)
+}
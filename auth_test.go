@@ -0,0 +1,110 @@
+package main
+
+import (
+	"github.com/iwehrman/serve/users"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newJailedTestServer(t *testing.T) string {
+	t.Helper()
+
+	server := newTestServer(t)
+
+	store, err := users.Open(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("alice", "/alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	userStore = store
+	t.Cleanup(func() { userStore = nil })
+
+	for _, dir := range []string{"alice", "bob"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "bob", "secret.txt"), []byte("bob's secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return server.URL
+}
+
+func TestJailedUserCannotEscapeHome(t *testing.T) {
+	serverURL := newJailedTestServer(t)
+	client := noRedirectClient()
+
+	for _, query := range []string{
+		"path=%2F%252e%252e%2Fbob%2Fsecret.txt",
+		"path=%2F..%2Fbob%2Fsecret.txt",
+		"path=..%2Fbob%2Fsecret.txt",
+	} {
+		request, err := http.NewRequest("GET", serverURL+"/read?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.SetBasicAuth("alice", "secret")
+
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+
+		if response.StatusCode == http.StatusOK || string(body) == "bob's secret" {
+			t.Errorf("GET /read?%s: %s, want bob's file to be unreachable", query, response.Status)
+		}
+	}
+}
+
+func TestAdminRejectsCrossSiteRequests(t *testing.T) {
+	serverURL := newJailedTestServer(t)
+	if err := userStore.SetAdmin("alice", true); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(contentType, origin string) *http.Response {
+		t.Helper()
+
+		request, err := http.NewRequest("POST", serverURL+"/admin/users", strings.NewReader(`{"name":"mallory","home":"/","password":"x","admin":true}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.SetBasicAuth("alice", "secret")
+		request.Header.Set("Content-Type", contentType)
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response
+	}
+
+	if response := post("text/plain", ""); response.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain POST /admin/users: %s, want 415", response.Status)
+	}
+
+	response := post("application/json", "https://evil.example")
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin POST /admin/users: %s, want 403", response.Status)
+	}
+	if origin := response.Header.Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("Access-Control-Allow-Origin on /admin/users: %q, want none", origin)
+	}
+
+	if _, present := userStore.Get("mallory"); present {
+		t.Error("a cross-site request created an admin user")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const maxBatchOperations = 1000
+
+type batchOperation struct {
+	Op        string `json:"op"`
+	Path      string `json:"path"`
+	Target    string `json:"target,omitempty"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+	Recursive bool   `json:"recursive,omitempty"`
+	Parents   bool   `json:"parents,omitempty"`
+	NoCreate  bool   `json:"noCreate,omitempty"`
+	Time      string `json:"time,omitempty"`
+	IfMatch   string `json:"ifMatch,omitempty"`
+	Mtime     string `json:"mtime,omitempty"`
+}
+
+type batchResult struct {
+	Status int             `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+var batchHandlers = map[string]struct {
+	method  string
+	handler requestHandler
+}{
+	"stat":   {"GET", handleStat},
+	"delete": {"POST", handleDelete},
+	"move":   {"POST", handleMove},
+	"copy":   {"POST", handleCopy},
+	"mkdir":  {"POST", handleMkdir},
+	"touch":  {"POST", handleTouch},
+}
+
+func (b *batchRecorder) Header() http.Header {
+	return b.header
+}
+
+func (b *batchRecorder) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *batchRecorder) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+
+	return b.body.Write(p)
+}
+
+func setBatchFlag(query url.Values, key string, value bool) {
+	if value {
+		query.Set(key, "1")
+	}
+}
+
+func runBatchOperation(r *http.Request, operation *batchOperation) *batchResult {
+	entry, present := batchHandlers[operation.Op]
+	if !present {
+		return &batchResult{Status: http.StatusBadRequest, Error: "Unknown operation: " + operation.Op}
+	}
+
+	query := url.Values{}
+	query.Set("path", filepath.Join("/", operation.Path))
+	if operation.Target != "" {
+		query.Set("target", filepath.Join("/", operation.Target))
+	}
+	setBatchFlag(query, "overwrite", operation.Overwrite)
+	setBatchFlag(query, "recursive", operation.Recursive)
+	setBatchFlag(query, "parents", operation.Parents)
+	setBatchFlag(query, "nocreate", operation.NoCreate)
+	if operation.Time != "" {
+		query.Set("time", operation.Time)
+	}
+	if operation.Mtime != "" {
+		query.Set("mtime", operation.Mtime)
+	}
+
+	request, err := http.NewRequestWithContext(r.Context(), entry.method, "/"+operation.Op+"?"+query.Encode(), nil)
+	if err != nil {
+		return &batchResult{Status: http.StatusBadRequest, Error: err.Error()}
+	}
+
+	if operation.IfMatch != "" {
+		request.Header.Set("If-Match", operation.IfMatch)
+	}
+
+	if token := r.Header.Get(lockTokenHeader); token != "" {
+		request.Header.Set(lockTokenHeader, token)
+	}
+
+	request.RemoteAddr = r.RemoteAddr
+
+	// Each operation gets the mount health check and audit entry that
+	// handlerWrapper gives a standalone request for the same path.
+	if err := checkMountHealth(request); err != nil {
+		recordAudit(request, http.StatusServiceUnavailable)
+		return &batchResult{Status: http.StatusServiceUnavailable, Error: err.Error()}
+	}
+
+	recorder := &batchRecorder{header: make(http.Header)}
+	entry.handler(recorder, request)
+
+	result := &batchResult{Status: recorder.status}
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+	recordAudit(request, result.Status)
+
+	body := bytes.TrimSpace(recorder.body.Bytes())
+	if result.Status >= 300 {
+		result.Error = string(body)
+	} else if strings.HasPrefix(recorder.header.Get("Content-Type"), "application/json") {
+		result.Result = json.RawMessage(body)
+	}
+
+	return result
+}
+
+func handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var operations []*batchOperation
+	if err := json.NewDecoder(r.Body).Decode(&operations); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(operations) > maxBatchOperations {
+		http.Error(w, "Too many operations", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]*batchResult, len(operations))
+	for i, operation := range operations {
+		results[i] = runBatchOperation(r, operation)
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+const benchDirEntries = 10000
+const benchLargeFileSize = 16 << 20
+const benchRangeSize = 64 << 10
+const benchPreviewImages = 32
+
+func benchGet(b *testing.B, client *http.Client, target string, header http.Header) {
+	request, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	request.Header = header
+
+	response, err := client.Do(request)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if _, err := io.Copy(ioutil.Discard, response.Body); err != nil {
+		b.Fatal(err)
+	}
+
+	if response.StatusCode >= 300 {
+		b.Fatalf("GET %s: %s", target, response.Status)
+	}
+}
+
+func makeLargeDirectory(b *testing.B, dir string, count int) {
+	b.Helper()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		b.Fatal(err)
+	}
+
+	for i := 0; i < count; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("IMG_%05d.jpg", i))
+		if err := ioutil.WriteFile(name, []byte{byte(i)}, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func makeLargeFile(b *testing.B, path string, size int) {
+	b.Helper()
+
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func makeImage(b *testing.B, path string, dimension int) {
+	b.Helper()
+
+	data, err := makeFixtureJPEG(dimension, dimension, rand.New(rand.NewSource(1)), "Canon", "Canon EOS R5", fixtureEpoch, fixtureLocations[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkStat(b *testing.B) {
+	server := newTestServer(b)
+	makeLargeFile(b, filepath.Join(root, "file.bin"), 1024)
+	target := testURL(server, "/stat", "/file.bin")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchGet(b, server.Client(), target, nil)
+	}
+}
+
+func BenchmarkReaddirLarge(b *testing.B) {
+	server := newTestServer(b)
+	makeLargeDirectory(b, filepath.Join(root, "large"), benchDirEntries)
+	target := testURL(server, "/readdir", "/large")
+
+	for _, encoding := range []string{"identity", "gzip"} {
+		b.Run(encoding, func(b *testing.B) {
+			header := http.Header{"Accept-Encoding": {encoding}}
+			for i := 0; i < b.N; i++ {
+				benchGet(b, server.Client(), target, header)
+			}
+		})
+	}
+}
+
+func BenchmarkReaddirLargeParallel(b *testing.B) {
+	server := newTestServer(b)
+	makeLargeDirectory(b, filepath.Join(root, "large"), benchDirEntries)
+	target := testURL(server, "/readdir", "/large")
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			benchGet(b, server.Client(), target, nil)
+		}
+	})
+}
+
+func BenchmarkReadFull(b *testing.B) {
+	server := newTestServer(b)
+	makeLargeFile(b, filepath.Join(root, "large.bin"), benchLargeFileSize)
+	target := testURL(server, "/read", "/large.bin")
+
+	b.SetBytes(benchLargeFileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchGet(b, server.Client(), target, nil)
+	}
+}
+
+func BenchmarkReadRange(b *testing.B) {
+	server := newTestServer(b)
+	makeLargeFile(b, filepath.Join(root, "video.bin"), benchLargeFileSize)
+	target := testURL(server, "/read", "/video.bin")
+
+	patterns := map[string]func(i int) int{
+		"sequential": func(i int) int {
+			return (i * benchRangeSize) % (benchLargeFileSize - benchRangeSize)
+		},
+		"random": func(i int) int {
+			return rand.Intn(benchLargeFileSize - benchRangeSize)
+		},
+	}
+
+	for name, offset := range patterns {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(benchRangeSize)
+			for i := 0; i < b.N; i++ {
+				start := offset(i)
+				header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", start, start+benchRangeSize-1)}}
+				benchGet(b, server.Client(), target, header)
+			}
+		})
+	}
+}
+
+func BenchmarkPreviewStorm(b *testing.B) {
+	if _, err := exec.LookPath("convert"); err != nil {
+		b.Skip("convert is not installed")
+	}
+
+	server := newTestServer(b)
+	targets := make([]string, benchPreviewImages)
+	for i := range targets {
+		name := fmt.Sprintf("/photo%02d.jpg", i)
+		makeImage(b, root+name, 1024)
+		targets[i] = testURL(server, "/read", name) + "&preview=1"
+	}
+
+	var counter uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddUint64(&counter, 1)
+			benchGet(b, server.Client(), targets[i%benchPreviewImages], nil)
+		}
+	})
+}
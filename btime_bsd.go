@@ -0,0 +1,23 @@
+//go:build darwin || freebsd || netbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func fileBirthTime(fullPath string, fileInfo os.FileInfo) (time.Time, bool) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	sec, nsec := stat.Birthtimespec.Unix()
+	if sec <= 0 && nsec == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(sec, nsec), true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	statxBtime  = 0x800
+	atFdcwd     = -0x64
+	statxLength = 256
+)
+
+type statxTimestamp struct {
+	Sec      int64
+	Nsec     uint32
+	Reserved int32
+}
+
+type statxResult struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	Uid            uint32
+	Gid            uint32
+	Mode           uint16
+	_              uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          statxTimestamp
+	Btime          statxTimestamp
+	_              [statxLength - 96]byte
+}
+
+// fileBirthTime asks statx for the creation time, which older kernels and
+// many filesystems do not report.
+func fileBirthTime(fullPath string, fileInfo os.FileInfo) (time.Time, bool) {
+	if sysStatx == 0 {
+		return time.Time{}, false
+	}
+
+	pathPtr, err := syscall.BytePtrFromString(fullPath)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	dirfd := atFdcwd
+	var result statxResult
+	_, _, errno := syscall.Syscall6(sysStatx, uintptr(dirfd), uintptr(unsafe.Pointer(pathPtr)),
+		0, statxBtime, uintptr(unsafe.Pointer(&result)), 0)
+	if errno != 0 || result.Mask&statxBtime == 0 || (result.Btime.Sec == 0 && result.Btime.Nsec == 0) {
+		return time.Time{}, false
+	}
+
+	return time.Unix(result.Btime.Sec, int64(result.Btime.Nsec)), true
+}
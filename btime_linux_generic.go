@@ -0,0 +1,5 @@
+//go:build linux && (arm64 || riscv64 || loong64)
+
+package main
+
+const sysStatx = 291
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+func fileBirthTime(fullPath string, fileInfo os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
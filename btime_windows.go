@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func fileBirthTime(fullPath string, fileInfo os.FileInfo) (time.Time, bool) {
+	data, ok := fileInfo.Sys().(*syscall.Win32FileAttributeData)
+	if !ok || data.CreationTime.Nanoseconds() == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, data.CreationTime.Nanoseconds()), true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const burstMaxGap = time.Second
+const burstMinShots = 3
+
+var burstNamePattern = regexp.MustCompile(`(?i)^(.+?)[_-]?BURST[0-9]+`)
+
+type burstShot struct {
+	stats *Stats
+	taken time.Time
+	model string
+}
+
+func hasBursts(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["bursts"]
+	return present
+}
+
+func canonicalizeBursts(query url.Values) bool {
+	return canonicalizeBoolean(query, "bursts")
+}
+
+func isBurstCandidate(stats *Stats) bool {
+	return !stats.IsDir && !stats.Deleted && isThumbnailable(strings.ToLower(filepath.Ext(stats.Name)))
+}
+
+func chooseBurstCover(members []*Stats) int {
+	for i, member := range members {
+		if strings.Contains(strings.ToUpper(member.Name), "COVER") {
+			return i
+		}
+	}
+
+	return 0
+}
+
+func groupBursts(r *http.Request, stats []*Stats) []*Stats {
+	var groups [][]*Stats
+
+	byName := make(map[string][]*Stats)
+	var shots []*burstShot
+	for _, stat := range stats {
+		if !isBurstCandidate(stat) {
+			continue
+		}
+
+		if match := burstNamePattern.FindStringSubmatch(stat.Name); match != nil {
+			key := strings.ToLower(match[1])
+			byName[key] = append(byName[key], stat)
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(stat.Name))
+		if ext != ".jpg" && ext != ".jpeg" {
+			continue
+		}
+
+		fullPath := resolvePath(mapPath(r, stat.Path))
+		fileInfo, err := fsStat(fullPath)
+		if err != nil {
+			continue
+		}
+
+		exif, err := getExif(fullPath, fileInfo)
+		if err != nil || exif.DateTime.IsZero() {
+			continue
+		}
+
+		shots = append(shots, &burstShot{stats: stat, taken: exif.DateTime, model: exif.Make + " " + exif.Model})
+	}
+
+	for _, members := range byName {
+		if len(members) > 1 {
+			groups = append(groups, members)
+		}
+	}
+
+	sort.Slice(shots, func(i, j int) bool {
+		if !shots[i].taken.Equal(shots[j].taken) {
+			return shots[i].taken.Before(shots[j].taken)
+		}
+		return shots[i].stats.Name < shots[j].stats.Name
+	})
+
+	var run []*Stats
+	for i, shot := range shots {
+		if i > 0 && (shot.taken.Sub(shots[i-1].taken) > burstMaxGap || shot.model != shots[i-1].model) {
+			if len(run) >= burstMinShots {
+				groups = append(groups, run)
+			}
+			run = nil
+		}
+		run = append(run, shot.stats)
+	}
+	if len(run) >= burstMinShots {
+		groups = append(groups, run)
+	}
+
+	absorbed := make(map[*Stats]bool)
+	for _, members := range groups {
+		sort.Slice(members, func(i, j int) bool {
+			return members[i].Name < members[j].Name
+		})
+
+		cover := chooseBurstCover(members)
+		for i, member := range members {
+			if i != cover {
+				members[cover].Burst = append(members[cover].Burst, member)
+				absorbed[member] = true
+			}
+		}
+	}
+
+	grouped := make([]*Stats, 0, len(stats)-len(absorbed))
+	for _, stat := range stats {
+		if !absorbed[stat] {
+			grouped = append(grouped, stat)
+		}
+	}
+
+	return grouped
+}
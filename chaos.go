@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+)
+
+const (
+	cacheThumbs     = "thumbs"
+	cacheExif       = "exif"
+	cacheDimensions = "dimensions"
+)
+
+var cacheLayers = []string{cacheThumbs, cacheExif, cacheDimensions}
+
+type ChaosLayer struct {
+	Bypass     bool    `json:"bypass,omitempty"`
+	Invalidate float64 `json:"invalidate,omitempty"`
+}
+
+func validateChaos(chaos map[string]ChaosLayer) error {
+	for name, layer := range chaos {
+		known := false
+		for _, cacheLayer := range cacheLayers {
+			known = known || name == cacheLayer
+		}
+		if !known {
+			return fmt.Errorf("unknown cache layer: %s", name)
+		}
+
+		if layer.Invalidate < 0 || layer.Invalidate > 1 {
+			return fmt.Errorf("%s: invalidate must be between 0 and 1", name)
+		}
+	}
+
+	return nil
+}
+
+func chaosMiss(layer, key string) bool {
+	configMutex.RLock()
+	chaos, present := config.Chaos[layer]
+	configMutex.RUnlock()
+
+	if !present {
+		return false
+	}
+
+	if chaos.Bypass || rand.Float64() < chaos.Invalidate {
+		log.Printf("Chaos: treating %s cache entry as a miss: %s", layer, key)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const checksumSHA256 = "sha256"
+const checksumMD5 = "md5"
+
+var digestAlgorithms = map[string]string{
+	"sha-256": checksumSHA256,
+	"md5":     checksumMD5,
+}
+
+type checksumMismatchError struct {
+	algorithm string
+	expected  string
+	computed  string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return fmt.Sprintf("Checksum mismatch: %s expected %s, computed %s", e.algorithm, e.expected, e.computed)
+}
+
+type checksumWriter struct {
+	io.Writer
+	hashes map[string]hash.Hash
+}
+
+func newChecksumWriter() *checksumWriter {
+	hashes := map[string]hash.Hash{
+		checksumSHA256: sha256.New(),
+		checksumMD5:    md5.New(),
+	}
+
+	return &checksumWriter{
+		Writer: io.MultiWriter(hashes[checksumSHA256], hashes[checksumMD5]),
+		hashes: hashes}
+}
+
+func (c *checksumWriter) sums() map[string]string {
+	sums := make(map[string]string, len(c.hashes))
+	for algorithm, hash := range c.hashes {
+		sums[algorithm] = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	return sums
+}
+
+func verifyChecksums(expected, computed map[string]string) error {
+	for algorithm, value := range expected {
+		if computed[algorithm] != value {
+			return &checksumMismatchError{algorithm, value, computed[algorithm]}
+		}
+	}
+
+	return nil
+}
+
+func decodeBase64Checksum(value string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(decoded), nil
+}
+
+func getExpectedChecksums(r *http.Request, includeHeaders bool) (map[string]string, error) {
+	expected := make(map[string]string)
+	query := r.URL.Query()
+
+	for _, algorithm := range []string{checksumSHA256, checksumMD5} {
+		if value := query.Get(algorithm); value != "" {
+			if _, err := hex.DecodeString(value); err != nil {
+				return nil, fmt.Errorf("Invalid %s checksum: %v", algorithm, err)
+			}
+			expected[algorithm] = strings.ToLower(value)
+		}
+	}
+
+	if !includeHeaders {
+		return expected, nil
+	}
+
+	for _, header := range r.Header.Values("Digest") {
+		for _, part := range strings.Split(header, ",") {
+			fields := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			algorithm, present := digestAlgorithms[strings.ToLower(fields[0])]
+			if !present || len(fields) != 2 {
+				continue
+			}
+
+			value, err := decodeBase64Checksum(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid Digest header: %v", err)
+			}
+			expected[algorithm] = value
+		}
+	}
+
+	if header := r.Header.Get("Content-MD5"); header != "" {
+		value, err := decodeBase64Checksum(header)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Content-MD5 header: %v", err)
+		}
+		expected[checksumMD5] = value
+	}
+
+	return expected, nil
+}
+
+func fileChecksums(fullPath string) (map[string]string, error) {
+	file, err := fsOpen(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	writer := newChecksumWriter()
+	if _, err := io.Copy(writer, file); err != nil {
+		return nil, err
+	}
+
+	return writer.sums(), nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+)
+
+const maxChildCount = 10000
+
+func hasChildCount(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["childCount"]
+	return present
+}
+
+func canonicalizeChildCount(query url.Values) bool {
+	return canonicalizeBoolean(query, "childCount")
+}
+
+// countChildren counts the visible entries of a directory, stopping at
+// maxChildCount so that huge directories stay cheap.
+func countChildren(fullPath string, showHidden bool) (int, error) {
+	names, err := fsReadDirNames(fullPath, maxChildCount)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, name := range names {
+		if isStagingName(name) || (!showHidden && isHiddenName(fullPath, name)) {
+			continue
+		}
+		count++
+	}
+
+	return count, nil
+}
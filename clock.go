@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+type ClockConfig struct {
+	Now   *time.Time `json:"now,omitempty"`
+	Mtime *time.Time `json:"mtime,omitempty"`
+}
+
+var now = time.Now
+
+func initClock(clock ClockConfig) {
+	if clock.Now != nil {
+		fixed := *clock.Now
+		now = func() time.Time {
+			return fixed
+		}
+	}
+}
+
+func modTime(fileInfo os.FileInfo) time.Time {
+	configMutex.RLock()
+	frozen := config.Clock.Mtime
+	configMutex.RUnlock()
+
+	if frozen != nil {
+		return *frozen
+	}
+
+	return fileInfo.ModTime()
+}
+
+func birthTime(fullPath string, fileInfo os.FileInfo) (time.Time, bool) {
+	configMutex.RLock()
+	frozen := config.Clock.Mtime
+	configMutex.RUnlock()
+
+	if frozen != nil {
+		return *frozen, true
+	}
+
+	return fileBirthTime(fullPath, fileInfo)
+}
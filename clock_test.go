@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var frozenTime = time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
+func freezeMtimes(t *testing.T) {
+	t.Helper()
+
+	configMutex.Lock()
+	config.Clock.Mtime = &frozenTime
+	configMutex.Unlock()
+
+	t.Cleanup(func() {
+		configMutex.Lock()
+		config.Clock.Mtime = nil
+		configMutex.Unlock()
+	})
+}
+
+func getBody(t *testing.T, target string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	request, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response, string(body)
+}
+
+func TestFixedClock(t *testing.T) {
+	t.Cleanup(func() {
+		now = time.Now
+	})
+
+	initClock(ClockConfig{Now: &frozenTime})
+	if got := now(); !got.Equal(frozenTime) {
+		t.Fatalf("now() = %v, want %v", got, frozenTime)
+	}
+}
+
+func TestFrozenMtimeListing(t *testing.T) {
+	server := newTestServer(t)
+	freezeMtimes(t)
+
+	dir := filepath.Join(root, "golden")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "golden.txt"), []byte("golden\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	response, body := getBody(t, testURL(server, "/readdir", "/golden"), nil)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("GET /readdir: %s", response.Status)
+	}
+
+	golden := `[{"name":"golden.txt","path":"/golden/golden.txt","size":7,"mtime":"2001-02-03T04:05:06Z","btime":"2001-02-03T04:05:06Z","isDir":false,"type":"file","mime":"text/plain; charset=utf-8","urls":{"read":"/read?path=%2Fgolden%2Fgolden.txt","download":"/read?download=1\u0026path=%2Fgolden%2Fgolden.txt"}}]`
+	if body != golden {
+		t.Fatalf("GET /readdir:\n got %s\nwant %s", body, golden)
+	}
+
+	if lastModified := response.Header.Get("Last-Modified"); lastModified != "Sat, 03 Feb 2001 04:05:06 GMT" {
+		t.Fatalf("Last-Modified = %q", lastModified)
+	}
+}
+
+func TestFrozenMtimeConditionalGets(t *testing.T) {
+	server := newTestServer(t)
+	freezeMtimes(t)
+
+	fullPath := filepath.Join(root, "file.txt")
+	if err := ioutil.WriteFile(fullPath, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	target := testURL(server, "/read", "/file.txt")
+	etag := fmt.Sprintf("\"%x-%x\"", frozenTime.UnixNano(), 7)
+
+	response, _ := getBody(t, target, nil)
+	if got := response.Header.Get("ETag"); got != etag {
+		t.Fatalf("ETag = %s, want %s", got, etag)
+	}
+
+	if err := os.Chtimes(fullPath, time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		header http.Header
+		status int
+	}{
+		{http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{http.Header{"If-Modified-Since": {"Sat, 03 Feb 2001 04:05:06 GMT"}}, http.StatusNotModified},
+		{http.Header{"If-Modified-Since": {"Sat, 03 Feb 2001 04:05:05 GMT"}}, http.StatusOK},
+		{http.Header{"If-None-Match": {"\"stale\""}}, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		response, _ := getBody(t, target, c.header)
+		if response.StatusCode != c.status {
+			t.Errorf("GET with %v: %s, want %d", c.header, response.Status, c.status)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const commentsFile = "/.comments.json"
+const maxCommentSize = 4096
+
+type comment struct {
+	ID      string    `json:"id"`
+	Author  string    `json:"author,omitempty"`
+	Text    string    `json:"text"`
+	Created time.Time `json:"created"`
+}
+
+type commentRequest struct {
+	Text string `json:"text"`
+}
+
+var commentsMutex sync.Mutex
+var comments = make(map[string][]*comment)
+
+func getCommentsPath() string {
+	return cacheDir + commentsFile
+}
+
+func initComments() {
+	data, err := ioutil.ReadFile(getCommentsPath())
+	if err == nil {
+		err = json.Unmarshal(data, &comments)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal("Unable to load comments file:", err)
+	}
+}
+
+func saveComments() error {
+	data, err := json.MarshalIndent(comments, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := getCommentsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, getCommentsPath())
+}
+
+func commentCount(globalPath string) int {
+	commentsMutex.Lock()
+	defer commentsMutex.Unlock()
+
+	return len(comments[globalPath])
+}
+
+func clearComments(globalPath string) {
+	commentsMutex.Lock()
+	defer commentsMutex.Unlock()
+
+	changed := false
+	for path := range comments {
+		if isWithin(path, globalPath) {
+			delete(comments, path)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := saveComments(); err != nil {
+			log.Print("Unable to save comments file: ", err)
+		}
+	}
+}
+
+func moveComments(src, dst string) {
+	commentsMutex.Lock()
+	defer commentsMutex.Unlock()
+
+	moved := make(map[string][]*comment)
+	for path, list := range comments {
+		if isWithin(path, src) {
+			moved[dst+strings.TrimPrefix(path, src)] = list
+			delete(comments, path)
+		} else if isWithin(path, dst) {
+			delete(comments, path)
+		}
+	}
+
+	if len(moved) == 0 {
+		return
+	}
+
+	for path, list := range moved {
+		comments[path] = list
+	}
+
+	if err := saveComments(); err != nil {
+		log.Print("Unable to save comments file: ", err)
+	}
+}
+
+func canDeleteComment(r *http.Request, c *comment) bool {
+	user := getUserFromRequest(r)
+	return user == nil || user.Admin || user.Name == c.Author
+}
+
+func canonicalizeComments(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleComments(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/comments"), "/")
+
+	switch {
+	case r.Method == "GET" && id == "":
+		if !canonicalizeComments(r.URL) && allowsRedirects(r) {
+			redirect(w, r)
+			return
+		}
+		listComments(w, r)
+	case r.Method == "POST" && id == "":
+		if !requireFeature(w, r, featureWrite) {
+			return
+		}
+		canonicalizeComments(r.URL)
+		addComment(w, r)
+	case r.Method == "DELETE" && id != "":
+		if !requireFeature(w, r, featureWrite) {
+			return
+		}
+		deleteComment(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listComments(w http.ResponseWriter, r *http.Request) {
+	if _, err := fsLstat(getFullPathFromRequest(r)); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	global := getGlobalPathFromRequest(r)
+
+	commentsMutex.Lock()
+	list := append([]*comment{}, comments[global]...)
+	commentsMutex.Unlock()
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func addComment(w http.ResponseWriter, r *http.Request) {
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+	if isCachePath(fullPath) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if _, err := fsLstat(fullPath); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	var request commentRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCommentSize)).Decode(&request); err != nil {
+		http.Error(w, "Invalid comment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	text := strings.TrimSpace(request.Text)
+	if text == "" {
+		http.Error(w, "Comment must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	c := &comment{
+		ID:      id,
+		Author:  getUserName(r),
+		Text:    text,
+		Created: now()}
+	global := mapPath(r, path)
+
+	commentsMutex.Lock()
+	comments[global] = append(comments[global], c)
+	err = saveComments()
+	commentsMutex.Unlock()
+
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	recordActivity(activityComment, c.Author, global)
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func deleteComment(w http.ResponseWriter, r *http.Request, id string) {
+	commentsMutex.Lock()
+	defer commentsMutex.Unlock()
+
+	for path, list := range comments {
+		for i, c := range list {
+			if c.ID != id {
+				continue
+			}
+
+			if !canDeleteComment(r, c) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			if len(list) == 1 {
+				delete(comments, path)
+			} else {
+				comments[path] = append(list[:i:i], list[i+1:]...)
+			}
+
+			if err := saveComments(); err != nil {
+				serveError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	http.Error(w, "Comment not found: "+id, http.StatusNotFound)
+}
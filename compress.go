@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultCompressMinSize = 1024
+
+var defaultCompressSkipTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/x-7z-compressed",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/zstd",
+	"application/octet-stream",
+}
+
+const defaultBrotliQuality = 5
+const defaultZstdLevel = 3
+
+var defaultEncodingPreference = []string{"br", "zstd", "gzip"}
+
+type encoderFactory func(w io.Writer) (io.WriteCloser, error)
+
+var encoders = map[string]encoderFactory{
+	"gzip": func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	},
+}
+
+var encodingPreference = []string{"gzip"}
+
+var streamingTypes = []string{"application/x-ndjson", "text/event-stream"}
+
+var commandEncodings = make(map[string]bool)
+
+// commandEncoder collects the output of the command on its own goroutine
+// but only writes it to w from the caller's, so that w is never used
+// concurrently with a Flush of the response.
+type commandEncoder struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	w      io.Writer
+	mutex  sync.Mutex
+	output bytes.Buffer
+	done   chan error
+}
+
+func newCommandEncoder(w io.Writer, name string, args ...string) (io.WriteCloser, error) {
+	cmd := exec.Command(name, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &commandEncoder{cmd: cmd, stdin: stdin, w: w, done: make(chan error, 1)}
+	go c.collect(stdout)
+
+	return c, nil
+}
+
+func (c *commandEncoder) collect(stdout io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		count, err := stdout.Read(buf)
+		if count > 0 {
+			c.mutex.Lock()
+			c.output.Write(buf[:count])
+			c.mutex.Unlock()
+		}
+
+		if err == io.EOF {
+			c.done <- nil
+			return
+		} else if err != nil {
+			c.done <- err
+			return
+		}
+	}
+}
+
+func (c *commandEncoder) drain() error {
+	c.mutex.Lock()
+	data := append([]byte(nil), c.output.Bytes()...)
+	c.output.Reset()
+	c.mutex.Unlock()
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	_, err := c.w.Write(data)
+	return err
+}
+
+func (c *commandEncoder) Write(p []byte) (int, error) {
+	count, err := c.stdin.Write(p)
+	if drainErr := c.drain(); err == nil {
+		err = drainErr
+	}
+
+	return count, err
+}
+
+func (c *commandEncoder) Flush() error {
+	return c.drain()
+}
+
+func (c *commandEncoder) Close() error {
+	err := c.stdin.Close()
+	if collectErr := <-c.done; err == nil {
+		err = collectErr
+	}
+	if waitErr := c.cmd.Wait(); err == nil {
+		err = waitErr
+	}
+	if drainErr := c.drain(); err == nil {
+		err = drainErr
+	}
+
+	return err
+}
+
+func registerCommandEncoder(encoding, command string, args ...string) {
+	commandPath, err := exec.LookPath(command)
+	if err != nil {
+		log.Printf("Encoding %s disabled: %v", encoding, err)
+		return
+	}
+
+	encoders[encoding] = func(w io.Writer) (io.WriteCloser, error) {
+		return newCommandEncoder(w, commandPath, args...)
+	}
+	commandEncodings[encoding] = true
+}
+
+func initCompression(compression CompressionConfig) {
+	gzipLevel := gzip.DefaultCompression
+	if compression.GzipLevel != 0 {
+		gzipLevel = compression.GzipLevel
+	}
+
+	encoders["gzip"] = func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzipLevel)
+	}
+
+	if compression.Brotli {
+		quality := defaultBrotliQuality
+		if compression.BrotliQuality != 0 {
+			quality = compression.BrotliQuality
+		}
+
+		registerCommandEncoder("br", "brotli", "-c", "-q", strconv.Itoa(quality))
+	}
+
+	if compression.Zstd {
+		level := defaultZstdLevel
+		if compression.ZstdLevel != 0 {
+			level = compression.ZstdLevel
+		}
+
+		registerCommandEncoder("zstd", "zstd", "-c", "-q", "-"+strconv.Itoa(level))
+	}
+
+	preference := compression.Preference
+	if preference == nil {
+		preference = defaultEncodingPreference
+	}
+
+	encodingPreference = nil
+	for _, encoding := range preference {
+		if _, present := encoders[encoding]; present {
+			encodingPreference = append(encodingPreference, encoding)
+		}
+	}
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding       string
+	streamEncoding string
+	streaming      bool
+	minSize        int
+	encoder        io.WriteCloser
+	buf            []byte
+	status         int
+	decided        bool
+}
+
+func parseQualityValues(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = value
+				}
+			}
+		}
+
+		accepted[name] = quality
+	}
+
+	return accepted
+}
+
+func negotiateEncoding(r *http.Request, preference []string) string {
+	accepted := parseQualityValues(r.Header.Get("Accept-Encoding"))
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range preference {
+		quality, present := accepted[encoding]
+		if !present {
+			quality, present = accepted["*"]
+		}
+
+		if present && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
+
+// getStreamingPreference leaves out encodings that run an external command,
+// since their output cannot be flushed before the response ends.
+func getStreamingPreference() []string {
+	var preference []string
+	for _, encoding := range encodingPreference {
+		if !commandEncodings[encoding] {
+			preference = append(preference, encoding)
+		}
+	}
+
+	return preference
+}
+
+func isStreamingType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, streaming := range streamingTypes {
+		if mediaType == streaming {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isCompressibleType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	configMutex.RLock()
+	skipTypes := config.Compression.SkipTypes
+	configMutex.RUnlock()
+
+	if skipTypes == nil {
+		skipTypes = defaultCompressSkipTypes
+	}
+
+	for _, skip := range skipTypes {
+		if strings.HasPrefix(mediaType, skip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newCompressWriter(w http.ResponseWriter, r *http.Request) (*compressWriter, bool) {
+	configMutex.RLock()
+	compression := config.Compression
+	configMutex.RUnlock()
+
+	if compression.Disabled || getClientProfile(r).NoCompression {
+		return nil, false
+	}
+
+	addVary(w.Header(), "Accept-Encoding")
+
+	encoding := negotiateEncoding(r, encodingPreference)
+	if encoding == "" {
+		return nil, false
+	}
+
+	minSize := compression.MinSize
+	if minSize == 0 {
+		minSize = defaultCompressMinSize
+	}
+
+	return &compressWriter{
+		ResponseWriter: w,
+		encoding:       encoding,
+		streamEncoding: negotiateEncoding(r, getStreamingPreference()),
+		minSize:        minSize,
+		status:         http.StatusOK}, true
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.decided {
+		return
+	}
+
+	c.status = status
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		c.decide()
+	}
+}
+
+func (c *compressWriter) decide() {
+	c.decided = true
+	header := c.Header()
+
+	encoding := c.encoding
+	if c.streaming || isStreamingType(header.Get("Content-Type")) {
+		encoding = c.streamEncoding
+	}
+
+	compress := encoding != "" &&
+		c.status == http.StatusOK &&
+		len(c.buf) >= c.minSize &&
+		header.Get("Content-Encoding") == "" &&
+		header.Get("Content-Range") == "" &&
+		isCompressibleType(header.Get("Content-Type"))
+
+	if compress {
+		encoder, err := encoders[encoding](c.ResponseWriter)
+		if err != nil {
+			log.Print("Unable to create encoder: ", err)
+		} else {
+			c.encoder = encoder
+			header.Del("Content-Length")
+			header.Set("Content-Encoding", encoding)
+		}
+	}
+
+	c.ResponseWriter.WriteHeader(c.status)
+	if len(c.buf) > 0 {
+		c.writeThrough(c.buf)
+		c.buf = nil
+	}
+}
+
+func (c *compressWriter) writeThrough(p []byte) (int, error) {
+	if c.encoder != nil {
+		return c.encoder.Write(p)
+	}
+
+	return c.ResponseWriter.Write(p)
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.decided {
+		return c.writeThrough(p)
+	}
+
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= c.minSize {
+		c.decide()
+	}
+
+	return len(p), nil
+}
+
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		c.streaming = true
+		c.decide()
+	}
+
+	if flusher, ok := c.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		c.decide()
+	}
+
+	if c.encoder != nil {
+		return c.encoder.Close()
+	}
+
+	return nil
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
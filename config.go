@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = duration
+	return nil
+}
+
+type Mount struct {
+	Path string `json:"path"`
+	Dir  string `json:"dir"`
+}
+
+type AuditConfig struct {
+	File     string `json:"file,omitempty"`
+	MaxSize  int64  `json:"maxSize,omitempty"`
+	MaxFiles int    `json:"maxFiles,omitempty"`
+	Webhook  string `json:"webhook,omitempty"`
+}
+
+type WatchdogConfig struct {
+	Interval Duration `json:"interval,omitzero"`
+	Timeout  Duration `json:"timeout,omitzero"`
+}
+
+type TLSConfig struct {
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+
+	MinVersion            string   `json:"minVersion,omitempty"`
+	Ciphers               []string `json:"ciphers,omitempty"`
+	DisableSessionTickets bool     `json:"disableSessionTickets,omitempty"`
+}
+
+type CompressionConfig struct {
+	Disabled  bool     `json:"disabled,omitempty"`
+	MinSize   int      `json:"minSize,omitempty"`
+	SkipTypes []string `json:"skipTypes,omitempty"`
+	GzipLevel int      `json:"gzipLevel,omitempty"`
+
+	Brotli        bool `json:"brotli,omitempty"`
+	BrotliQuality int  `json:"brotliQuality,omitempty"`
+
+	Zstd      bool `json:"zstd,omitempty"`
+	ZstdLevel int  `json:"zstdLevel,omitempty"`
+
+	Preference []string `json:"preference,omitempty"`
+}
+
+type SniffConfig struct {
+	Disabled bool  `json:"disabled,omitempty"`
+	MaxSize  int64 `json:"maxSize,omitempty"`
+}
+
+type UIConfig struct {
+	Locale string            `json:"locale,omitempty"`
+	Theme  string            `json:"theme,omitempty"`
+	Themes map[string]string `json:"themes,omitempty"`
+}
+
+type Config struct {
+	Root          string                     `json:"root,omitempty"`
+	Addr          string                     `json:"addr,omitempty"`
+	TLS           TLSConfig                  `json:"tls,omitzero"`
+	CacheDir      string                     `json:"cacheDir,omitempty"`
+	Users         string                     `json:"users,omitempty"`
+	Mounts        []Mount                    `json:"mounts,omitempty"`
+	LinkPolicy    string                     `json:"linkPolicy,omitempty"`
+	MaxUploadSize int64                      `json:"maxUploadSize,omitempty"`
+	Fetch         FetchConfig                `json:"fetch,omitzero"`
+	Fsync         bool                       `json:"fsync,omitempty"`
+	FsyncDirs     bool                       `json:"fsyncDirs,omitempty"`
+	Audit         AuditConfig                `json:"audit,omitzero"`
+	Watchdog      WatchdogConfig             `json:"watchdog,omitzero"`
+	FSTimeout     *Duration                  `json:"fsTimeout,omitempty"`
+	Compression   CompressionConfig          `json:"compression,omitzero"`
+	Features      map[string]FeatureFlag     `json:"features,omitempty"`
+	ContentTypes  map[string]string          `json:"contentTypes,omitempty"`
+	Extensions    map[string]ExtensionConfig `json:"extensions,omitempty"`
+	Sniff         SniffConfig                `json:"sniff,omitzero"`
+	Chaos         map[string]ChaosLayer      `json:"chaos,omitempty"`
+	Clock         ClockConfig                `json:"clock,omitzero"`
+	UI            UIConfig                   `json:"ui,omitzero"`
+	Trash         TrashConfig                `json:"trash,omitzero"`
+	Profiles      []ClientProfile            `json:"profiles,omitempty"`
+	Filenames     FilenameConfig             `json:"filenames,omitzero"`
+	Xattrs        []string                   `json:"xattrs,omitempty"`
+	Git           GitConfig                  `json:"git,omitzero"`
+	Index         IndexConfig                `json:"index,omitzero"`
+	Thumbnails    ThumbnailConfig            `json:"thumbnails,omitzero"`
+}
+
+var config Config
+var configFile string
+
+// fileConfig is the config as read from configFile, before command-line
+// flags override it. saveConfig writes its values for the overridable
+// settings so that the flags of one run are not persisted.
+var fileConfig Config
+var configMutex sync.RWMutex
+
+func loadConfig(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+
+	configFile = path
+	fileConfig = config
+	return nil
+}
+
+func writeConfig(path string, c *Config) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func saveConfig() error {
+	if configFile == "" {
+		return nil
+	}
+
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	saved := config
+	saved.Root = fileConfig.Root
+	saved.Addr = fileConfig.Addr
+	saved.Audit.File = fileConfig.Audit.File
+	return writeConfig(configFile, &saved)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveConfigKeepsFlagOverridesOut(t *testing.T) {
+	previous, previousFile, previousFileConfig := config, configFile, fileConfig
+	t.Cleanup(func() {
+		config, configFile, fileConfig = previous, previousFile, previousFileConfig
+	})
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"root":"/srv","audit":{"file":"/var/log/serve.log"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config = Config{}
+	if err := loadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Root = "/tmp/override"
+	config.Addr = ":9999"
+	config.Audit.File = "/tmp/override.log"
+	config.Mounts = []Mount{{Path: "/media", Dir: "/mnt/media"}}
+
+	if err := saveConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved Config
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.Root != "/srv" || saved.Addr != "" || saved.Audit.File != "/var/log/serve.log" {
+		t.Errorf("saved root %q, addr %q, audit %q; want the values from the file", saved.Root, saved.Addr, saved.Audit.File)
+	}
+	if len(saved.Mounts) != 1 {
+		t.Errorf("saved %d mounts, want 1", len(saved.Mounts))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const consistencyHeader = "X-Consistency-Token"
+
+var consistencyBoot = strconv.FormatInt(time.Now().UnixNano(), 36)
+var consistencySeq uint64
+
+func isMutation(r *http.Request) bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return false
+	}
+
+	return true
+}
+
+func setConsistencyToken(header http.Header) {
+	seq := atomic.AddUint64(&consistencySeq, 1)
+	header.Set(consistencyHeader, consistencyBoot+"."+strconv.FormatUint(seq, 10))
+	exposeHeaders(header, consistencyHeader)
+}
+
+// hasConsistencyToken reports whether the client echoed a token from an
+// earlier mutation, in which case responses must bypass every cache.
+func hasConsistencyToken(r *http.Request) bool {
+	return r.URL.Query().Get("consistency") != ""
+}
+
+func canonicalizeConsistency(query url.Values) bool {
+	if _, present := query["consistency"]; !present {
+		return true
+	}
+
+	token := query.Get("consistency")
+	if token != "" && len(query["consistency"]) == 1 {
+		return true
+	}
+
+	if token == "" {
+		query.Del("consistency")
+	} else {
+		query.Set("consistency", token)
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package convert
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	BackendImageMagick = "imagemagick"
+	BackendVips        = "vips"
+	BackendBuiltin     = "builtin"
+)
+
+type thumbnailBackend struct {
+	command    string
+	thumbnail  ThumbnailerFunc
+	extensions []string
+}
+
+var imageExtensions = []string{".jpg", ".jpeg", ".gif", ".png", ".webp"}
+
+var thumbnailBackends = map[string]thumbnailBackend{
+	BackendImageMagick: {command: "convert", thumbnail: convertThumbnail, extensions: imageExtensions},
+	BackendVips:        {command: "vipsthumbnail", thumbnail: vipsThumbnail, extensions: imageExtensions},
+	BackendBuiltin:     {thumbnail: builtinThumbnail, extensions: []string{".jpg", ".jpeg", ".gif", ".png"}},
+}
+
+var fallbackBackends = []string{BackendImageMagick, BackendBuiltin}
+
+func isInstalled(backend thumbnailBackend) bool {
+	if backend.command == "" {
+		return true
+	}
+
+	_, err := exec.LookPath(backend.command)
+	return err == nil
+}
+
+func convertThumbnail(src, dst string, dimension int) error {
+	dimAsStr := strconv.Itoa(dimension)
+	dimensions := dimAsStr + "x" + dimAsStr
+	cmd := exec.Command("convert", "-thumbnail", dimensions, src, dst)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("convert: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// vipsThumbnail decodes with shrink-on-load, so large originals are never
+// held in memory at full resolution.
+func vipsThumbnail(src, dst string, dimension int) error {
+	dimAsStr := strconv.Itoa(dimension)
+	cmd := exec.Command("vipsthumbnail", src, "--size", dimAsStr+"x"+dimAsStr, "-o", dst)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("vipsthumbnail: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// SelectThumbnailBackend registers the named backend for still images. If
+// its command is not installed, the first installed fallback is used
+// instead, ending with the builtin backend. It returns the name of the
+// backend that was registered.
+func SelectThumbnailBackend(name string) (string, error) {
+	if name == "" {
+		name = BackendImageMagick
+	}
+
+	if _, present := thumbnailBackends[name]; !present {
+		return "", fmt.Errorf("unknown backend: %s", name)
+	}
+
+	selected := name
+	for _, candidate := range append([]string{name}, fallbackBackends...) {
+		if isInstalled(thumbnailBackends[candidate]) {
+			selected = candidate
+			break
+		}
+	}
+
+	backend := thumbnailBackends[selected]
+	for _, ext := range imageExtensions {
+		UnregisterThumbnailer(ext)
+	}
+	for _, ext := range backend.extensions {
+		RegisterThumbnailer(ext, backend.thumbnail)
+	}
+
+	return selected, nil
+}
+
+func init() {
+	for _, ext := range imageExtensions {
+		RegisterThumbnailer(ext, ThumbnailerFunc(convertThumbnail))
+	}
+}
@@ -0,0 +1,141 @@
+package convert
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const builtinJPEGQuality = 85
+const maxBuiltinPixels = 64 * 1000 * 1000
+
+var errUnsupportedFormat = errors.New("unsupported thumbnail format")
+var errImageTooLarge = errors.New("image is too large to thumbnail")
+
+func thumbnailSize(width, height, dimension int) (int, int) {
+	if width <= dimension && height <= dimension {
+		return width, height
+	}
+
+	if width >= height {
+		return dimension, max(1, height*dimension/width)
+	}
+
+	return max(1, width*dimension/height), dimension
+}
+
+// resize averages every source pixel that falls within each destination
+// pixel, which avoids the aliasing of nearest-neighbour sampling when
+// shrinking large originals. Source rows are converted one at a time so
+// that no full-size copy of the image is made.
+func resize(src image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	row := image.NewRGBA(image.Rect(0, 0, srcWidth, 1))
+	sums := make([][4]int, width)
+
+	for dy := 0; dy < height; dy++ {
+		y0 := dy * srcHeight / height
+		y1 := max(y0+1, (dy+1)*srcHeight/height)
+
+		for dx := range sums {
+			sums[dx] = [4]int{}
+		}
+
+		for y := y0; y < y1; y++ {
+			draw.Draw(row, row.Bounds(), src, image.Pt(bounds.Min.X, bounds.Min.Y+y), draw.Src)
+			for dx := 0; dx < width; dx++ {
+				x0 := dx * srcWidth / width
+				x1 := max(x0+1, (dx+1)*srcWidth/width)
+				for x := x0; x < x1; x++ {
+					for c := 0; c < 4; c++ {
+						sums[dx][c] += int(row.Pix[x*4+c])
+					}
+				}
+			}
+		}
+
+		for dx := 0; dx < width; dx++ {
+			x0 := dx * srcWidth / width
+			x1 := max(x0+1, (dx+1)*srcWidth/width)
+			count := (y1 - y0) * (x1 - x0)
+			offset := dy*dst.Stride + dx*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sums[dx][c] / count)
+			}
+		}
+	}
+
+	return dst
+}
+
+func encodeThumbnail(dst string, img image.Image) error {
+	var encode func(file *os.File) error
+	switch strings.ToLower(filepath.Ext(dst)) {
+	case ".jpg", ".jpeg":
+		encode = func(file *os.File) error {
+			return jpeg.Encode(file, img, &jpeg.Options{Quality: builtinJPEGQuality})
+		}
+	case ".png":
+		encode = func(file *os.File) error { return png.Encode(file, img) }
+	case ".gif":
+		encode = func(file *os.File) error { return gif.Encode(file, img, nil) }
+	default:
+		return errUnsupportedFormat
+	}
+
+	file, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	err = encode(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// builtinThumbnail needs no external tools. It decodes the whole image, so
+// it is slower and uses more memory than the other backends, and refuses
+// images whose declared size exceeds maxBuiltinPixels.
+func builtinThumbnail(src, dst string, dimension int) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	imageConfig, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return err
+	}
+
+	if imageConfig.Width <= 0 || imageConfig.Height <= 0 ||
+		int64(imageConfig.Width)*int64(imageConfig.Height) > maxBuiltinPixels {
+		return errImageTooLarge
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	width, height := thumbnailSize(bounds.Dx(), bounds.Dy(), dimension)
+	return encodeThumbnail(dst, resize(img, width, height))
+}
@@ -2,22 +2,26 @@ package convert
 
 import (
 	"log"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type thumbInfo struct {
 	fullPath  string
 	thumbPath string
 	dimension int
-	notifier  chan error
-	callers   int
+	done      chan struct{}
+	err       error
 }
 
 const MAX_WORKING = 4
 
 var mutex = sync.Mutex{}
+var tempCounter uint64
 var waiting = make(map[string]*thumbInfo)
 
 var workTickets = make(chan bool, MAX_WORKING)
@@ -43,59 +47,73 @@ func releaseWorkTicket() {
 	return
 }
 
-func processEntry(key string) {
-	thumbInfo := waiting[key]
+func tempThumbPath(thumbPath string) string {
+	dir, name := filepath.Split(thumbPath)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	suffix := strconv.FormatUint(atomic.AddUint64(&tempCounter, 1), 10)
 
+	return filepath.Join(dir, "."+base+".tmp"+suffix+ext)
+}
+
+func processEntry(info *thumbInfo) {
 	acquireWorkTicket()
 
-	log.Printf("Processing %s: %d", key, len(waiting))
+	log.Printf("Processing %s", info.thumbPath)
+
+	tmpPath := tempThumbPath(info.thumbPath)
+	result := ErrNoThumbnailer
+	if thumbnailer, present := lookupThumbnailer(info.fullPath); present {
+		result = thumbnailer.Thumbnail(info.fullPath, tmpPath, info.dimension)
+	}
+
+	if result == nil {
+		result = os.Rename(tmpPath, info.thumbPath)
+	}
 
-	dimAsStr := strconv.Itoa(thumbInfo.dimension)
-	dimensions := dimAsStr + "x" + dimAsStr
-	cmd := exec.Command("convert", "-thumbnail", dimensions, thumbInfo.fullPath, thumbInfo.thumbPath)
-	result := cmd.Run()
+	if result != nil {
+		os.Remove(tmpPath)
+	}
 
 	releaseWorkTicket()
 
 	mutex.Lock()
-	for i := 0; i < thumbInfo.callers; i++ {
-		thumbInfo.notifier <- result
-	}
-	delete(waiting, key)
-	log.Printf("Finished %s: %d", key, len(waiting))
+	info.err = result
+	delete(waiting, info.thumbPath)
+	remaining := len(waiting)
 	mutex.Unlock()
-}
 
-func enqueueThumbnailRequest(fullPath, thumbPath string, dimension int) <-chan error {
-	var notifier chan error
+	close(info.done)
+	log.Printf("Finished %s: %d", info.thumbPath, remaining)
+}
 
+func enqueueThumbnailRequest(fullPath, thumbPath string, dimension int) *thumbInfo {
 	mutex.Lock()
-	if info, present := waiting[thumbPath]; !present {
-		log.Print("Initializing: " + thumbPath)
-		notifier = make(chan error, 1)
-		waiting[thumbPath] = &thumbInfo{
-			fullPath:  fullPath,
-			thumbPath: thumbPath,
-			dimension: dimension,
-			notifier:  notifier,
-			callers:   1,
-		}
+	defer mutex.Unlock()
 
-		go processEntry(thumbPath)
-	} else {
+	if info, present := waiting[thumbPath]; present {
 		log.Print("Updating: " + thumbPath)
-		info.callers = info.callers + 1
-		notifier = info.notifier
+		return info
 	}
-	mutex.Unlock()
 
-	return notifier
+	log.Print("Initializing: " + thumbPath)
+	info := &thumbInfo{
+		fullPath:  fullPath,
+		thumbPath: thumbPath,
+		dimension: dimension,
+		done:      make(chan struct{}),
+	}
+	waiting[thumbPath] = info
+
+	go processEntry(info)
+
+	return info
 }
 
 func MakeThumbnail(fullPath, thumbPath string, dimension int) error {
-	notifier := enqueueThumbnailRequest(fullPath, thumbPath, dimension)
-	response := <-notifier
-	return response
+	info := enqueueThumbnailRequest(fullPath, thumbPath, dimension)
+	<-info.done
+	return info.err
 }
 
 func init() {
@@ -0,0 +1,85 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type Metadata struct {
+	Caption  *string  `json:"caption,omitempty"`
+	Keywords []string `json:"keywords,omitempty"`
+	Rating   *int     `json:"rating,omitempty"`
+}
+
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+const maxCaptionLength = 2000
+const maxKeywords = 100
+
+func (m Metadata) validate() error {
+	if m.Caption == nil && m.Keywords == nil && m.Rating == nil {
+		return fmt.Errorf("%w: no fields given", ErrInvalidMetadata)
+	}
+
+	if m.Caption != nil && len(*m.Caption) > maxCaptionLength {
+		return fmt.Errorf("%w: caption is too long", ErrInvalidMetadata)
+	}
+
+	if len(m.Keywords) > maxKeywords {
+		return fmt.Errorf("%w: too many keywords", ErrInvalidMetadata)
+	}
+
+	for _, keyword := range m.Keywords {
+		if strings.TrimSpace(keyword) == "" || strings.ContainsAny(keyword, "\r\n") {
+			return fmt.Errorf("%w: invalid keyword %q", ErrInvalidMetadata, keyword)
+		}
+	}
+
+	if m.Rating != nil && (*m.Rating < 0 || *m.Rating > 5) {
+		return fmt.Errorf("%w: rating must be between 0 and 5", ErrInvalidMetadata)
+	}
+
+	return nil
+}
+
+func exiftoolArgs(m Metadata, src, dst string) []string {
+	args := []string{"-m", "-q", "-charset", "utf8", "-o", dst}
+
+	if m.Caption != nil {
+		caption := strings.ReplaceAll(*m.Caption, "\n", " ")
+		args = append(args,
+			"-XMP-dc:Description="+caption,
+			"-IPTC:Caption-Abstract="+caption,
+			"-EXIF:ImageDescription="+caption)
+	}
+
+	if m.Keywords != nil {
+		args = append(args, "-XMP-dc:Subject=", "-IPTC:Keywords=")
+		for _, keyword := range m.Keywords {
+			keyword = strings.TrimSpace(keyword)
+			args = append(args, "-XMP-dc:Subject="+keyword, "-IPTC:Keywords="+keyword)
+		}
+	}
+
+	if m.Rating != nil {
+		args = append(args, "-XMP-xmp:Rating="+strconv.Itoa(*m.Rating))
+	}
+
+	return append(args, src)
+}
+
+func ApplyMetadata(src, dst string, m Metadata) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("exiftool", exiftoolArgs(m, src, dst)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("exiftool: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
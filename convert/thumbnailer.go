@@ -0,0 +1,71 @@
+package convert
+
+import (
+	"errors"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A Thumbnailer writes an image of src no larger than dimension pixels on
+// either side to dst, in the format implied by the extension of dst.
+type Thumbnailer interface {
+	Thumbnail(src, dst string, dimension int) error
+}
+
+type ThumbnailerFunc func(src, dst string, dimension int) error
+
+func (f ThumbnailerFunc) Thumbnail(src, dst string, dimension int) error {
+	return f(src, dst, dimension)
+}
+
+var ErrNoThumbnailer = errors.New("no thumbnailer for file type")
+
+var thumbnailersMutex sync.RWMutex
+var thumbnailers = make(map[string]Thumbnailer)
+
+// RegisterThumbnailer makes t the thumbnailer for key, which is either an
+// extension such as ".jpg", a mime type such as "application/pdf" or a
+// wildcard such as "video/*". Extensions take precedence over mime types.
+func RegisterThumbnailer(key string, t Thumbnailer) {
+	thumbnailersMutex.Lock()
+	defer thumbnailersMutex.Unlock()
+
+	thumbnailers[strings.ToLower(key)] = t
+}
+
+func UnregisterThumbnailer(key string) {
+	thumbnailersMutex.Lock()
+	defer thumbnailersMutex.Unlock()
+
+	delete(thumbnailers, strings.ToLower(key))
+}
+
+func lookupThumbnailer(name string) (Thumbnailer, bool) {
+	thumbnailersMutex.RLock()
+	defer thumbnailersMutex.RUnlock()
+
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, present := thumbnailers[ext]; present {
+		return t, true
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if mimeType == "" {
+		return nil, false
+	}
+
+	if t, present := thumbnailers[mimeType]; present {
+		return t, true
+	}
+
+	major := strings.SplitN(mimeType, "/", 2)[0]
+	t, present := thumbnailers[major+"/*"]
+	return t, present
+}
+
+func HasThumbnailer(name string) bool {
+	_, present := lookupThumbnailer(name)
+	return present
+}
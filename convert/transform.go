@@ -0,0 +1,102 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Transform struct {
+	Rotate int
+	Flip   string
+	Crop   string
+}
+
+var ErrInvalidTransform = errors.New("invalid transform")
+
+var cropPattern = regexp.MustCompile(`^[0-9]+x[0-9]+\+[0-9]+\+[0-9]+$`)
+
+func (t Transform) validate() error {
+	switch t.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("%w: rotate must be 90, 180 or 270", ErrInvalidTransform)
+	}
+
+	switch t.Flip {
+	case "", "horizontal", "vertical":
+	default:
+		return fmt.Errorf("%w: flip must be horizontal or vertical", ErrInvalidTransform)
+	}
+
+	if t.Rotate != 0 && t.Flip != "" {
+		return fmt.Errorf("%w: rotate and flip cannot be combined", ErrInvalidTransform)
+	}
+
+	if t.Crop != "" && !cropPattern.MatchString(t.Crop) {
+		return fmt.Errorf("%w: crop must be WIDTHxHEIGHT+X+Y", ErrInvalidTransform)
+	}
+
+	if t.Rotate == 0 && t.Flip == "" && t.Crop == "" {
+		return fmt.Errorf("%w: no operation given", ErrInvalidTransform)
+	}
+
+	return nil
+}
+
+func jpegtranArgs(t Transform, src, dst string) []string {
+	args := []string{"-copy", "all", "-perfect"}
+	if t.Rotate != 0 {
+		args = append(args, "-rotate", strconv.Itoa(t.Rotate))
+	}
+	if t.Flip != "" {
+		args = append(args, "-flip", t.Flip)
+	}
+	if t.Crop != "" {
+		args = append(args, "-crop", t.Crop)
+	}
+
+	return append(args, "-outfile", dst, src)
+}
+
+func convertArgs(t Transform, src, dst string) []string {
+	args := []string{src}
+	if t.Rotate != 0 {
+		args = append(args, "-rotate", strconv.Itoa(t.Rotate))
+	}
+	switch t.Flip {
+	case "horizontal":
+		args = append(args, "-flop")
+	case "vertical":
+		args = append(args, "-flip")
+	}
+	if t.Crop != "" {
+		args = append(args, "-crop", t.Crop, "+repage")
+	}
+
+	return append(args, dst)
+}
+
+func ApplyTransform(src, dst string, t Transform) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	switch strings.ToLower(filepath.Ext(src)) {
+	case ".jpg", ".jpeg":
+		cmd = exec.Command("jpegtran", jpegtranArgs(t, src, dst)...)
+	default:
+		cmd = exec.Command("convert", convertArgs(t, src, dst)...)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", filepath.Base(cmd.Path), err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
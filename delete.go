@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+func hasRecursive(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["recursive"]
+	return present
+}
+
+func canonicalizeRecursive(query url.Values) bool {
+	return canonicalizeBoolean(query, "recursive")
+}
+
+func canonicalizeDelete(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeRecursive(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func isProtectedPath(r *http.Request, path, fullPath string) bool {
+	if path == "/" || fullPath == root || fullPath == cacheDir || isCachePath(fullPath) {
+		return true
+	}
+
+	for _, jail := range getJailRoots(r) {
+		if fullPath == jail.dir {
+			return true
+		}
+	}
+
+	return false
+}
+
+func removeThumbnails(globalPath string) {
+	for _, dir := range listThumbDirs() {
+		for _, suffix := range []string{"", jpegPreviewSuffix} {
+			thumbPath := cacheDir + dir + globalPath + suffix
+			if err := os.RemoveAll(thumbPath); err != nil {
+				log.Printf("Unable to remove thumbnails %s: %v", thumbPath, err)
+			}
+		}
+	}
+}
+
+func handleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeDelete(r.URL)
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	if isProtectedPath(r, path, fullPath) {
+		http.Error(w, "Refusing to delete protected path: "+path, http.StatusForbidden)
+		return
+	}
+
+	fileInfo, err := fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, path)) {
+		return
+	}
+
+	trashed := !getTrashConfig().Disabled
+	if trashed {
+		err = moveToTrash(r, fullPath, fileInfo)
+	} else {
+		err = runWithTimeout("remove", fullPath, func() error {
+			if fileInfo.IsDir() && hasRecursive(r) {
+				return os.RemoveAll(fullPath)
+			}
+			return os.Remove(fullPath)
+		})
+	}
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	removeThumbnails(getGlobalPathFromRequest(r))
+	if !trashed {
+		clearMetadata(getGlobalPathFromRequest(r))
+	}
+	recordActivity(activityDelete, getUserName(r), getGlobalPathFromRequest(r))
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+)
+
+const maxReaddirDepth = 32
+const maxReaddirEntries = 100000
+
+var errTooManyEntries = errors.New("Too many entries; use a smaller depth")
+
+func getDepth(r *http.Request) int {
+	depth, err := strconv.Atoi(r.URL.Query().Get("depth"))
+	if err != nil {
+		return 1
+	}
+
+	return depth
+}
+
+func canonicalizeDepth(query url.Values) bool {
+	canon := true
+
+	if _, present := query["recursive"]; present {
+		if value := query.Get("recursive"); value != "" && value != "0" {
+			query.Set("depth", strconv.Itoa(maxReaddirDepth))
+		}
+		query.Del("recursive")
+		canon = false
+	}
+
+	if _, present := query["depth"]; !present {
+		return canon
+	}
+
+	depth, err := strconv.Atoi(query.Get("depth"))
+	if err != nil || depth <= 1 {
+		query.Del("depth")
+		return false
+	}
+
+	if depth > maxReaddirDepth {
+		depth = maxReaddirDepth
+	}
+
+	value := strconv.Itoa(depth)
+	if len(query["depth"]) == 1 && query.Get("depth") == value {
+		return canon
+	}
+
+	query.Set("depth", value)
+	return false
+}
+
+func listTree(r *http.Request, fullPath, dirPath string, depth int, filter *statsFilter) ([]*Stats, error) {
+	var tree []*Stats
+
+	err := walkTree(r, fullPath, dirPath, depth, filter, func(stats []*Stats) error {
+		tree = append(tree, stats...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+func walkTree(r *http.Request, fullPath, dirPath string, depth int, filter *statsFilter, emit func([]*Stats) error) error {
+	count := 0
+	var walk func(fullPath, dirPath string, depth int) error
+
+	walk = func(fullPath, dirPath string, depth int) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+
+		stats, err := listDirectory(r, fullPath, dirPath)
+		if err != nil {
+			return err
+		}
+
+		matched := filterStats(filter, stats)
+		count += len(matched)
+		if count > maxReaddirEntries {
+			return errTooManyEntries
+		}
+		if err := emit(matched); err != nil {
+			return err
+		}
+
+		if depth <= 1 {
+			return nil
+		}
+
+		for _, stat := range stats {
+			if !stat.IsDir || stat.IsLink || stat.Deleted || isCachePath(filepath.Join(fullPath, stat.Name)) {
+				continue
+			}
+
+			if err := walk(filepath.Join(fullPath, stat.Name), stat.Path, depth-1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return walk(fullPath, dirPath, depth)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+var ownerNamesMutex sync.Mutex
+var userNames = make(map[uint32]string)
+var groupNames = make(map[uint32]string)
+
+func hasDetail(r *http.Request) bool {
+	if user := getUserFromRequest(r); user != nil && !user.Admin {
+		return false
+	}
+
+	query := r.URL.Query()
+	_, present := query["detail"]
+	return present
+}
+
+func canonicalizeDetail(query url.Values) bool {
+	return canonicalizeBoolean(query, "detail")
+}
+
+func lookupOwnerName(names map[uint32]string, id uint32, lookup func(string) (string, error)) string {
+	ownerNamesMutex.Lock()
+	defer ownerNamesMutex.Unlock()
+
+	if name, present := names[id]; present {
+		return name
+	}
+
+	key := strconv.FormatUint(uint64(id), 10)
+	name, err := lookup(key)
+	if err != nil {
+		name = key
+	}
+	names[id] = name
+
+	return name
+}
+
+func lookupUserName(uid string) (string, error) {
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return "", err
+	}
+
+	return u.Username, nil
+}
+
+func lookupGroupName(gid string) (string, error) {
+	g, err := user.LookupGroupId(gid)
+	if err != nil {
+		return "", err
+	}
+
+	return g.Name, nil
+}
+
+func addStatsDetail(stats *Stats, fileInfo os.FileInfo) {
+	mode := fileInfo.Mode()
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	stats.Mode = fmt.Sprintf("%04o", perm)
+
+	if uid, gid, ok := fileOwner(fileInfo); ok {
+		stats.Owner = lookupOwnerName(userNames, uid, lookupUserName)
+		stats.Group = lookupOwnerName(groupNames, gid, lookupGroupName)
+	}
+
+	if dev, ino, ok := fileIdentity(fileInfo); ok {
+		stats.Dev = dev
+		stats.Ino = ino
+	}
+
+	if count := linkCount(fileInfo); count > 0 {
+		stats.Links = count
+	}
+}
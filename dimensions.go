@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dimensionsCacheLimit = 10000
+const webpHeaderSize = 30
+
+var errNoDimensions = errors.New("no image dimensions")
+
+type dimensions struct {
+	Width  int
+	Height int
+}
+
+type dimensionsCacheEntry struct {
+	mtime      time.Time
+	dimensions *dimensions
+	err        error
+}
+
+var dimensionsCacheMutex sync.Mutex
+var dimensionsCache = make(map[string]*dimensionsCacheEntry)
+
+func readWebPDimensions(reader io.Reader) (*dimensions, error) {
+	header := make([]byte, webpHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, errNoDimensions
+	}
+
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return nil, errNoDimensions
+	}
+
+	chunk := header[20:]
+	switch string(header[12:16]) {
+	case "VP8 ":
+		if !bytes.Equal(chunk[3:6], []byte{0x9d, 0x01, 0x2a}) {
+			return nil, errNoDimensions
+		}
+		return &dimensions{
+			Width:  int(binary.LittleEndian.Uint16(chunk[6:]) & 0x3fff),
+			Height: int(binary.LittleEndian.Uint16(chunk[8:]) & 0x3fff)}, nil
+	case "VP8L":
+		if chunk[0] != 0x2f {
+			return nil, errNoDimensions
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:])
+		return &dimensions{
+			Width:  int(bits&0x3fff) + 1,
+			Height: int(bits>>14&0x3fff) + 1}, nil
+	case "VP8X":
+		return &dimensions{
+			Width:  int(uint32(chunk[4])|uint32(chunk[5])<<8|uint32(chunk[6])<<16) + 1,
+			Height: int(uint32(chunk[7])|uint32(chunk[8])<<8|uint32(chunk[9])<<16) + 1}, nil
+	}
+
+	return nil, errNoDimensions
+}
+
+func readDimensions(fullPath string, fileInfo os.FileInfo) (*dimensions, error) {
+	ext := strings.ToLower(filepath.Ext(fullPath))
+	if !isThumbnailable(ext) {
+		return nil, errNoDimensions
+	}
+
+	file, err := fsOpen(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if ext == ".webp" {
+		return readWebPDimensions(file)
+	}
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, err
+	}
+
+	size := &dimensions{Width: config.Width, Height: config.Height}
+	if exif, err := getExif(fullPath, fileInfo); err == nil && exif.Orientation >= 5 && exif.Orientation <= 8 {
+		size.Width, size.Height = size.Height, size.Width
+	}
+
+	return size, nil
+}
+
+// getDimensions returns the display dimensions of an image, decoding only
+// its header and caching the result by modification time.
+func getDimensions(fullPath string, fileInfo os.FileInfo) (*dimensions, error) {
+	dimensionsCacheMutex.Lock()
+	entry, present := dimensionsCache[fullPath]
+	dimensionsCacheMutex.Unlock()
+
+	if present && entry.mtime.Equal(fileInfo.ModTime()) && !chaosMiss(cacheDimensions, fullPath) {
+		return entry.dimensions, entry.err
+	}
+
+	size, err := readDimensions(fullPath, fileInfo)
+
+	dimensionsCacheMutex.Lock()
+	if len(dimensionsCache) >= dimensionsCacheLimit {
+		dimensionsCache = make(map[string]*dimensionsCacheEntry)
+	}
+	dimensionsCache[fullPath] = &dimensionsCacheEntry{mtime: fileInfo.ModTime(), dimensions: size, err: err}
+	dimensionsCacheMutex.Unlock()
+
+	return size, err
+}
+
+func invalidateDimensions(fullPath string) {
+	dimensionsCacheMutex.Lock()
+	delete(dimensionsCache, fullPath)
+	dimensionsCacheMutex.Unlock()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+func hasDownload(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["download"]
+	return present
+}
+
+func canonicalizeDownload(query url.Values) bool {
+	return canonicalizeBoolean(query, "download")
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+func encodeRFC5987(value string) string {
+	const hex = "0123456789ABCDEF"
+
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if isAttrChar(c) {
+			builder.WriteByte(c)
+		} else {
+			builder.WriteByte('%')
+			builder.WriteByte(hex[c>>4])
+			builder.WriteByte(hex[c&0x0f])
+		}
+	}
+
+	return builder.String()
+}
+
+func asciiFallback(name string) (string, bool) {
+	exact := true
+
+	var builder strings.Builder
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError, r >= utf8.RuneSelf, r < 0x20, r == 0x7f:
+			builder.WriteByte('_')
+			exact = false
+		case r == '"' || r == '\\':
+			builder.WriteByte('_')
+			exact = false
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String(), exact
+}
+
+func contentDisposition(r *http.Request, name string) string {
+	dispositionType := "inline"
+	if hasDownload(r) {
+		dispositionType = "attachment"
+	}
+
+	if override := getExtensionConfig(name).Disposition; override != "" {
+		dispositionType = override
+	}
+
+	return formatDisposition(dispositionType, name)
+}
+
+func formatDisposition(dispositionType, name string) string {
+	name = sanitizeFilename(name)
+	fallback, exact := asciiFallback(name)
+	disposition := dispositionType + "; filename=\"" + fallback + "\""
+	if !exact {
+		disposition = disposition + "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+
+	return disposition
+}
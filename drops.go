@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dropsFile = "/.drops.json"
+const dropPrefix = "/drop/"
+const dropsPrefix = "/drops/"
+
+type drop struct {
+	ID        string     `json:"id"`
+	TokenHash string     `json:"tokenHash,omitempty"`
+	Owner     string     `json:"owner,omitempty"`
+	Path      string     `json:"path"`
+	Created   time.Time  `json:"created"`
+	Expires   *time.Time `json:"expires,omitempty"`
+}
+
+type dropCreated struct {
+	*drop
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+type dropPage struct {
+	Locale *locale
+	Style  template.CSS
+	Action string
+}
+
+type dropReceipt struct {
+	Name      string            `json:"name"`
+	Size      int64             `json:"size"`
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+var dropsMutex sync.Mutex
+
+func canonicalizeDrops(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func getDropsPath() string {
+	return cacheDir + dropsFile
+}
+
+func loadDrops() ([]*drop, error) {
+	data, err := ioutil.ReadFile(getDropsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var drops []*drop
+	if err := json.Unmarshal(data, &drops); err != nil {
+		return nil, err
+	}
+
+	return drops, nil
+}
+
+func saveDrops(drops []*drop) error {
+	data, err := json.MarshalIndent(drops, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := getDropsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, getDropsPath())
+}
+
+func hashDropToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+func findDrop(token string) (*drop, bool) {
+	if token == "" || strings.Contains(token, "/") {
+		return nil, false
+	}
+
+	dropsMutex.Lock()
+	drops, err := loadDrops()
+	dropsMutex.Unlock()
+	if err != nil {
+		log.Print("Unable to load drops: ", err)
+		return nil, false
+	}
+
+	hash := hashDropToken(token)
+	for _, d := range drops {
+		if subtle.ConstantTimeCompare([]byte(d.TokenHash), []byte(hash)) == 1 {
+			return d, !d.expired()
+		}
+	}
+
+	return nil, false
+}
+
+func (d *drop) expired() bool {
+	return d.Expires != nil && !now().Before(*d.Expires)
+}
+
+func expireDrops() {
+	dropsMutex.Lock()
+	defer dropsMutex.Unlock()
+
+	drops, err := loadDrops()
+	if err != nil {
+		log.Print("Unable to load drops: ", err)
+		return
+	}
+
+	current := make([]*drop, 0, len(drops))
+	for _, d := range drops {
+		if !d.expired() {
+			current = append(current, d)
+		}
+	}
+
+	if len(current) == len(drops) {
+		return
+	}
+
+	if err := saveDrops(current); err != nil {
+		log.Print("Unable to save drops: ", err)
+	}
+}
+
+func authenticateDrop(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	d, ok := findDrop(strings.TrimPrefix(r.URL.Path, dropPrefix))
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return r, false
+	}
+
+	ctx := context.WithValue(r.Context(), dropKey, d)
+	if d.Owner != "" && userStore != nil {
+		user, present := userStore.Get(d.Owner)
+		if !present {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return r, false
+		}
+		ctx = context.WithValue(ctx, userKey, user)
+	}
+
+	return r.WithContext(ctx), true
+}
+
+func getDropFromRequest(r *http.Request) *drop {
+	d, _ := r.Context().Value(dropKey).(*drop)
+	return d
+}
+
+func handleDrops(w http.ResponseWriter, r *http.Request) {
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	owner := getUserName(r)
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/drops"), "/")
+
+	dropsMutex.Lock()
+	defer dropsMutex.Unlock()
+
+	drops, err := loadDrops()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && id == "":
+		list := make([]drop, 0, len(drops))
+		for _, d := range drops {
+			if d.Owner == owner {
+				entry := *d
+				entry.TokenHash = ""
+				list = append(list, entry)
+			}
+		}
+		writeJSON(w, http.StatusOK, list)
+	case r.Method == "POST" && id == "":
+		canonicalizeDrops(r.URL)
+		path := getPathFromRequest(r)
+		if !isResolvedWithinRoot(mapPath(r, path)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		fileInfo, err := fsStat(getFullPathFromRequest(r))
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		if !fileInfo.IsDir() {
+			http.Error(w, "Not a directory", http.StatusBadRequest)
+			return
+		}
+
+		ttl, err := getTTLFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		dropID, err := randomHex(8)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		token, err := randomHex(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		d := &drop{
+			ID:        dropID,
+			TokenHash: hashDropToken(token),
+			Owner:     owner,
+			Path:      path,
+			Created:   now()}
+		if ttl > 0 {
+			expires := d.Created.Add(ttl)
+			d.Expires = &expires
+		}
+
+		if err := saveDrops(append(drops, d)); err != nil {
+			serveError(w, err)
+			return
+		}
+
+		recordActivity(activityShare, owner, mapPath(r, path))
+
+		entry := *d
+		entry.TokenHash = ""
+		writeJSON(w, http.StatusCreated, &dropCreated{drop: &entry, Token: token, URL: dropPrefix + token})
+	case r.Method == "DELETE" && id != "":
+		for i, d := range drops {
+			if d.ID == id && d.Owner == owner {
+				if err := saveDrops(append(drops[:i], drops[i+1:]...)); err != nil {
+					serveError(w, err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		http.Error(w, "Drop not found: "+id, http.StatusNotFound)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func getDropUpload(r *http.Request) (string, *multipart.Part, error) {
+	body, err := getUploadReader(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if part, ok := body.(*multipart.Part); ok {
+		return part.FileName(), part, nil
+	}
+
+	return r.URL.Query().Get("name"), nil, nil
+}
+
+func freeName(dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; ; i++ {
+		if _, err := fsLstat(filepath.Join(dir, candidate)); os.IsNotExist(err) {
+			return candidate, nil
+		} else if err != nil {
+			return "", err
+		}
+		candidate = base + " (" + strconv.Itoa(i) + ")" + ext
+	}
+}
+
+func handleDrop(w http.ResponseWriter, r *http.Request) {
+	d := getDropFromRequest(r)
+	if d == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		loc := negotiateLocale(r)
+		page := &dropPage{
+			Locale: loc,
+			Style:  loadThemeStyle(getThemeFromRequest(r)),
+			Action: r.URL.Path}
+
+		header := w.Header()
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		header.Set("Content-Language", loc.Tag)
+		header.Set("Referrer-Policy", "no-referrer")
+		addVary(header, "Accept-Language")
+
+		if err := uiTemplates.ExecuteTemplate(w, "drop.html", page); err != nil {
+			log.Print("Unable to render drop page: ", err)
+		}
+		return
+	case "POST":
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !limitUploadBody(w, r) {
+		return
+	}
+
+	name, part, err := getDropUpload(r)
+	if err != nil {
+		serveWriteError(w, err)
+		return
+	}
+
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || strings.HasPrefix(name, ".") {
+		http.Error(w, "Invalid file name", http.StatusBadRequest)
+		return
+	}
+
+	if !isResolvedWithinRoot(mapPath(r, d.Path)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, filepath.Join(d.Path, name))) {
+		return
+	}
+
+	dir := resolvePath(mapPath(r, d.Path))
+	name, err = freeName(dir, name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	expected, err := getExpectedChecksums(r, part == nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if part != nil {
+		body = part
+	}
+
+	fullPath := filepath.Join(dir, name)
+	checksums, err := writeFile(fullPath, body, false, expected)
+	if err != nil {
+		serveWriteError(w, err)
+		return
+	}
+
+	fileInfo, err := fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	recordActivity(activityUpload, getUserName(r), mapPath(r, filepath.Join(d.Path, name)))
+	writeJSON(w, http.StatusCreated, &dropReceipt{Name: name, Size: fileInfo.Size(), Checksums: checksums})
+}
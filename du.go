@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	diskUsageWorkers    = 8
+	diskUsageTimeout    = 10 * time.Second
+	diskUsageCacheTTL   = time.Minute
+	diskUsageCacheLimit = 1000
+)
+
+type diskUsage struct {
+	Size     int64 `json:"size"`
+	Files    int64 `json:"files"`
+	Dirs     int64 `json:"dirs"`
+	Complete bool  `json:"complete"`
+}
+
+type diskUsageCacheEntry struct {
+	computed time.Time
+	usage    *diskUsage
+}
+
+var diskUsageCacheMutex sync.Mutex
+var diskUsageCache = make(map[string]*diskUsageCacheEntry)
+
+func hasDiskUsage(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["du"]
+	return present
+}
+
+func canonicalizeDiskUsage(query url.Values) bool {
+	return canonicalizeBoolean(query, "du")
+}
+
+type diskUsageWalker struct {
+	ctx   context.Context
+	slots chan struct{}
+	wg    sync.WaitGroup
+	size  int64
+	files int64
+	dirs  int64
+}
+
+func (d *diskUsageWalker) walk(dir string) {
+	defer d.wg.Done()
+
+	select {
+	case d.slots <- struct{}{}:
+	case <-d.ctx.Done():
+		return
+	}
+	infos, err := fsReadDir(dir)
+	<-d.slots
+
+	if err != nil {
+		return
+	}
+
+	for _, info := range infos {
+		if d.ctx.Err() != nil {
+			return
+		}
+
+		fullPath := filepath.Join(dir, info.Name())
+		if isCachePath(fullPath) {
+			continue
+		}
+
+		switch {
+		case info.IsDir():
+			atomic.AddInt64(&d.dirs, 1)
+			d.wg.Add(1)
+			go d.walk(fullPath)
+		case info.Mode().IsRegular():
+			atomic.AddInt64(&d.files, 1)
+			atomic.AddInt64(&d.size, info.Size())
+		}
+	}
+}
+
+// computeDiskUsage walks the tree below fullPath with a bounded number of
+// concurrent readdirs. A walk cut short by the timeout is reported as
+// incomplete.
+func computeDiskUsage(ctx context.Context, fullPath string) *diskUsage {
+	ctx, cancel := context.WithTimeout(ctx, diskUsageTimeout)
+	defer cancel()
+
+	walker := &diskUsageWalker{ctx: ctx, slots: make(chan struct{}, diskUsageWorkers)}
+	walker.wg.Add(1)
+	go walker.walk(fullPath)
+	walker.wg.Wait()
+
+	return &diskUsage{
+		Size:     atomic.LoadInt64(&walker.size),
+		Files:    atomic.LoadInt64(&walker.files),
+		Dirs:     atomic.LoadInt64(&walker.dirs),
+		Complete: ctx.Err() == nil}
+}
+
+func getDiskUsage(r *http.Request, fullPath string) *diskUsage {
+	diskUsageCacheMutex.Lock()
+	entry, present := diskUsageCache[fullPath]
+	diskUsageCacheMutex.Unlock()
+
+	if present && !hasConsistencyToken(r) && now().Sub(entry.computed) < diskUsageCacheTTL {
+		return entry.usage
+	}
+
+	usage := computeDiskUsage(r.Context(), fullPath)
+	if !usage.Complete {
+		return usage
+	}
+
+	diskUsageCacheMutex.Lock()
+	if len(diskUsageCache) >= diskUsageCacheLimit {
+		diskUsageCache = make(map[string]*diskUsageCacheEntry)
+	}
+	diskUsageCache[fullPath] = &diskUsageCacheEntry{computed: now(), usage: usage}
+	diskUsageCacheMutex.Unlock()
+
+	return usage
+}
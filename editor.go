@@ -0,0 +1,101 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+var editableExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".txt":      true,
+}
+
+type editorPage struct {
+	Locale     *locale
+	Style      template.CSS
+	Path       string
+	Name       string
+	ReadHref   string
+	ParentHref string
+}
+
+func isEditable(name string) bool {
+	if editableExtensions[normalizeExt(filepath.Ext(name))] {
+		return true
+	}
+
+	contentType := contentTypeForName(name)
+	if strings.HasPrefix(contentType, "text/") {
+		return true
+	}
+
+	for _, suffix := range []string{"/json", "/xml", "/javascript", "+json", "+xml"} {
+		mediaType := strings.SplitN(contentType, ";", 2)[0]
+		if strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func canonicalizeEdit(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeLang(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleEdit(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		handleImageEdit(w, r)
+		return
+	}
+
+	url := r.URL
+	canon := canonicalizeEdit(url)
+	if !canon && allowsRedirects(r) {
+		redirect(w, r)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	if fileInfo, err := fsStat(fullPath); err == nil && fileInfo.IsDir() {
+		http.Redirect(w, r, browseURL(path, ""), http.StatusFound)
+		return
+	}
+
+	loc := negotiateLocale(r)
+	page := &editorPage{
+		Locale:     loc,
+		Style:      loadThemeStyle(getThemeFromRequest(r)),
+		Path:       path,
+		Name:       filepath.Base(path),
+		ReadHref:   endpointURL("/read", path),
+		ParentHref: browseURL(filepath.Dir(path), "")}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Language", loc.Tag)
+	addVary(header, "Accept-Language")
+	addVary(header, "Cookie")
+
+	if err := uiTemplates.ExecuteTemplate(w, "editor.html", page); err != nil {
+		log.Print("Unable to render editor page: ", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func fileETag(fileInfo os.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", modTime(fileInfo).UnixNano(), fileInfo.Size())
+}
+
+func checkIfMatch(w http.ResponseWriter, r *http.Request, fileInfo os.FileInfo) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	if fileInfo != nil {
+		if strings.TrimSpace(header) == "*" {
+			return true
+		}
+
+		current := fileETag(fileInfo)
+		for _, etag := range strings.Split(header, ",") {
+			if strings.TrimSpace(etag) == current {
+				return true
+			}
+		}
+	}
+
+	http.Error(w, "File has changed", http.StatusPreconditionFailed)
+	return false
+}
+
+func checkPreconditions(w http.ResponseWriter, r *http.Request, fileInfo os.FileInfo) bool {
+	if !checkIfMatch(w, r, fileInfo) {
+		return false
+	}
+
+	if value := r.URL.Query().Get("mtime"); value != "" {
+		expected, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			http.Error(w, "Invalid mtime: "+value, http.StatusBadRequest)
+			return false
+		}
+
+		if fileInfo == nil || !modTime(fileInfo).Equal(expected) {
+			http.Error(w, "File has changed", http.StatusPreconditionFailed)
+			return false
+		}
+	}
+
+	if header := r.Header.Get("If-Unmodified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		if err == nil && (fileInfo == nil || modTime(fileInfo).Truncate(time.Second).After(since)) {
+			http.Error(w, "File has changed", http.StatusPreconditionFailed)
+			return false
+		}
+	}
+
+	return true
+}
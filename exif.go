@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const exifReadLimit = 128 * 1024
+const exifCacheLimit = 10000
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+const (
+	exifTagMake             = 0x010f
+	exifTagModel            = 0x0110
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagDateTimeOriginal = 0x9003
+)
+
+const (
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+)
+
+var errNoExif = errors.New("no exif data")
+
+type exifData struct {
+	Make        string
+	Model       string
+	DateTime    time.Time
+	Orientation int
+	HasLocation bool
+	Latitude    float64
+	Longitude   float64
+}
+
+type exifCacheEntry struct {
+	mtime time.Time
+	data  *exifData
+	err   error
+}
+
+var exifCacheMutex sync.Mutex
+var exifCache = make(map[string]*exifCacheEntry)
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func (t *tiffReader) uint16(offset int) (uint16, bool) {
+	if offset < 0 || offset+2 > len(t.data) {
+		return 0, false
+	}
+	return t.order.Uint16(t.data[offset:]), true
+}
+
+func (t *tiffReader) uint32(offset int) (uint32, bool) {
+	if offset < 0 || offset+4 > len(t.data) {
+		return 0, false
+	}
+	return t.order.Uint32(t.data[offset:]), true
+}
+
+func (t *tiffReader) readIFD(offset int, visit func(tag uint16, entry int)) {
+	count, ok := t.uint16(offset)
+	if !ok {
+		return
+	}
+
+	for i := 0; i < int(count); i++ {
+		entry := offset + 2 + i*12
+		tag, ok := t.uint16(entry)
+		if !ok {
+			return
+		}
+		visit(tag, entry)
+	}
+}
+
+func (t *tiffReader) ascii(entry int) string {
+	count, ok := t.uint32(entry + 4)
+	if !ok || count == 0 {
+		return ""
+	}
+
+	start := entry + 8
+	if count > 4 {
+		offset, _ := t.uint32(entry + 8)
+		start = int(offset)
+	}
+
+	end := start + int(count)
+	if start < 0 || end > len(t.data) || end < start {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimRight(string(t.data[start:end]), "\x00"))
+}
+
+// coordinate reads a GPS latitude or longitude stored as three rationals
+// of degrees, minutes and seconds.
+func (t *tiffReader) coordinate(entry int) (float64, bool) {
+	count, ok := t.uint32(entry + 4)
+	if !ok || count != 3 {
+		return 0, false
+	}
+
+	offset, _ := t.uint32(entry + 8)
+	value := 0.0
+	for i, scale := range []float64{1, 60, 3600} {
+		numerator, ok := t.uint32(int(offset) + i*8)
+		denominator, _ := t.uint32(int(offset) + i*8 + 4)
+		if !ok || denominator == 0 {
+			return 0, false
+		}
+		value += float64(numerator) / float64(denominator) / scale
+	}
+
+	return value, true
+}
+
+func parseTIFF(data []byte) (*exifData, error) {
+	if len(data) < 8 {
+		return nil, errNoExif
+	}
+
+	reader := &tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		reader.order = binary.LittleEndian
+	case "MM":
+		reader.order = binary.BigEndian
+	default:
+		return nil, errNoExif
+	}
+
+	ifd0, _ := reader.uint32(4)
+	exif := &exifData{}
+	exifIFD := -1
+	gpsIFD := -1
+	var dateTime string
+
+	reader.readIFD(int(ifd0), func(tag uint16, entry int) {
+		switch tag {
+		case exifTagMake:
+			exif.Make = reader.ascii(entry)
+		case exifTagModel:
+			exif.Model = reader.ascii(entry)
+		case exifTagOrientation:
+			orientation, _ := reader.uint16(entry + 8)
+			exif.Orientation = int(orientation)
+		case exifTagDateTime:
+			dateTime = reader.ascii(entry)
+		case exifTagExifIFD:
+			offset, _ := reader.uint32(entry + 8)
+			exifIFD = int(offset)
+		case exifTagGPSIFD:
+			offset, _ := reader.uint32(entry + 8)
+			gpsIFD = int(offset)
+		}
+	})
+
+	if exifIFD >= 0 {
+		reader.readIFD(exifIFD, func(tag uint16, entry int) {
+			if tag == exifTagDateTimeOriginal {
+				dateTime = reader.ascii(entry)
+			}
+		})
+	}
+
+	if gpsIFD >= 0 {
+		var latitudeRef, longitudeRef string
+		var hasLatitude, hasLongitude bool
+		reader.readIFD(gpsIFD, func(tag uint16, entry int) {
+			switch tag {
+			case gpsTagLatitudeRef:
+				latitudeRef = reader.ascii(entry)
+			case gpsTagLatitude:
+				exif.Latitude, hasLatitude = reader.coordinate(entry)
+			case gpsTagLongitudeRef:
+				longitudeRef = reader.ascii(entry)
+			case gpsTagLongitude:
+				exif.Longitude, hasLongitude = reader.coordinate(entry)
+			}
+		})
+
+		if latitudeRef == "S" {
+			exif.Latitude = -exif.Latitude
+		}
+		if longitudeRef == "W" {
+			exif.Longitude = -exif.Longitude
+		}
+		exif.HasLocation = hasLatitude && hasLongitude
+	}
+
+	if dateTime != "" {
+		if parsed, err := time.ParseInLocation(exifTimeLayout, dateTime, time.Local); err == nil {
+			exif.DateTime = parsed
+		}
+	}
+
+	return exif, nil
+}
+
+func findJPEGExif(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errNoExif
+	}
+
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xff {
+			return nil, errNoExif
+		}
+
+		marker := data[offset+1]
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		end := offset + 2 + length
+		if end > len(data) {
+			end = len(data)
+		}
+
+		segment := data[offset+4 : end]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+
+		offset = offset + 2 + length
+	}
+
+	return nil, errNoExif
+}
+
+func hasExif(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+func readExif(fullPath string) (*exifData, error) {
+	file, err := fsOpen(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, exifReadLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	tiff, err := findJPEGExif(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTIFF(tiff)
+}
+
+func getExif(fullPath string, fileInfo os.FileInfo) (*exifData, error) {
+	exifCacheMutex.Lock()
+	entry, present := exifCache[fullPath]
+	exifCacheMutex.Unlock()
+
+	if present && entry.mtime.Equal(fileInfo.ModTime()) && !chaosMiss(cacheExif, fullPath) {
+		return entry.data, entry.err
+	}
+
+	data, err := readExif(fullPath)
+
+	exifCacheMutex.Lock()
+	if len(exifCache) >= exifCacheLimit {
+		exifCache = make(map[string]*exifCacheEntry)
+	}
+	exifCache[fullPath] = &exifCacheEntry{mtime: fileInfo.ModTime(), data: data, err: err}
+	exifCacheMutex.Unlock()
+
+	return data, err
+}
+
+func invalidateExif(fullPath string) {
+	exifCacheMutex.Lock()
+	delete(exifCache, fullPath)
+	exifCacheMutex.Unlock()
+}
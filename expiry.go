@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const expiryFile = "/.expiry.json"
+const expiryInterval = time.Minute
+
+var errInvalidTTL = errors.New("Invalid ttl")
+
+var expiryMutex sync.Mutex
+var expiries = make(map[string]time.Time)
+
+func getExpiryPath() string {
+	return cacheDir + expiryFile
+}
+
+func initExpiry() {
+	data, err := ioutil.ReadFile(getExpiryPath())
+	if err == nil {
+		err = json.Unmarshal(data, &expiries)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal("Unable to load expiry file:", err)
+	}
+
+	go func() {
+		for {
+			expireFiles()
+			expireDrops()
+			expireShares()
+			expireUploads()
+			purgeTrash()
+			time.Sleep(expiryInterval)
+		}
+	}()
+}
+
+func saveExpiries() error {
+	data, err := json.MarshalIndent(expiries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := getExpiryPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, getExpiryPath())
+}
+
+func parseTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, errInvalidTTL
+	}
+
+	return ttl, nil
+}
+
+func getTTLFromRequest(r *http.Request) (time.Duration, error) {
+	return parseTTL(r.URL.Query().Get("ttl"))
+}
+
+func getExpiry(globalPath string) (time.Time, bool) {
+	expiryMutex.Lock()
+	defer expiryMutex.Unlock()
+
+	expires, present := expiries[globalPath]
+	return expires, present
+}
+
+func setExpiry(globalPath string, ttl time.Duration) error {
+	expiryMutex.Lock()
+	defer expiryMutex.Unlock()
+
+	if ttl == 0 {
+		if _, present := expiries[globalPath]; !present {
+			return nil
+		}
+		delete(expiries, globalPath)
+	} else {
+		expiries[globalPath] = now().Add(ttl)
+	}
+
+	return saveExpiries()
+}
+
+func clearExpiry(globalPath string) {
+	if err := setExpiry(globalPath, 0); err != nil {
+		log.Printf("Unable to clear expiry of %s: %v", globalPath, err)
+	}
+}
+
+func moveExpiry(src, dst string) {
+	expiryMutex.Lock()
+	defer expiryMutex.Unlock()
+
+	expires, present := expiries[src]
+	_, replaced := expiries[dst]
+	if !present && !replaced {
+		return
+	}
+
+	delete(expiries, src)
+	delete(expiries, dst)
+	if present {
+		expiries[dst] = expires
+	}
+
+	if err := saveExpiries(); err != nil {
+		log.Print("Unable to save expiry file: ", err)
+	}
+}
+
+func expireFiles() {
+	expiryMutex.Lock()
+	defer expiryMutex.Unlock()
+
+	current := now()
+	changed := false
+	for globalPath, expires := range expiries {
+		if current.Before(expires) || isTrashKey(globalPath) {
+			continue
+		}
+
+		fullPath := resolvePath(globalPath)
+		err := runWithTimeout("expire", fullPath, func() error {
+			return os.RemoveAll(fullPath)
+		})
+		if err != nil {
+			log.Printf("Unable to remove expired %s: %v", fullPath, err)
+			continue
+		}
+
+		log.Printf("Removed expired %s", fullPath)
+		removeThumbnails(globalPath)
+		delete(expiries, globalPath)
+		changed = true
+	}
+
+	if changed {
+		if err := saveExpiries(); err != nil {
+			log.Print("Unable to save expiry file: ", err)
+		}
+	}
+}
+
+func canonicalizeExpire(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleExpire(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeExpire(r.URL)
+
+	ttl, err := getTTLFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+	if isProtectedPath(r, path, fullPath) {
+		http.Error(w, "Refusing to modify protected path", http.StatusForbidden)
+		return
+	}
+
+	fileInfo, err := fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, path)) {
+		return
+	}
+
+	if err := setExpiry(mapPath(r, path), ttl); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newStats(r, fullPath, path, fileInfo))
+}
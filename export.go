@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const formatCSV = "csv"
+const utf8BOM = "\ufeff"
+
+var csvColumns = []string{"path", "name", "kind", "size", "modified", "type", "sha256", "md5"}
+
+func hasCSVFormat(r *http.Request) bool {
+	return r.URL.Query().Get("format") == formatCSV
+}
+
+func canonicalizeFormat(query url.Values) bool {
+	if _, present := query["format"]; !present {
+		return true
+	}
+
+	format := query.Get("format")
+	valid := format == formatCSV || format == formatNDJSON || format == formatV2
+	if valid && len(query["format"]) == 1 {
+		return true
+	}
+
+	if valid {
+		query.Set("format", format)
+	} else {
+		query.Del("format")
+	}
+
+	return false
+}
+
+func statsKind(stats *Stats) string {
+	switch {
+	case stats.Deleted:
+		return "deleted"
+	case stats.IsLink:
+		return "link"
+	case stats.IsDir:
+		return "directory"
+	case stats.Type == fileTypeFIFO, stats.Type == fileTypeSocket, stats.Type == fileTypeDevice:
+		return stats.Type
+	default:
+		return "file"
+	}
+}
+
+func flattenStats(stats []*Stats) []*Stats {
+	flat := make([]*Stats, 0, len(stats))
+	for _, entry := range stats {
+		flat = append(flat, entry)
+		flat = append(flat, flattenStats(entry.Sidecars)...)
+		flat = append(flat, flattenStats(entry.Burst)...)
+	}
+
+	return flat
+}
+
+func csvRecord(r *http.Request, stats *Stats) []string {
+	record := []string{
+		stats.Path,
+		stats.Name,
+		statsKind(stats),
+		"",
+		stats.Mtime.UTC().Format(time.RFC3339),
+		"",
+		"",
+		""}
+
+	if stats.IsDir || stats.Deleted {
+		return record
+	}
+
+	record[3] = strconv.FormatInt(stats.Size, 10)
+	record[5] = contentTypeForName(stats.Name)
+
+	if !isServable(stats.Path) {
+		return record
+	}
+
+	fullPath := resolvePath(mapPath(r, stats.Path))
+	checksums, err := fileChecksums(fullPath)
+	if err != nil {
+		log.Printf("Unable to checksum %s: %v", fullPath, err)
+		return record
+	}
+
+	record[6] = checksums[checksumSHA256]
+	record[7] = checksums[checksumMD5]
+	return record
+}
+
+func serveStatsCSV(w http.ResponseWriter, r *http.Request, dirPath string, stats []*Stats) {
+	name := filepath.Base(dirPath)
+	if name == "/" || name == "." {
+		name = "root"
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/csv; charset=utf-8")
+	header.Set("Content-Disposition", formatDisposition("attachment", name+".csv"))
+
+	if _, err := w.Write([]byte(utf8BOM)); err != nil {
+		log.Print("Unable to write CSV: ", err)
+		return
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(csvColumns)
+	for _, entry := range flattenStats(stats) {
+		if err := writer.Write(csvRecord(r, entry)); err != nil {
+			log.Print("Unable to write CSV: ", err)
+			return
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Print("Unable to write CSV: ", err)
+	}
+}
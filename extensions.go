@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iwehrman/serve/convert"
+	"path/filepath"
+)
+
+const (
+	previewerThumbnail = "thumbnail"
+	previewerFile      = "file"
+	previewerNone      = "none"
+)
+
+type ExtensionConfig struct {
+	Disposition string `json:"disposition,omitempty"`
+	Previewer   string `json:"previewer,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+func validateExtensions(extensions map[string]ExtensionConfig) error {
+	for key, extension := range extensions {
+		switch extension.Disposition {
+		case "", "inline", "attachment":
+		default:
+			return fmt.Errorf("%s: unknown disposition: %s", key, extension.Disposition)
+		}
+
+		switch extension.Previewer {
+		case "", previewerThumbnail, previewerFile, previewerArchive, previewerNone:
+		default:
+			return fmt.Errorf("%s: unknown previewer: %s", key, extension.Previewer)
+		}
+	}
+
+	return nil
+}
+
+func getExtensionConfig(name string) ExtensionConfig {
+	ext := normalizeExt(filepath.Ext(name))
+	if ext == "" {
+		return ExtensionConfig{}
+	}
+
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	for key, extension := range config.Extensions {
+		if normalizeExt(key) == ext {
+			return extension
+		}
+	}
+
+	return ExtensionConfig{}
+}
+
+func isServable(name string) bool {
+	return !getExtensionConfig(name).Disabled
+}
+
+// isServableTarget also checks the name that fullPath resolves to, so that a
+// link cannot serve a file whose own extension is disabled.
+func isServableTarget(fullPath string) bool {
+	target, err := fsEvalSymlinks(fullPath)
+	return err != nil || isServable(target)
+}
+
+func previewerForName(name string) string {
+	if previewer := getExtensionConfig(name).Previewer; previewer != "" {
+		return previewer
+	}
+
+	if convert.HasThumbnailer(name) {
+		return previewerThumbnail
+	}
+
+	if getArchiveSuffix(name) != "" {
+		return previewerArchive
+	}
+
+	return ""
+}
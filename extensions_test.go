@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func disableExtension(t *testing.T, ext string) {
+	t.Helper()
+
+	configMutex.Lock()
+	previous := config.Extensions
+	config.Extensions = map[string]ExtensionConfig{ext: {Disabled: true}}
+	configMutex.Unlock()
+
+	t.Cleanup(func() {
+		configMutex.Lock()
+		config.Extensions = previous
+		configMutex.Unlock()
+	})
+}
+
+func TestDisabledExtensionIsNotServed(t *testing.T) {
+	server := newTestServer(t)
+	disableExtension(t, ".txt")
+
+	if err := ioutil.WriteFile(filepath.Join(root, "passwords.txt"), []byte("password=hunter2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.Get(testURL(server, "/read", "/passwords.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /read: %s, want 403", response.Status)
+	}
+
+	query := url.Values{}
+	query.Set("path", "/")
+	query.Set("q", "password")
+	response, err = http.Get(server.URL + "/grep?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var result grepResult
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 0 {
+		t.Errorf("GET /grep: %d matches in a disabled file, want none", len(result.Matches))
+	}
+}
+
+func TestDisabledExtensionIsNotCopied(t *testing.T) {
+	server := newTestServer(t)
+	disableExtension(t, ".key")
+	enableFeature(t, featureWrite)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "server.key"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, endpoint := range []string{"/copy", "/move"} {
+		query := url.Values{}
+		query.Set("path", "/server.key")
+		query.Set("target", "/server.txt")
+		response, err := http.Post(server.URL+endpoint+"?"+query.Encode(), "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusForbidden {
+			t.Errorf("POST %s: %s, want 403", endpoint, response.Status)
+		}
+	}
+}
+
+func TestDisabledExtensionIsNotServedThroughLink(t *testing.T) {
+	server := newTestServer(t)
+	disableExtension(t, ".key")
+	enableFeature(t, featureWrite)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "server.key"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	query := url.Values{}
+	query.Set("path", "/a.txt")
+	query.Set("target", "/server.key")
+	response, err := http.Post(server.URL+"/link?"+query.Encode(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("POST /link: %s, want 403", response.Status)
+	}
+
+	if err := os.Symlink("server.key", filepath.Join(root, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err = http.Get(testURL(server, "/read", "/b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /read through a symlink: %s, want 403", response.Status)
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	collisionFail      = "fail"
+	collisionSkip      = "skip"
+	collisionOverwrite = "overwrite"
+	collisionRename    = "rename"
+)
+
+var archiveSuffixes = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+var errEntryTooLarge = errors.New("archive entry is larger than its header")
+var errArchiveTooLarge = errors.New("archive expands beyond the maximum upload size")
+
+type archiveEntry struct {
+	name  string
+	isDir bool
+	size  int64
+	mtime time.Time
+	open  func() (io.ReadCloser, error)
+}
+
+type archiveWalker func(fn func(entry *archiveEntry) error) error
+
+func getArchiveSuffix(name string) string {
+	lower := strings.ToLower(name)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return suffix
+		}
+	}
+
+	return ""
+}
+
+func getCollisionPolicy(r *http.Request) string {
+	return r.URL.Query().Get("collision")
+}
+
+func canonicalizeCollision(query url.Values) bool {
+	switch query.Get("collision") {
+	case collisionSkip, collisionOverwrite, collisionRename:
+		return len(query["collision"]) == 1
+	}
+
+	if _, present := query["collision"]; !present {
+		return true
+	}
+
+	query.Del("collision")
+	return false
+}
+
+func canonicalizeExtract(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	if _, present := query["target"]; present {
+		canon = canonicalizePathParam(query, "target") && canon
+	}
+	canon = canonicalizeCollision(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func walkZip(fullPath string) archiveWalker {
+	return func(fn func(entry *archiveEntry) error) error {
+		archive, err := zip.OpenReader(fullPath)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+
+		for _, file := range archive.File {
+			mode := file.Mode()
+			if !mode.IsDir() && !mode.IsRegular() {
+				continue
+			}
+
+			entry := &archiveEntry{
+				name:  file.Name,
+				isDir: mode.IsDir(),
+				size:  int64(file.UncompressedSize64),
+				mtime: file.Modified,
+				open:  file.Open}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func walkTar(fullPath string, compressed bool) archiveWalker {
+	return func(fn func(entry *archiveEntry) error) error {
+		file, err := fsOpen(fullPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		var reader io.Reader = file
+		if compressed {
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			reader = gz
+		}
+
+		archive := tar.NewReader(reader)
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if header.Typeflag != tar.TypeDir && header.Typeflag != tar.TypeReg {
+				continue
+			}
+
+			entry := &archiveEntry{
+				name:  header.Name,
+				isDir: header.Typeflag == tar.TypeDir,
+				size:  header.Size,
+				mtime: header.ModTime,
+				open: func() (io.ReadCloser, error) {
+					return io.NopCloser(archive), nil
+				}}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func getArchiveWalker(fullPath string) (archiveWalker, error) {
+	switch getArchiveSuffix(fullPath) {
+	case ".zip":
+		return walkZip(fullPath), nil
+	case ".tar":
+		return walkTar(fullPath, false), nil
+	case ".tar.gz", ".tgz":
+		return walkTar(fullPath, true), nil
+	}
+
+	return nil, errors.New("unsupported archive type")
+}
+
+func getEntryPath(targetPath, name string) (string, error) {
+	name = filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if name == "" || filepath.IsAbs(name) || strings.HasPrefix(name, string(filepath.Separator)) {
+		return "", fmt.Errorf("unsafe entry path: %s", name)
+	}
+
+	for _, part := range strings.Split(name, string(filepath.Separator)) {
+		if part == ".." {
+			return "", fmt.Errorf("unsafe entry path: %s", name)
+		}
+	}
+
+	entryPath := filepath.Join(targetPath, name)
+	if !isWithin(entryPath, targetPath) || isCachePath(entryPath) || isStagingName(filepath.Base(entryPath)) {
+		return "", fmt.Errorf("unsafe entry path: %s", name)
+	}
+
+	return entryPath, nil
+}
+
+// checkEntryParents refuses entries below a symlink inside the target, which
+// would otherwise let an archive write outside of it.
+func checkEntryParents(targetPath, entryPath, name string) error {
+	rel, err := filepath.Rel(targetPath, filepath.Dir(entryPath))
+	if err != nil || rel == "." {
+		return err
+	}
+
+	dir := targetPath
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		fileInfo, err := fsLstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("unsafe entry path: %s", name)
+		}
+	}
+
+	return nil
+}
+
+func scanArchive(walk archiveWalker, targetPath, collision string) (int64, error) {
+	var total int64
+	err := walk(func(entry *archiveEntry) error {
+		entryPath, err := getEntryPath(targetPath, entry.name)
+		if err != nil {
+			return err
+		}
+
+		total += entry.size
+		if total > getMaxUploadSize() {
+			return errArchiveTooLarge
+		}
+
+		if entry.isDir || collision != collisionFail {
+			return nil
+		}
+
+		if _, err := fsLstat(entryPath); err == nil {
+			return fmt.Errorf("file already exists: %s", entry.name)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	})
+
+	return total, err
+}
+
+func extractEntry(ctx context.Context, j *job, entry *archiveEntry, targetPath, collision string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entryPath, err := getEntryPath(targetPath, entry.name)
+	if err != nil {
+		return err
+	}
+
+	if err := checkEntryParents(targetPath, entryPath, entry.name); err != nil {
+		return err
+	}
+
+	if entry.isDir {
+		return runWithTimeout("mkdir", entryPath, func() error {
+			return os.MkdirAll(entryPath, 0755)
+		})
+	}
+
+	existing, err := fsLstat(entryPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if existing != nil {
+		switch {
+		case existing.IsDir():
+			return fmt.Errorf("directory already exists: %s", entry.name)
+		case collision == collisionSkip:
+			j.addProgress(entry.size)
+			return nil
+		case collision == collisionRename:
+			dir := filepath.Dir(entryPath)
+			name, err := freeName(dir, filepath.Base(entryPath))
+			if err != nil {
+				return err
+			}
+			entryPath = filepath.Join(dir, name)
+		case collision != collisionOverwrite:
+			return fmt.Errorf("file already exists: %s", entry.name)
+		}
+	}
+
+	reader, err := entry.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	body := &progressReader{
+		Reader: &limitedReader{Reader: reader, remaining: entry.size, err: errEntryTooLarge},
+		job:    j}
+
+	if _, err := writeFile(entryPath, body, collision == collisionOverwrite, nil); err != nil {
+		return err
+	}
+
+	if !entry.mtime.IsZero() {
+		return os.Chtimes(entryPath, entry.mtime, entry.mtime)
+	}
+
+	return nil
+}
+
+func handleExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeExtract(r.URL)
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	suffix := getArchiveSuffix(path)
+	if suffix == "" {
+		http.Error(w, "Unsupported archive type: "+path, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !fileInfo.Mode().IsRegular() {
+		http.Error(w, "Not a file: "+path, http.StatusBadRequest)
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		target = path[:len(path)-len(suffix)]
+	}
+	targetPath := resolvePath(mapPath(r, target))
+
+	if isCachePath(targetPath) {
+		http.Error(w, "Refusing to modify protected path", http.StatusForbidden)
+		return
+	}
+
+	if targetInfo, err := fsStat(targetPath); err == nil && !targetInfo.IsDir() {
+		http.Error(w, "Target is not a directory: "+target, http.StatusConflict)
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, target)) {
+		return
+	}
+
+	collision := getCollisionPolicy(r)
+	if collision == "" {
+		collision = collisionFail
+	}
+
+	walk, err := getArchiveWalker(fullPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	j, err := startJob(r, "extract", target, func(ctx context.Context, j *job) (*Stats, error) {
+		total, err := scanArchive(walk, targetPath, collision)
+		if err != nil {
+			return nil, err
+		}
+		j.setTotal(total)
+
+		err = runWithTimeout("mkdir", targetPath, func() error {
+			return os.MkdirAll(targetPath, 0755)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = walk(func(entry *archiveEntry) error {
+			return extractEntry(ctx, j, entry, targetPath, collision)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		targetInfo, err := fsLstat(targetPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return newStats(r, targetPath, target, targetInfo), nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	serveJobStarted(w, j)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"sort"
+)
+
+const featureWrite = "write"
+const featureTranscode = "transcode"
+const featureWebDAV = "webdav"
+
+var featureDefaults = map[string]bool{
+	featureWrite:     false,
+	featureTranscode: false,
+	featureWebDAV:    false,
+}
+
+type FeatureFlag struct {
+	Enabled bool     `json:"enabled"`
+	Users   []string `json:"users,omitempty"`
+	Percent int      `json:"percent,omitempty"`
+}
+
+type capabilitiesResponse struct {
+	Features  map[string]bool `json:"features"`
+	Encodings []string        `json:"encodings"`
+}
+
+type featureRequest struct {
+	Name string `json:"name"`
+	FeatureFlag
+}
+
+func (f *FeatureFlag) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*f = FeatureFlag{Enabled: enabled}
+		return nil
+	}
+
+	type featureFlag FeatureFlag
+	return json.Unmarshal(data, (*featureFlag)(f))
+}
+
+func rolloutBucket(feature, name string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(feature + ":" + name))
+	return int(hash.Sum32() % 100)
+}
+
+func featureEnabled(r *http.Request, name string) bool {
+	configMutex.RLock()
+	flag, present := config.Features[name]
+	configMutex.RUnlock()
+
+	if !present {
+		return featureDefaults[name]
+	}
+
+	if flag.Enabled {
+		return true
+	}
+
+	user := getUserFromRequest(r)
+	if user == nil {
+		return false
+	}
+
+	for _, allowed := range flag.Users {
+		if allowed == user.Name {
+			return true
+		}
+	}
+
+	return flag.Percent > 0 && rolloutBucket(name, user.Name) < flag.Percent
+}
+
+func requireFeature(w http.ResponseWriter, r *http.Request, name string) bool {
+	if !featureEnabled(r, name) {
+		http.Error(w, "Feature disabled: "+name, http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+func featureNames() []string {
+	names := make(map[string]bool)
+	for name := range featureDefaults {
+		names[name] = true
+	}
+
+	configMutex.RLock()
+	for name := range config.Features {
+		names[name] = true
+	}
+	configMutex.RUnlock()
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+func handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	response := &capabilitiesResponse{
+		Features:  make(map[string]bool),
+		Encodings: encodingPreference}
+
+	for _, name := range featureNames() {
+		response.Features[name] = featureEnabled(r, name)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func handleAdminFeatures(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		flags := make(map[string]FeatureFlag)
+		for _, name := range featureNames() {
+			configMutex.RLock()
+			flag, present := config.Features[name]
+			configMutex.RUnlock()
+
+			if !present {
+				flag = FeatureFlag{Enabled: featureDefaults[name]}
+			}
+			flags[name] = flag
+		}
+
+		writeJSON(w, http.StatusOK, flags)
+	case "POST":
+		if !requireJSON(w, r) {
+			return
+		}
+
+		var request featureRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if request.Name == "" || request.Percent < 0 || request.Percent > 100 {
+			http.Error(w, "Invalid feature flag", http.StatusBadRequest)
+			return
+		}
+
+		configMutex.Lock()
+		if config.Features == nil {
+			config.Features = make(map[string]FeatureFlag)
+		}
+		config.Features[request.Name] = request.FeatureFlag
+		configMutex.Unlock()
+
+		if err := saveConfig(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, request.FeatureFlag)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
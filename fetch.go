@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const fetchMaxRedirects = 10
+
+var errFetchTooLarge = errors.New("remote file exceeds maximum size")
+
+type FetchConfig struct {
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+	MaxSize      int64    `json:"maxSize,omitempty"`
+}
+
+type limitedReader struct {
+	io.Reader
+	remaining int64
+	err       error
+}
+
+func (l *limitedReader) Read(buf []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.err
+	}
+
+	if int64(len(buf)) > l.remaining+1 {
+		buf = buf[:l.remaining+1]
+	}
+
+	count, err := l.Reader.Read(buf)
+	l.remaining -= int64(count)
+	if l.remaining < 0 {
+		return count, l.err
+	}
+
+	return count, err
+}
+
+func getFetchConfig() FetchConfig {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	fetch := config.Fetch
+	if fetch.MaxSize == 0 {
+		fetch.MaxSize = config.MaxUploadSize
+	}
+	if fetch.MaxSize == 0 {
+		fetch.MaxSize = defaultMaxUploadSize
+	}
+
+	return fetch
+}
+
+func isAllowedFetchURL(remote *url.URL, allowedHosts []string) bool {
+	if remote.Scheme != "http" && remote.Scheme != "https" {
+		return false
+	}
+
+	host := strings.ToLower(remote.Hostname())
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func canonicalizeFetch(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeOverwrite(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func fetchToFile(ctx context.Context, j *job, remote *url.URL, fullPath string, overwrite bool, fetch FetchConfig) error {
+	client := &http.Client{
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= fetchMaxRedirects {
+				return errors.New("too many redirects")
+			}
+			if !isAllowedFetchURL(request.URL, fetch.AllowedHosts) {
+				return errors.New("redirect to disallowed host: " + request.URL.Host)
+			}
+			return nil
+		}}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", remote.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("remote returned %s", response.Status)
+	}
+
+	if response.ContentLength > fetch.MaxSize {
+		return errFetchTooLarge
+	}
+	if response.ContentLength > 0 {
+		j.setTotal(response.ContentLength)
+	}
+
+	body := &progressReader{
+		Reader: &limitedReader{Reader: response.Body, remaining: fetch.MaxSize, err: errFetchTooLarge},
+		job:    j}
+
+	_, err = writeFile(fullPath, body, overwrite, nil)
+	return err
+}
+
+func handleFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeFetch(r.URL)
+
+	fetch := getFetchConfig()
+	if len(fetch.AllowedHosts) == 0 {
+		http.Error(w, "Remote fetch is disabled", http.StatusForbidden)
+		return
+	}
+
+	remote, err := url.Parse(r.URL.Query().Get("url"))
+	if err != nil || remote.Host == "" {
+		http.Error(w, "Invalid url", http.StatusBadRequest)
+		return
+	}
+
+	if !isAllowedFetchURL(remote, fetch.AllowedHosts) {
+		http.Error(w, "Host is not allowed: "+remote.Host, http.StatusForbidden)
+		return
+	}
+
+	path, fullPath, fileInfo, ok := getWriteTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	overwrite := hasOverwrite(r)
+	if fileInfo != nil && !overwrite {
+		http.Error(w, "File already exists: "+path, http.StatusConflict)
+		return
+	}
+
+	j, err := startJob(r, "fetch", path, func(ctx context.Context, j *job) (*Stats, error) {
+		if err := fetchToFile(ctx, j, remote, fullPath, overwrite, fetch); err != nil {
+			return nil, err
+		}
+
+		fileInfo, err := fsLstat(fullPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return newStats(r, fullPath, path, fileInfo), nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	serveJobStarted(w, j)
+}
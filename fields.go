@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+func getFields(r *http.Request) []string {
+	fields := r.URL.Query().Get("fields")
+	if fields == "" {
+		return nil
+	}
+
+	return strings.Split(fields, ",")
+}
+
+func canonicalizeFields(query url.Values) bool {
+	if _, present := query["fields"]; !present {
+		return true
+	}
+
+	seen := make(map[string]bool)
+	var fields []string
+	for _, value := range query["fields"] {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field != "" && !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+
+	value := strings.Join(fields, ",")
+	if len(query["fields"]) == 1 && query.Get("fields") == value {
+		return true
+	}
+
+	if value == "" {
+		query.Del("fields")
+	} else {
+		query.Set("fields", value)
+	}
+
+	return false
+}
+
+func wantsField(r *http.Request, name string) bool {
+	fields := getFields(r)
+	if fields == nil {
+		return true
+	}
+
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func selectStatsFields(r *http.Request, stats *Stats, fields []string) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &all); err != nil {
+		return nil, err
+	}
+
+	if format := getTimeFormat(r); format != "" {
+		if err := formatStatsTimes(all, format); err != nil {
+			return nil, err
+		}
+	}
+
+	if fields == nil {
+		return all, nil
+	}
+
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, present := all[field]; present {
+			selected[field] = value
+		}
+	}
+
+	return selected, nil
+}
+
+func marshalSelectedStats(r *http.Request, stats *Stats, fields []string) ([]byte, error) {
+	if fields == nil && getTimeFormat(r) == "" {
+		return json.Marshal(stats)
+	}
+
+	selected, err := selectStatsFields(r, stats, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(selected)
+}
+
+func marshalStats(r *http.Request, stats *Stats) ([]byte, error) {
+	return marshalSelectedStats(r, stats, getFields(r))
+}
+
+func marshalStatsList(r *http.Request, stats []*Stats) ([]byte, error) {
+	fields := getFields(r)
+	if fields == nil && getTimeFormat(r) == "" {
+		return json.Marshal(stats)
+	}
+
+	list := make([]map[string]json.RawMessage, 0, len(stats))
+	for _, stat := range stats {
+		selected, err := selectStatsFields(r, stat, fields)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, selected)
+	}
+
+	return json.Marshal(list)
+}
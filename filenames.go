@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+type FilenameConfig struct {
+	Transliterate bool              `json:"transliterate,omitempty"`
+	Windows       bool              `json:"windows,omitempty"`
+	Replace       map[string]string `json:"replace,omitempty"`
+}
+
+var transliterations = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u",
+
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o", 'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'è': "e", 'é': "e",
+	'ê': "e", 'ë': "e", 'ē': "e", 'ę': "e", 'ě': "e", 'ğ': "g", 'ì': "i", 'í': "i",
+	'î': "i", 'ï': "i", 'ī': "i", 'ı': "i", 'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'œ': "oe", 'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ý': "y",
+	'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z", 'þ': "th", 'ð': "d",
+}
+
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+func getFilenameConfig() FilenameConfig {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return config.Filenames
+}
+
+func transliterate(r rune) (string, bool) {
+	if latin, present := transliterations[r]; present {
+		return latin, true
+	}
+
+	lower := unicode.ToLower(r)
+	latin, present := transliterations[lower]
+	if !present || lower == r {
+		return "", false
+	}
+
+	if latin == "" {
+		return "", true
+	}
+
+	return strings.ToUpper(latin[:1]) + latin[1:], true
+}
+
+func isWindowsIllegal(r rune) bool {
+	return r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r)
+}
+
+func sanitizeWindowsName(name string) string {
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+
+	base := name
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if windowsReservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// sanitizeFilename applies the configured replacements, transliteration and
+// Windows rules to a single name offered for download.
+func sanitizeFilename(name string) string {
+	c := getFilenameConfig()
+	if !c.Transliterate && !c.Windows && len(c.Replace) == 0 {
+		return name
+	}
+
+	var builder strings.Builder
+	for _, r := range name {
+		if replacement, present := c.Replace[string(r)]; present {
+			builder.WriteString(replacement)
+			continue
+		}
+
+		if c.Transliterate {
+			if latin, ok := transliterate(r); ok {
+				builder.WriteString(latin)
+				continue
+			}
+		}
+
+		if c.Windows && isWindowsIllegal(r) {
+			builder.WriteByte('_')
+			continue
+		}
+
+		builder.WriteRune(r)
+	}
+
+	sanitized := builder.String()
+	if c.Windows {
+		sanitized = sanitizeWindowsName(sanitized)
+	}
+
+	return sanitized
+}
+
+func sanitizeArchiveName(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = sanitizeFilename(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
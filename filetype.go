@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+)
+
+const (
+	fileTypeFile    = "file"
+	fileTypeDir     = "dir"
+	fileTypeSymlink = "symlink"
+	fileTypeFIFO    = "fifo"
+	fileTypeSocket  = "socket"
+	fileTypeDevice  = "device"
+	fileTypeOther   = "other"
+)
+
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return fileTypeFile
+	case mode.IsDir():
+		return fileTypeDir
+	case mode&os.ModeSymlink != 0:
+		return fileTypeSymlink
+	case mode&os.ModeNamedPipe != 0:
+		return fileTypeFIFO
+	case mode&os.ModeSocket != 0:
+		return fileTypeSocket
+	case mode&os.ModeDevice != 0:
+		return fileTypeDevice
+	default:
+		return fileTypeOther
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const filterTypeFile = "file"
+const filterTypeDir = "dir"
+
+type statsFilter struct {
+	pattern string
+	kind    string
+}
+
+func getStatsFilter(r *http.Request) *statsFilter {
+	query := r.URL.Query()
+	filter := &statsFilter{
+		pattern: strings.ToLower(query.Get("filter")),
+		kind:    query.Get("type")}
+	if filter.pattern == "" && filter.kind == "" {
+		return nil
+	}
+
+	return filter
+}
+
+func canonicalizeFilter(query url.Values) bool {
+	canon := true
+
+	if _, present := query["filter"]; present {
+		if query.Get("filter") == "" {
+			query.Del("filter")
+			canon = false
+		} else if len(query["filter"]) > 1 {
+			query.Set("filter", query.Get("filter"))
+			canon = false
+		}
+	}
+
+	if _, present := query["type"]; present {
+		kind := query.Get("type")
+		if kind != filterTypeFile && kind != filterTypeDir {
+			query.Del("type")
+			canon = false
+		} else if len(query["type"]) > 1 {
+			query.Set("type", kind)
+			canon = false
+		}
+	}
+
+	return canon
+}
+
+func (filter *statsFilter) validate() error {
+	_, err := filepath.Match(filter.pattern, "")
+	return err
+}
+
+func (filter *statsFilter) matches(stats *Stats) bool {
+	switch filter.kind {
+	case filterTypeFile:
+		if stats.IsDir {
+			return false
+		}
+	case filterTypeDir:
+		if !stats.IsDir {
+			return false
+		}
+	}
+
+	if filter.pattern == "" {
+		return true
+	}
+
+	matched, _ := filepath.Match(filter.pattern, strings.ToLower(stats.Name))
+	return matched
+}
+
+func filterStats(filter *statsFilter, stats []*Stats) []*Stats {
+	if filter == nil {
+		return stats
+	}
+
+	filtered := make([]*Stats, 0, len(stats))
+	for _, stat := range stats {
+		if filter.matches(stat) {
+			filtered = append(filtered, stat)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	tiffTypeASCII    = 2
+	tiffTypeShort    = 3
+	tiffTypeLong     = 4
+	tiffTypeRational = 5
+)
+
+var fixtureCameras = [][2]string{
+	{"Canon", "Canon EOS R5"},
+	{"NIKON CORPORATION", "NIKON Z 6"},
+	{"Apple", "iPhone 14 Pro"},
+	{"FUJIFILM", "X-T4"},
+}
+
+var fixtureLocations = [][2]float64{
+	{37.7749, -122.4194},
+	{35.6762, 139.6503},
+	{48.8566, 2.3522},
+	{-33.8688, 151.2093},
+}
+
+var fixtureEpoch = time.Date(2020, time.January, 1, 9, 0, 0, 0, time.UTC)
+
+type fixtureOptions struct {
+	depth  int
+	dirs   int
+	files  int
+	images int
+	size   int
+	rand   *rand.Rand
+	count  int
+}
+
+type tiffEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value []byte
+}
+
+func runGenFixtures(args []string) {
+	flags := flag.NewFlagSet("gen-fixtures", flag.ExitOnError)
+	depth := flags.Int("depth", 2, "levels of subdirectories")
+	dirs := flags.Int("dirs", 3, "subdirectories per directory")
+	files := flags.Int("files", 10, "plain files per directory")
+	images := flags.Int("images", 5, "JPEG images per directory")
+	size := flags.Int("size", 640, "image width in pixels")
+	seed := flags.Int64("seed", 1, "random seed")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *depth < 0 || *dirs < 0 || *files < 0 || *images < 0 || *size < 1 {
+		log.Fatal("Usage: serve gen-fixtures [-depth n] [-dirs n] [-files n] [-images n] [-size px] [-seed n] dir")
+	}
+
+	options := &fixtureOptions{
+		depth:  *depth,
+		dirs:   *dirs,
+		files:  *files,
+		images: *images,
+		size:   *size,
+		rand:   rand.New(rand.NewSource(*seed))}
+
+	if err := genFixtures(flags.Arg(0), options, 0); err != nil {
+		log.Fatal("Unable to generate fixtures:", err)
+	}
+
+	log.Printf("Generated %d entries in %s", options.count, flags.Arg(0))
+}
+
+func genFixtures(dir string, options *fixtureOptions, level int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for i := 0; i < options.files; i++ {
+		data := make([]byte, 1024+options.rand.Intn(63*1024))
+		options.rand.Read(data)
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file_%04d.bin", i)), data, 0644); err != nil {
+			return err
+		}
+		options.count++
+	}
+
+	for i := 0; i < options.images; i++ {
+		taken := fixtureEpoch.Add(time.Duration(options.count) * time.Hour)
+		camera := fixtureCameras[options.count%len(fixtureCameras)]
+		location := fixtureLocations[options.count%len(fixtureLocations)]
+		location[0] += options.rand.Float64()/10 - 0.05
+		location[1] += options.rand.Float64()/10 - 0.05
+		data, err := makeFixtureJPEG(options.size, options.size*3/4, options.rand, camera[0], camera[1], taken, location)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("IMG_%04d.jpg", i))
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		if err := os.Chtimes(path, taken, taken); err != nil {
+			return err
+		}
+		options.count++
+	}
+
+	if level >= options.depth {
+		return nil
+	}
+
+	for i := 0; i < options.dirs; i++ {
+		if err := genFixtures(filepath.Join(dir, fmt.Sprintf("dir_%02d", i)), options, level+1); err != nil {
+			return err
+		}
+		options.count++
+	}
+
+	return nil
+}
+
+func makeFixtureJPEG(width, height int, random *rand.Rand, cameraMake, model string, taken time.Time, location [2]float64) ([]byte, error) {
+	if height < 1 {
+		height = 1
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	base := [3]int{random.Intn(256), random.Intn(256), random.Intn(256)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			offset := img.PixOffset(x, y)
+			img.Pix[offset] = uint8(base[0] + x*255/width)
+			img.Pix[offset+1] = uint8(base[1] + y*255/height)
+			img.Pix[offset+2] = uint8(base[2] + (x+y)*127/(width+height))
+			img.Pix[offset+3] = 255
+		}
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+
+	exif := append([]byte("Exif\x00\x00"), makeFixtureTIFF(cameraMake, model, taken, location)...)
+	app1 := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(exif)+2))
+
+	data := encoded.Bytes()
+	jpegWithExif := make([]byte, 0, len(data)+len(app1)+len(exif))
+	jpegWithExif = append(jpegWithExif, data[:2]...)
+	jpegWithExif = append(jpegWithExif, app1...)
+	jpegWithExif = append(jpegWithExif, exif...)
+	jpegWithExif = append(jpegWithExif, data[2:]...)
+
+	return jpegWithExif, nil
+}
+
+func tiffASCII(tag uint16, value string) *tiffEntry {
+	data := append([]byte(value), 0)
+	return &tiffEntry{tag: tag, kind: tiffTypeASCII, count: uint32(len(data)), value: data}
+}
+
+func tiffCoordinate(order binary.ByteOrder, value float64) *tiffEntry {
+	value = math.Abs(value)
+	degrees := math.Floor(value)
+	minutes := math.Floor((value - degrees) * 60)
+	seconds := (value - degrees - minutes/60) * 3600
+
+	data := make([]byte, 24)
+	for i, part := range [][2]uint32{{uint32(degrees), 1}, {uint32(minutes), 1}, {uint32(seconds * 10000), 10000}} {
+		order.PutUint32(data[i*8:], part[0])
+		order.PutUint32(data[i*8+4:], part[1])
+	}
+
+	return &tiffEntry{kind: tiffTypeRational, count: 3, value: data}
+}
+
+func makeFixtureTIFF(cameraMake, model string, taken time.Time, location [2]float64) []byte {
+	order := binary.LittleEndian
+	dateTime := taken.Format(exifTimeLayout)
+
+	orientation := make([]byte, 2)
+	order.PutUint16(orientation, 1)
+	exifPointer := &tiffEntry{tag: exifTagExifIFD, kind: tiffTypeLong, count: 1, value: make([]byte, 4)}
+	gpsPointer := &tiffEntry{tag: exifTagGPSIFD, kind: tiffTypeLong, count: 1, value: make([]byte, 4)}
+
+	latitudeRef, longitudeRef := "N", "E"
+	if location[0] < 0 {
+		latitudeRef = "S"
+	}
+	if location[1] < 0 {
+		longitudeRef = "W"
+	}
+	latitude := tiffCoordinate(order, location[0])
+	latitude.tag = gpsTagLatitude
+	longitude := tiffCoordinate(order, location[1])
+	longitude.tag = gpsTagLongitude
+
+	ifds := [][]*tiffEntry{
+		{
+			tiffASCII(exifTagMake, cameraMake),
+			tiffASCII(exifTagModel, model),
+			{tag: exifTagOrientation, kind: tiffTypeShort, count: 1, value: orientation},
+			tiffASCII(exifTagDateTime, dateTime),
+			exifPointer,
+			gpsPointer,
+		},
+		{
+			tiffASCII(exifTagDateTimeOriginal, dateTime),
+		},
+		{
+			tiffASCII(gpsTagLatitudeRef, latitudeRef),
+			latitude,
+			tiffASCII(gpsTagLongitudeRef, longitudeRef),
+			longitude,
+		},
+	}
+
+	offsets := make([]int, len(ifds))
+	dataOffset := 8
+	for i, entries := range ifds {
+		offsets[i] = dataOffset
+		dataOffset += 2 + len(entries)*12 + 4
+	}
+	order.PutUint32(exifPointer.value, uint32(offsets[1]))
+	order.PutUint32(gpsPointer.value, uint32(offsets[2]))
+
+	var out, extra bytes.Buffer
+	out.WriteString("II")
+	binary.Write(&out, order, uint16(42))
+	binary.Write(&out, order, uint32(offsets[0]))
+
+	for _, entries := range ifds {
+		binary.Write(&out, order, uint16(len(entries)))
+		for _, entry := range entries {
+			binary.Write(&out, order, entry.tag)
+			binary.Write(&out, order, entry.kind)
+			binary.Write(&out, order, entry.count)
+
+			if len(entry.value) <= 4 {
+				value := make([]byte, 4)
+				copy(value, entry.value)
+				out.Write(value)
+				continue
+			}
+
+			binary.Write(&out, order, uint32(dataOffset+extra.Len()))
+			extra.Write(entry.value)
+			if extra.Len()%2 == 1 {
+				extra.WriteByte(0)
+			}
+		}
+		binary.Write(&out, order, uint32(0))
+	}
+
+	out.Write(extra.Bytes())
+	return out.Bytes()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultFSTimeout = 30 * time.Second
+
+var errFSTimeout = errors.New("filesystem operation timed out")
+
+var fsTimeout = defaultFSTimeout
+
+type timeoutFile struct {
+	file *os.File
+}
+
+func runWithTimeout(op, path string, fn func() error) error {
+	if fsTimeout <= 0 {
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(fsTimeout):
+		log.Printf("Timed out after %v: %s %s", fsTimeout, op, path)
+		return &os.PathError{Op: op, Path: path, Err: errFSTimeout}
+	}
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, errFSTimeout)
+}
+
+func fsStat(path string) (os.FileInfo, error) {
+	var fileInfo os.FileInfo
+	err := runWithTimeout("stat", path, func() error {
+		var err error
+		fileInfo, err = os.Stat(path)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fileInfo, nil
+}
+
+func fsLstat(path string) (os.FileInfo, error) {
+	var fileInfo os.FileInfo
+	err := runWithTimeout("lstat", path, func() error {
+		var err error
+		fileInfo, err = os.Lstat(path)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fileInfo, nil
+}
+
+func fsEvalSymlinks(path string) (string, error) {
+	var realPath string
+	err := runWithTimeout("evalsymlinks", path, func() error {
+		var err error
+		realPath, err = filepath.EvalSymlinks(path)
+		return err
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return realPath, nil
+}
+
+func fsReadDir(path string) ([]os.FileInfo, error) {
+	var infos []os.FileInfo
+	err := runWithTimeout("readdir", path, func() error {
+		var err error
+		infos, err = ioutil.ReadDir(path)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
+
+// fsReadDirNames reads at most limit names from the directory at path
+// without stat-ing them.
+func fsReadDirNames(path string, limit int) ([]string, error) {
+	var names []string
+	err := runWithTimeout("readdir", path, func() error {
+		dir, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+
+		for len(names) < limit {
+			batch, err := dir.Readdirnames(256)
+			names = append(names, batch...)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) > limit {
+		names = names[:limit]
+	}
+
+	return names, nil
+}
+
+// fsOpen bounds only the open itself; reads go straight to the file. A file
+// that opens after the timeout has fired is closed rather than leaked.
+func fsOpen(path string) (*timeoutFile, error) {
+	if fsTimeout <= 0 {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &timeoutFile{file: file}, nil
+	}
+
+	type openResult struct {
+		file *os.File
+		err  error
+	}
+
+	done := make(chan openResult)
+	timedOut := make(chan struct{})
+	go func() {
+		file, err := os.Open(path)
+		select {
+		case done <- openResult{file, err}:
+		case <-timedOut:
+			if file != nil {
+				file.Close()
+			}
+		}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return &timeoutFile{file: result.file}, nil
+	case <-time.After(fsTimeout):
+		close(timedOut)
+		log.Printf("Timed out after %v: open %s", fsTimeout, path)
+		return nil, &os.PathError{Op: "open", Path: path, Err: errFSTimeout}
+	}
+}
+
+func (f *timeoutFile) Read(p []byte) (int, error) {
+	return f.file.Read(p)
+}
+
+func (f *timeoutFile) Stat() (os.FileInfo, error) {
+	var fileInfo os.FileInfo
+	err := runWithTimeout("stat", f.file.Name(), func() error {
+		var err error
+		fileInfo, err = f.file.Stat()
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fileInfo, nil
+}
+
+func (f *timeoutFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *timeoutFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type GitConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+type gitInfo struct {
+	Branch string `json:"branch,omitempty"`
+	Commit string `json:"commit"`
+}
+
+var gitRefPattern = regexp.MustCompile(`^[A-Za-z0-9._/~^@{}][A-Za-z0-9._/~^@{}-]*$`)
+
+var errInvalidRef = errors.New("Invalid ref")
+
+func gitEnabled() bool {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return config.Git.Enabled
+}
+
+func hasGitignore(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["gitignore"]
+	return present && gitEnabled()
+}
+
+func canonicalizeGitignore(query url.Values) bool {
+	return canonicalizeBoolean(query, "gitignore")
+}
+
+func getRef(r *http.Request) string {
+	return r.URL.Query().Get("ref")
+}
+
+func canonicalizeRef(query url.Values) bool {
+	if _, present := query["ref"]; !present {
+		return true
+	}
+
+	ref := query.Get("ref")
+	if ref != "" && len(query["ref"]) == 1 {
+		return true
+	}
+
+	if ref == "" {
+		query.Del("ref")
+	} else {
+		query.Set("ref", ref)
+	}
+
+	return false
+}
+
+func runGit(r *http.Request, dir string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(r.Context(), "git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdin = stdin
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		log.Printf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	return output, err
+}
+
+func getGitInfo(r *http.Request, fullPath string) *gitInfo {
+	if _, err := fsLstat(filepath.Join(fullPath, ".git")); err != nil {
+		return nil
+	}
+
+	commit, err := runGit(r, fullPath, nil, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		return nil
+	}
+
+	info := &gitInfo{Commit: strings.TrimSpace(string(commit))}
+	if branch, err := runGit(r, fullPath, nil, "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		info.Branch = strings.TrimSpace(string(branch))
+	}
+
+	return info
+}
+
+// filterGitignored drops the entries of the directory at fullPath that git
+// would ignore. Directories outside a repository are left unfiltered.
+func filterGitignored(r *http.Request, fullPath string, stats []*Stats) []*Stats {
+	var names bytes.Buffer
+	for _, stat := range stats {
+		names.WriteString(stat.Name)
+		names.WriteByte(0)
+	}
+
+	output, err := runGit(r, fullPath, &names, "check-ignore", "-z", "--stdin")
+	if err != nil {
+		return stats
+	}
+
+	ignored := make(map[string]bool)
+	for _, name := range strings.Split(string(output), "\x00") {
+		ignored[name] = true
+	}
+
+	filtered := make([]*Stats, 0, len(stats))
+	for _, stat := range stats {
+		if !ignored[stat.Name] {
+			filtered = append(filtered, stat)
+		}
+	}
+
+	return filtered
+}
+
+func serveGitFile(w http.ResponseWriter, r *http.Request) {
+	ref := getRef(r)
+	if !gitRefPattern.MatchString(ref) {
+		http.Error(w, errInvalidRef.Error()+": "+ref, http.StatusBadRequest)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+	dir, name := filepath.Split(fullPath)
+
+	object, err := runGit(r, dir, strings.NewReader(ref+":./"+name+"\n"), "cat-file", "--batch-check")
+	var exitErr *exec.ExitError
+	if errors.Is(err, exec.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	} else if errors.As(err, &exitErr) {
+		http.Error(w, "Not in a git repository: "+path, http.StatusNotFound)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	fields := strings.Fields(string(object))
+	if len(fields) != 3 || fields[1] != "blob" {
+		serveError(w, &os.PathError{Op: "read", Path: path + "@" + ref, Err: os.ErrNotExist})
+		return
+	}
+
+	header := w.Header()
+	etag := "\"" + fields[0] + "\""
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "private, no-cache")
+	exposeHeaders(header, "ETag")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	contentType := contentTypeForName(name)
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", fields[2])
+	header.Set("Content-Disposition", contentDisposition(r, filepath.Base(path)))
+
+	cmd := exec.CommandContext(r.Context(), "git", "-C", dir, "cat-file", "blob", fields[0])
+	cmd.Stdout = w
+	if err := cmd.Run(); err != nil {
+		log.Printf("Unable to read %s at %s: %v", path, ref, err)
+	}
+}
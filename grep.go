@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"unicode/utf8"
+)
+
+const (
+	maxGrepFileSize  = 1 << 20
+	maxGrepFiles     = 10000
+	maxGrepMatches   = 1000
+	maxGrepContext   = 5
+	maxGrepLine      = 200
+	grepSnippetLead  = 80
+	defaultGrepLimit = 100
+)
+
+var errGrepDone = errors.New("grep limit reached")
+
+type grepMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+type grepResult struct {
+	Matches   []*grepMatch `json:"matches"`
+	Truncated bool         `json:"truncated,omitempty"`
+}
+
+type grepSearch struct {
+	r       *http.Request
+	pattern *regexp.Regexp
+	context int
+	limit   int
+	files   int
+	result  *grepResult
+}
+
+func canonicalizeGrep(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeBoolean(query, "regex") && canon
+	canon = canonicalizeCount(query, "context", maxGrepContext) && canon
+	canon = canonicalizeCount(query, "limit", maxGrepMatches) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func getGrepPattern(r *http.Request) (*regexp.Regexp, error) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		return nil, errors.New("Missing query")
+	}
+
+	if _, present := query["regex"]; present {
+		return regexp.Compile(q)
+	}
+
+	return regexp.Compile("(?i)" + regexp.QuoteMeta(q))
+}
+
+// clipLine shortens a long line to a window that starts a little before
+// offset, keeping the cut on rune boundaries.
+func clipLine(line []byte, offset int) string {
+	if len(line) <= maxGrepLine {
+		return string(line)
+	}
+
+	start := offset - grepSnippetLead
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(line[start]) {
+		start--
+	}
+
+	end := start + maxGrepLine
+	if end > len(line) {
+		end = len(line)
+	}
+	for end < len(line) && !utf8.RuneStart(line[end]) {
+		end--
+	}
+
+	return string(line[start:end])
+}
+
+func isGreppable(fullPath string, head []byte) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+
+	if isEditable(fullPath) {
+		return true
+	}
+
+	return filepath.Ext(fullPath) == "" && utf8.Valid(head)
+}
+
+// grepFile searches text files directly and images or PDFs through the
+// text that OCR extracted for the index.
+func (g *grepSearch) grepFile(fullPath, path string, info os.FileInfo) error {
+	if !isServable(path) {
+		return nil
+	}
+
+	if text, ok := indexedText(mapPath(g.r, path)); ok {
+		return g.grepLines(path, []byte(text))
+	}
+
+	if info.Size() > maxGrepFileSize {
+		return nil
+	}
+
+	g.files++
+	if g.files > maxGrepFiles {
+		return errGrepDone
+	}
+
+	file, err := fsOpen(fullPath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxGrepFileSize))
+	if err != nil {
+		return nil
+	}
+
+	head := data
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+	if !isGreppable(fullPath, head) {
+		return nil
+	}
+
+	return g.grepLines(path, data)
+}
+
+func (g *grepSearch) grepLines(path string, data []byte) error {
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	for i, line := range lines {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		loc := g.pattern.FindIndex(line)
+		if loc == nil {
+			continue
+		}
+
+		match := &grepMatch{Path: path, Line: i + 1, Text: clipLine(line, loc[0])}
+		for j := i - g.context; j < i; j++ {
+			if j >= 0 {
+				match.Before = append(match.Before, clipLine(bytes.TrimSuffix(lines[j], []byte("\r")), 0))
+			}
+		}
+		for j := i + 1; j <= i+g.context && j < len(lines); j++ {
+			match.After = append(match.After, clipLine(bytes.TrimSuffix(lines[j], []byte("\r")), 0))
+		}
+
+		g.result.Matches = append(g.result.Matches, match)
+		if len(g.result.Matches) >= g.limit {
+			return errGrepDone
+		}
+	}
+
+	return nil
+}
+
+func (g *grepSearch) grepDir(fullPath, dirPath string) error {
+	if err := g.r.Context().Err(); err != nil {
+		return err
+	}
+
+	infos, err := fsReadDir(fullPath)
+	if err != nil {
+		return nil
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		if isStagingName(name) || isHiddenName(fullPath, name) {
+			continue
+		}
+
+		childPath := filepath.Join(fullPath, name)
+		path := filepath.Join(dirPath, name)
+
+		var err error
+		switch {
+		case info.IsDir():
+			err = g.grepDir(childPath, path)
+		case info.Mode().IsRegular():
+			err = g.grepFile(childPath, path, info)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func handleGrep(w http.ResponseWriter, r *http.Request) {
+	canon := canonicalizeGrep(r.URL)
+	if !canon && allowsRedirects(r) {
+		redirect(w, r)
+		return
+	}
+
+	pattern, err := getGrepPattern(r)
+	if err != nil {
+		http.Error(w, "Invalid pattern: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	if !isServable(path) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	fullPath := getFullPathFromRequest(r)
+
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	search := &grepSearch{
+		r:       r,
+		pattern: pattern,
+		context: getCount(r, "context", 0),
+		limit:   getCount(r, "limit", defaultGrepLimit),
+		result:  &grepResult{Matches: []*grepMatch{}}}
+
+	if fileInfo.IsDir() {
+		err = search.grepDir(fullPath, path)
+	} else if fileInfo.Mode().IsRegular() {
+		err = search.grepFile(fullPath, path, fileInfo)
+	}
+
+	if errors.Is(err, errGrepDone) {
+		search.result.Truncated = true
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", "*")
+	header.Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, search.result)
+}
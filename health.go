@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultWatchdogInterval = 10 * time.Second
+const defaultWatchdogTimeout = 3 * time.Second
+
+type mountHealth struct {
+	Path      string    `json:"path"`
+	Dir       string    `json:"dir"`
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"lastCheck"`
+	Latency   float64   `json:"latencyMs"`
+	Error     string    `json:"error,omitempty"`
+	inFlight  bool
+}
+
+type healthResponse struct {
+	Status string         `json:"status"`
+	Mounts []*mountHealth `json:"mounts"`
+}
+
+var healthMutex sync.Mutex
+var healthStates = make(map[string]*mountHealth)
+
+func initWatchdog(watchdogConfig WatchdogConfig) {
+	interval := watchdogConfig.Interval.Duration
+	if interval == 0 {
+		interval = defaultWatchdogInterval
+	}
+
+	timeout := watchdogConfig.Timeout.Duration
+	if timeout == 0 {
+		timeout = defaultWatchdogTimeout
+	}
+
+	go func() {
+		for {
+			checkMounts(timeout)
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func checkMounts(timeout time.Duration) {
+	mounts := append([]Mount{{Path: "/", Dir: root}}, listMounts()...)
+	current := make(map[string]bool)
+
+	for _, mount := range mounts {
+		current[mount.Dir] = true
+		go checkMount(mount, timeout)
+	}
+
+	healthMutex.Lock()
+	for dir := range healthStates {
+		if !current[dir] {
+			delete(healthStates, dir)
+		}
+	}
+	healthMutex.Unlock()
+}
+
+func checkMount(mount Mount, timeout time.Duration) {
+	healthMutex.Lock()
+	state, present := healthStates[mount.Dir]
+	if !present {
+		state = &mountHealth{Path: mount.Path, Dir: mount.Dir, Healthy: true}
+		healthStates[mount.Dir] = state
+	}
+
+	if state.inFlight {
+		state.Healthy = false
+		state.Error = "stat of " + mount.Path + " is still blocked"
+		state.LastCheck = now()
+		healthMutex.Unlock()
+		return
+	}
+
+	state.inFlight = true
+	healthMutex.Unlock()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		_, err := os.Stat(mount.Dir)
+		healthMutex.Lock()
+		state.inFlight = false
+		healthMutex.Unlock()
+		done <- err
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		err = errors.New("stat of " + mount.Path + " timed out after " + timeout.String())
+	}
+
+	healthMutex.Lock()
+	state.LastCheck = now()
+	state.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+	state.Healthy = err == nil
+	if err != nil {
+		state.Error = err.Error()
+	} else {
+		state.Error = ""
+	}
+	healthMutex.Unlock()
+}
+
+func checkMountHealth(r *http.Request) error {
+	path := getPathFromRequest(r)
+	if path == "" {
+		return nil
+	}
+
+	dir := root
+	if mount, ok := findMount(mapPath(r, path)); ok {
+		dir = mount.Dir
+	}
+
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+
+	if state, present := healthStates[dir]; present && !state.Healthy {
+		return errors.New("Mount unavailable: " + state.Error)
+	}
+
+	return nil
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	response := &healthResponse{Status: "ok"}
+
+	healthMutex.Lock()
+	for _, state := range healthStates {
+		copy := *state
+		response.Mounts = append(response.Mounts, &copy)
+		if !state.Healthy {
+			response.Status = "degraded"
+		}
+	}
+	healthMutex.Unlock()
+
+	status := http.StatusOK
+	if response.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, response)
+}
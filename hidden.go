@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+func hasHidden(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["hidden"]
+	return present
+}
+
+func canonicalizeHidden(query url.Values) bool {
+	return canonicalizeBoolean(query, "hidden")
+}
+
+func hasHiddenComponent(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if strings.HasPrefix(name, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isHiddenName(dirFullPath, name string) bool {
+	return strings.HasPrefix(name, ".") || isCachePath(filepath.Join(dirFullPath, name))
+}
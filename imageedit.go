@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"github.com/iwehrman/serve/convert"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func getTransformFromRequest(r *http.Request) (convert.Transform, error) {
+	query := r.URL.Query()
+	transform := convert.Transform{
+		Flip: query.Get("flip"),
+		Crop: query.Get("crop")}
+
+	if rotate := query.Get("rotate"); rotate != "" {
+		degrees, err := strconv.Atoi(rotate)
+		if err != nil {
+			return transform, convert.ErrInvalidTransform
+		}
+		transform.Rotate = (degrees%360 + 360) % 360
+	}
+
+	return transform, nil
+}
+
+func serveTransformError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, convert.ErrInvalidTransform), errors.Is(err, convert.ErrInvalidMetadata):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, exec.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	}
+}
+
+func handleImageEdit(w http.ResponseWriter, r *http.Request) {
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeEdit(r.URL)
+
+	transform, err := getTransformFromRequest(r)
+	if err != nil {
+		serveTransformError(w, err)
+		return
+	}
+
+	replaceImage(w, r, func(src, dst string) error {
+		return convert.ApplyTransform(src, dst, transform)
+	})
+}
+
+func replaceImage(w http.ResponseWriter, r *http.Request, apply func(src, dst string) error) {
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	if !isThumbnailable(strings.ToLower(filepath.Ext(path))) {
+		http.Error(w, "Not an editable image: "+path, http.StatusBadRequest)
+		return
+	}
+
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, path)) {
+		return
+	}
+
+	dir, name := filepath.Split(fullPath)
+	temp, err := ioutil.TempFile(dir, "."+name+stagingMarker+"*"+filepath.Ext(name))
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	tempPath := temp.Name()
+	temp.Close()
+	os.Remove(tempPath)
+	defer os.Remove(tempPath)
+
+	if err := apply(fullPath, tempPath); err != nil {
+		serveTransformError(w, err)
+		return
+	}
+
+	if err := os.Chmod(tempPath, fileInfo.Mode().Perm()); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	err = runWithTimeout("rename", fullPath, func() error {
+		return os.Rename(tempPath, fullPath)
+	})
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	removeThumbnails(getGlobalPathFromRequest(r))
+	invalidateExif(fullPath)
+	invalidateDimensions(fullPath)
+
+	serveWrittenFile(w, r, path, fullPath, true, nil)
+}
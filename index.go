@@ -0,0 +1,654 @@
+package main
+
+import (
+	"encoding/gob"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const indexFile = "/.index.gob"
+const defaultIndexInterval = time.Hour
+const defaultIndexLimit = 100
+const maxIndexLimit = 10000
+const indexSaveDelay = 10 * time.Second
+const indexVersion = 2
+
+const (
+	indexSortName  = "name"
+	indexSortSize  = "size"
+	indexSortMtime = "mtime"
+	indexSortTaken = "taken"
+)
+
+type IndexConfig struct {
+	Enabled  bool      `json:"enabled,omitempty"`
+	Hash     bool      `json:"hash,omitempty"`
+	Watch    bool      `json:"watch,omitempty"`
+	Similar  bool      `json:"similar,omitempty"`
+	OCR      OCRConfig `json:"ocr,omitzero"`
+	Interval Duration  `json:"interval,omitzero"`
+}
+
+type indexEntry struct {
+	Path  string    `json:"path"`
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime"`
+	Mime  string    `json:"mime,omitempty"`
+	Hash  string    `json:"sha256,omitempty"`
+	DHash string    `json:"dhash,omitempty"`
+
+	Taken *time.Time `json:"taken,omitempty"`
+	Make  string     `json:"make,omitempty"`
+	Model string     `json:"model,omitempty"`
+
+	Latitude  *float64 `json:"lat,omitempty"`
+	Longitude *float64 `json:"lon,omitempty"`
+
+	Text    string `json:"-"`
+	OCR     bool   `json:"-"`
+	Version int    `json:"-"`
+}
+
+type indexSnapshot struct {
+	Updated time.Time
+	Entries []*indexEntry
+}
+
+type indexResponse struct {
+	Updated time.Time     `json:"updated"`
+	Total   int           `json:"total"`
+	Entries []*indexEntry `json:"entries"`
+}
+
+type duplicateGroup struct {
+	Hash  string   `json:"sha256"`
+	Size  int64    `json:"size"`
+	Paths []string `json:"paths"`
+}
+
+var indexMutex sync.RWMutex
+var indexUpdated time.Time
+var indexEntries = make(map[string]*indexEntry)
+var indexByHash = make(map[string][]*indexEntry)
+
+// indexScanDirty collects the paths that notifications and OCR updated
+// while a full scan was running, so that the scan does not overwrite them.
+var indexScanDirty map[string]bool
+
+var indexSaveMutex sync.Mutex
+var indexSavePending bool
+var indexFileMutex sync.Mutex
+var indexSavedUpdated time.Time
+
+func getIndexPath() string {
+	return cacheDir + indexFile
+}
+
+func getIndexConfig() IndexConfig {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return config.Index
+}
+
+func initIndex() {
+	indexConfig := getIndexConfig()
+	if !indexConfig.Enabled {
+		return
+	}
+
+	file, err := os.Open(getIndexPath())
+	if err == nil {
+		var snapshot indexSnapshot
+		err = gob.NewDecoder(file).Decode(&snapshot)
+		file.Close()
+		if err == nil {
+			setIndex(snapshot.Updated, snapshot.Entries)
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Print("Unable to load index file; rebuilding: ", err)
+	}
+
+	interval := indexConfig.Interval.Duration
+	if interval == 0 {
+		interval = defaultIndexInterval
+	}
+
+	go func() {
+		for {
+			if err := updateIndex(indexConfig); err != nil {
+				log.Print("Unable to update index: ", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+
+	if indexConfig.OCR.Enabled {
+		initOCR(indexConfig.OCR)
+	}
+
+	if indexConfig.Watch {
+		if err := watchIndex(indexConfig); err != nil {
+			log.Print("Unable to watch for index changes: ", err)
+		}
+	}
+}
+
+func newIndexMaps(entries []*indexEntry) (map[string]*indexEntry, map[string][]*indexEntry) {
+	byPath := make(map[string]*indexEntry, len(entries))
+	byHash := make(map[string][]*indexEntry)
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+		if entry.Hash != "" {
+			byHash[entry.Hash] = append(byHash[entry.Hash], entry)
+		}
+	}
+
+	return byPath, byHash
+}
+
+func setIndex(updated time.Time, entries []*indexEntry) {
+	byPath, byHash := newIndexMaps(entries)
+
+	indexMutex.Lock()
+	indexUpdated = updated
+	indexEntries = byPath
+	indexByHash = byHash
+	indexMutex.Unlock()
+}
+
+func isWithinAny(path string, dirs map[string]bool) bool {
+	for dir := range dirs {
+		if isWithin(path, dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeIndexScan replaces the index with the entries of a full scan, except
+// below the paths that were updated while the scan was running, where the
+// current entries are kept.
+func mergeIndexScan(updated time.Time, entries []*indexEntry) *indexSnapshot {
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+
+	dirty := indexScanDirty
+	indexScanDirty = nil
+
+	merged := make([]*indexEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !isWithinAny(entry.Path, dirty) {
+			merged = append(merged, entry)
+		}
+	}
+	for path, entry := range indexEntries {
+		if isWithinAny(path, dirty) {
+			merged = append(merged, entry)
+		}
+	}
+
+	indexUpdated = updated
+	indexEntries, indexByHash = newIndexMaps(merged)
+
+	return &indexSnapshot{Updated: updated, Entries: merged}
+}
+
+// saveIndex is called from both the scan loop and delayed saves, so writes
+// of the temporary file are serialized and an older snapshot never replaces
+// a newer one.
+func saveIndex(snapshot *indexSnapshot) error {
+	indexFileMutex.Lock()
+	defer indexFileMutex.Unlock()
+
+	if snapshot.Updated.Before(indexSavedUpdated) {
+		return nil
+	}
+
+	tmpPath := getIndexPath() + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewEncoder(file).Encode(snapshot)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, getIndexPath()); err != nil {
+		return err
+	}
+
+	indexSavedUpdated = snapshot.Updated
+	return nil
+}
+
+func isMountPoint(globalPath string) bool {
+	mount, ok := findMount(globalPath)
+	return ok && mount.Path == globalPath
+}
+
+func isIndexable(fullPath, globalPath string) bool {
+	return !isStagingName(filepath.Base(globalPath)) && !isCachePath(fullPath)
+}
+
+func lookupIndexEntry(globalPath string) (*indexEntry, bool) {
+	indexMutex.RLock()
+	defer indexMutex.RUnlock()
+
+	entry, present := indexEntries[globalPath]
+	return entry, present
+}
+
+// isIndexResultVisible applies the servability and hidden-file rules of
+// directory listings to an indexed path.
+func isIndexResultVisible(r *http.Request, virtualPath string) bool {
+	return isServable(virtualPath) && (hasHidden(r) || !hasHiddenComponent(virtualPath))
+}
+
+func newIndexEntry(fullPath, globalPath string, info os.FileInfo, options IndexConfig) *indexEntry {
+	if entry, present := lookupIndexEntry(globalPath); present && entry.Size == info.Size() &&
+		entry.Mtime.Equal(info.ModTime()) && entry.Version == indexVersion &&
+		(entry.Hash != "" || !options.Hash) && (entry.DHash != "" || !options.Similar || !hasImageHash(globalPath)) {
+		return entry
+	}
+
+	entry := &indexEntry{
+		Path:    globalPath,
+		Size:    info.Size(),
+		Mtime:   info.ModTime(),
+		Mime:    contentTypeForName(globalPath),
+		Version: indexVersion}
+	if options.Hash {
+		if sums, err := fileChecksums(fullPath); err == nil {
+			entry.Hash = sums[checksumSHA256]
+		}
+	}
+
+	if options.Similar && hasImageHash(globalPath) {
+		if hash, err := imageHash(fullPath); err == nil {
+			entry.DHash = formatImageHash(hash)
+		}
+	}
+
+	if hasExif(globalPath) {
+		if exif, err := readExif(fullPath); err == nil {
+			entry.Make = exif.Make
+			entry.Model = exif.Model
+			if !exif.DateTime.IsZero() {
+				entry.Taken = &exif.DateTime
+			}
+			if exif.HasLocation {
+				entry.Latitude = &exif.Latitude
+				entry.Longitude = &exif.Longitude
+			}
+		}
+	}
+
+	return entry
+}
+
+// scanIndex walks the tree below globalPath, reusing the previous entry of
+// any file whose size and mtime are unchanged so that only new or modified
+// files are hashed again.
+func scanIndex(globalPath string, options IndexConfig, emit func(*indexEntry)) {
+	fullPath := resolvePath(globalPath)
+	infos, err := fsReadDir(fullPath)
+	if err != nil {
+		log.Printf("Unable to index %s: %v", globalPath, err)
+		return
+	}
+
+	for _, info := range infos {
+		childPath := filepath.Join(globalPath, info.Name())
+		childFullPath := filepath.Join(fullPath, info.Name())
+		if !isIndexable(childFullPath, childPath) || isMountPoint(childPath) {
+			continue
+		}
+
+		if info.IsDir() {
+			scanIndex(childPath, options, emit)
+		} else if info.Mode().IsRegular() {
+			emit(newIndexEntry(childFullPath, childPath, info, options))
+		}
+	}
+}
+
+func updateIndex(options IndexConfig) error {
+	indexMutex.Lock()
+	indexScanDirty = make(map[string]bool)
+	indexMutex.Unlock()
+
+	var entries []*indexEntry
+	emit := func(entry *indexEntry) {
+		entries = append(entries, entry)
+	}
+
+	scanIndex("/", options, emit)
+	for _, mount := range listMounts() {
+		scanIndex(mount.Path, options, emit)
+	}
+
+	snapshot := mergeIndexScan(now(), entries)
+	queueOCR(snapshot.Entries)
+
+	return saveIndex(snapshot)
+}
+
+func removeIndexEntry(entry *indexEntry) {
+	delete(indexEntries, entry.Path)
+	if entry.Hash == "" {
+		return
+	}
+
+	same := indexByHash[entry.Hash]
+	for i, candidate := range same {
+		if candidate == entry {
+			same = append(same[:i:i], same[i+1:]...)
+			break
+		}
+	}
+	if len(same) == 0 {
+		delete(indexByHash, entry.Hash)
+	} else {
+		indexByHash[entry.Hash] = same
+	}
+}
+
+// refreshIndexPath brings the entries at and below globalPath up to date
+// after a change reported by a filesystem notification.
+func refreshIndexPath(globalPath string, options IndexConfig) {
+	fullPath := resolvePath(globalPath)
+	if !isIndexable(fullPath, globalPath) {
+		return
+	}
+
+	var entries []*indexEntry
+	info, err := fsLstat(fullPath)
+	if err == nil && info.IsDir() {
+		scanIndex(globalPath, options, func(entry *indexEntry) {
+			entries = append(entries, entry)
+		})
+	} else if err == nil && info.Mode().IsRegular() {
+		entries = append(entries, newIndexEntry(fullPath, globalPath, info, options))
+	}
+
+	indexMutex.Lock()
+	if entry, present := indexEntries[globalPath]; present {
+		removeIndexEntry(entry)
+	} else if err != nil || info.IsDir() {
+		for path, entry := range indexEntries {
+			if isWithin(path, globalPath) {
+				removeIndexEntry(entry)
+			}
+		}
+	}
+	for _, entry := range entries {
+		indexEntries[entry.Path] = entry
+		if entry.Hash != "" {
+			indexByHash[entry.Hash] = append(indexByHash[entry.Hash], entry)
+		}
+	}
+	if indexScanDirty != nil {
+		indexScanDirty[globalPath] = true
+	}
+	indexUpdated = now()
+	indexMutex.Unlock()
+
+	queueOCR(entries)
+	scheduleIndexSave()
+}
+
+// setIndexText records the text extracted from an entry, unless the file
+// changed and the entry was replaced while OCR was running.
+func setIndexText(entry *indexEntry, text string) {
+	indexMutex.Lock()
+	if indexEntries[entry.Path] != entry {
+		indexMutex.Unlock()
+		return
+	}
+
+	updated := *entry
+	updated.Text = text
+	updated.OCR = true
+	indexEntries[entry.Path] = &updated
+	for i, candidate := range indexByHash[entry.Hash] {
+		if candidate == entry {
+			indexByHash[entry.Hash][i] = &updated
+		}
+	}
+	if indexScanDirty != nil {
+		indexScanDirty[entry.Path] = true
+	}
+	indexMutex.Unlock()
+
+	scheduleIndexSave()
+}
+
+func indexedText(globalPath string) (string, bool) {
+	entry, present := lookupIndexEntry(globalPath)
+	if !present || !entry.OCR {
+		return "", false
+	}
+	return entry.Text, true
+}
+
+func scheduleIndexSave() {
+	indexSaveMutex.Lock()
+	defer indexSaveMutex.Unlock()
+
+	if indexSavePending {
+		return
+	}
+	indexSavePending = true
+
+	time.AfterFunc(indexSaveDelay, func() {
+		indexSaveMutex.Lock()
+		indexSavePending = false
+		indexSaveMutex.Unlock()
+
+		indexMutex.RLock()
+		snapshot := &indexSnapshot{Updated: indexUpdated, Entries: make([]*indexEntry, 0, len(indexEntries))}
+		for _, entry := range indexEntries {
+			snapshot.Entries = append(snapshot.Entries, entry)
+		}
+		indexMutex.RUnlock()
+
+		if err := saveIndex(snapshot); err != nil {
+			log.Print("Unable to save index file: ", err)
+		}
+	})
+}
+
+func canonicalizeIndexSort(query url.Values) bool {
+	if _, present := query["sort"]; !present {
+		return true
+	}
+
+	sortBy := query.Get("sort")
+	valid := sortBy == indexSortName || sortBy == indexSortSize || sortBy == indexSortMtime || sortBy == indexSortTaken
+	if valid && len(query["sort"]) == 1 {
+		return true
+	}
+
+	if valid {
+		query.Set("sort", sortBy)
+	} else {
+		query.Del("sort")
+	}
+
+	return false
+}
+
+func canonicalizeIndex(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeIndexSort(query) && canon
+	canon = canonicalizeTags(query) && canon
+	canon = canonicalizeHidden(query) && canon
+	canon = canonicalizeCount(query, "distance", maxImageHashDistance) && canon
+	canon = canonicalizeCount(query, "limit", maxIndexLimit) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func sortIndexEntries(entries []*indexEntry, sortBy string) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case sortBy == indexSortSize && a.Size != b.Size:
+			return a.Size > b.Size
+		case sortBy == indexSortMtime && !a.Mtime.Equal(b.Mtime):
+			return a.Mtime.After(b.Mtime)
+		case sortBy == indexSortTaken && (a.Taken == nil) != (b.Taken == nil):
+			return a.Taken != nil
+		case sortBy == indexSortTaken && a.Taken != nil && !a.Taken.Equal(*b.Taken):
+			return a.Taken.After(*b.Taken)
+		case sortBy == indexSortName && filepath.Base(a.Path) != filepath.Base(b.Path):
+			return filepath.Base(a.Path) < filepath.Base(b.Path)
+		}
+		return a.Path < b.Path
+	})
+}
+
+func handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !getIndexConfig().Enabled {
+		http.Error(w, "Index is disabled", http.StatusForbidden)
+		return
+	}
+
+	if !canonicalizeIndex(r.URL) && allowsRedirects(r) {
+		redirect(w, r)
+		return
+	}
+
+	indexMutex.RLock()
+	updated := indexUpdated
+	indexMutex.RUnlock()
+
+	if updated.IsZero() {
+		http.Error(w, "Index is not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/index") {
+	case "", "/":
+		searchIndex(w, r)
+	case "/duplicates":
+		listDuplicates(w, r)
+	case "/similar":
+		listSimilar(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func searchIndex(w http.ResponseWriter, r *http.Request) {
+	query, err := getIndexQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	limit := getCount(r, "limit", defaultIndexLimit)
+
+	indexMutex.RLock()
+	updated := indexUpdated
+	matched := make([]*indexEntry, 0)
+	for _, entry := range indexEntries {
+		if !query.matches(entry) {
+			continue
+		}
+
+		virtualPath, ok := unmapPath(r, entry.Path)
+		if !ok || !isWithin(virtualPath, path) || !isIndexResultVisible(r, virtualPath) {
+			continue
+		}
+
+		result := *entry
+		result.Path = virtualPath
+		matched = append(matched, &result)
+	}
+	indexMutex.RUnlock()
+
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = indexSortName
+	}
+	sortIndexEntries(matched, sortBy)
+
+	response := &indexResponse{Updated: updated, Total: len(matched), Entries: matched}
+	if len(matched) > limit {
+		response.Entries = matched[:limit]
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, response)
+}
+
+func listDuplicates(w http.ResponseWriter, r *http.Request) {
+	if !getIndexConfig().Hash {
+		http.Error(w, "Index hashing is disabled", http.StatusConflict)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	limit := getCount(r, "limit", defaultIndexLimit)
+
+	indexMutex.RLock()
+	groups := make([]*duplicateGroup, 0)
+	for hash, entries := range indexByHash {
+		if len(entries) < 2 {
+			continue
+		}
+
+		group := &duplicateGroup{Hash: hash, Size: entries[0].Size}
+		for _, entry := range entries {
+			if virtualPath, ok := unmapPath(r, entry.Path); ok && isWithin(virtualPath, path) && isIndexResultVisible(r, virtualPath) {
+				group.Paths = append(group.Paths, virtualPath)
+			}
+		}
+
+		if len(group.Paths) > 1 {
+			sort.Strings(group.Paths)
+			groups = append(groups, group)
+		}
+	}
+	indexMutex.RUnlock()
+
+	sort.Slice(groups, func(i, j int) bool {
+		wasted := func(g *duplicateGroup) int64 { return g.Size * int64(len(g.Paths)-1) }
+		if wasted(groups[i]) != wasted(groups[j]) {
+			return wasted(groups[i]) > wasted(groups[j])
+		}
+		return groups[i].Hash < groups[j].Hash
+	})
+	if len(groups) > limit {
+		groups = groups[:limit]
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, groups)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIndexScanKeepsUpdatesMadeDuringScan(t *testing.T) {
+	t.Cleanup(func() {
+		setIndex(time.Time{}, nil)
+	})
+
+	stale := &indexEntry{Path: "/photos/a.jpg", Size: 1}
+	setIndex(now(), []*indexEntry{stale, {Path: "/docs/b.txt", Size: 2}})
+
+	indexMutex.Lock()
+	indexScanDirty = make(map[string]bool)
+	indexMutex.Unlock()
+
+	fresh := &indexEntry{Path: "/photos/a.jpg", Size: 3}
+	indexMutex.Lock()
+	removeIndexEntry(stale)
+	indexEntries[fresh.Path] = fresh
+	indexScanDirty["/photos"] = true
+	indexMutex.Unlock()
+
+	snapshot := mergeIndexScan(now(), []*indexEntry{stale, {Path: "/docs/b.txt", Size: 4}})
+
+	if len(snapshot.Entries) != 2 {
+		t.Fatalf("%d entries after the scan, want 2", len(snapshot.Entries))
+	}
+	if entry, _ := lookupIndexEntry("/photos/a.jpg"); entry != fresh {
+		t.Errorf("scan replaced an entry updated during the scan: %+v", entry)
+	}
+	if entry, _ := lookupIndexEntry("/docs/b.txt"); entry == nil || entry.Size != 4 {
+		t.Errorf("scan did not update an unchanged path: %+v", entry)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const indexDateLayout = "2006-01-02"
+const earthRadiusKm = 6371.0
+const defaultRadiusKm = 1.0
+
+type indexQuery struct {
+	name        string
+	camera      string
+	text        string
+	tags        []string
+	takenAfter  time.Time
+	takenBefore time.Time
+	bbox        []float64
+	near        []float64
+	radius      float64
+}
+
+// parseIndexTime accepts either an RFC 3339 timestamp or a bare date, which
+// is taken in local time like EXIF capture dates.
+func parseIndexTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.ParseInLocation(indexDateLayout, value, time.Local)
+}
+
+func parseCoordinates(value string, count int) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != count {
+		return nil, fmt.Errorf("expected %d numbers", count)
+	}
+
+	coordinates := make([]float64, count)
+	for i, part := range parts {
+		coordinate, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		limit := 90.0
+		if i%2 == 1 {
+			limit = 180
+		}
+		if math.Abs(coordinate) > limit {
+			return nil, fmt.Errorf("%v is out of range", coordinate)
+		}
+		coordinates[i] = coordinate
+	}
+
+	return coordinates, nil
+}
+
+func getIndexQuery(r *http.Request) (*indexQuery, error) {
+	values := r.URL.Query()
+	query := &indexQuery{
+		name:   strings.ToLower(values.Get("q")),
+		camera: strings.ToLower(values.Get("camera")),
+		text:   strings.ToLower(values.Get("text")),
+		tags:   values["tag"],
+		radius: defaultRadiusKm}
+
+	for key, target := range map[string]*time.Time{"takenAfter": &query.takenAfter, "takenBefore": &query.takenBefore} {
+		if value := values.Get(key); value != "" {
+			t, err := parseIndexTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s: %s", key, value)
+			}
+			*target = t
+		}
+	}
+
+	if value := values.Get("bbox"); value != "" {
+		bbox, err := parseCoordinates(value, 4)
+		if err != nil || bbox[0] > bbox[2] {
+			return nil, fmt.Errorf("Invalid bbox: %s", value)
+		}
+		query.bbox = bbox
+	}
+
+	if value := values.Get("near"); value != "" {
+		near, err := parseCoordinates(value, 2)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid near: %s", value)
+		}
+		query.near = near
+	}
+
+	if value := values.Get("radius"); value != "" {
+		radius, err := strconv.ParseFloat(value, 64)
+		if err != nil || radius <= 0 {
+			return nil, fmt.Errorf("Invalid radius: %s", value)
+		}
+		query.radius = radius
+	}
+
+	return query, nil
+}
+
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := math.Pi / 180
+	dLat := (lat2 - lat1) * toRadians
+	dLon := (lon2 - lon1) * toRadians
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRadians)*math.Cos(lat2*toRadians)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// inBoundingBox treats a box whose west edge lies east of its east edge as
+// crossing the antimeridian.
+func inBoundingBox(bbox []float64, lat, lon float64) bool {
+	if lat < bbox[0] || lat > bbox[2] {
+		return false
+	}
+
+	if bbox[1] <= bbox[3] {
+		return lon >= bbox[1] && lon <= bbox[3]
+	}
+
+	return lon >= bbox[1] || lon <= bbox[3]
+}
+
+func (q *indexQuery) matches(entry *indexEntry) bool {
+	if q.name != "" && !strings.Contains(strings.ToLower(filepath.Base(entry.Path)), q.name) {
+		return false
+	}
+
+	if q.camera != "" && !strings.Contains(strings.ToLower(entry.Make+" "+entry.Model), q.camera) {
+		return false
+	}
+
+	if q.text != "" && !strings.Contains(strings.ToLower(entry.Text), q.text) {
+		return false
+	}
+
+	if !hasTags(entry.Path, q.tags) {
+		return false
+	}
+
+	if !q.takenAfter.IsZero() && (entry.Taken == nil || entry.Taken.Before(q.takenAfter)) {
+		return false
+	}
+
+	if !q.takenBefore.IsZero() && (entry.Taken == nil || !entry.Taken.Before(q.takenBefore)) {
+		return false
+	}
+
+	if q.bbox == nil && q.near == nil {
+		return true
+	}
+
+	if entry.Latitude == nil || entry.Longitude == nil {
+		return false
+	}
+
+	if q.bbox != nil && !inBoundingBox(q.bbox, *entry.Latitude, *entry.Longitude) {
+		return false
+	}
+
+	if q.near != nil && distanceKm(q.near[0], q.near[1], *entry.Latitude, *entry.Longitude) > q.radius {
+		return false
+	}
+
+	return true
+}
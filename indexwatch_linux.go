@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const indexWatchMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB | syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+
+type indexWatcher struct {
+	fd      int
+	options IndexConfig
+	mutex   sync.Mutex
+	dirs    map[int32]string
+}
+
+// watchIndex keeps the index current with inotify. Changes that arrive
+// while the queue overflows are left to the periodic rescan.
+func watchIndex(options IndexConfig) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+
+	watcher := &indexWatcher{fd: fd, options: options, dirs: make(map[int32]string)}
+	go func() {
+		watcher.addTree("/")
+		for _, mount := range listMounts() {
+			watcher.addTree(mount.Path)
+		}
+	}()
+	go watcher.run()
+
+	return nil
+}
+
+func (w *indexWatcher) addTree(globalPath string) {
+	fullPath := resolvePath(globalPath)
+	wd, err := syscall.InotifyAddWatch(w.fd, fullPath, indexWatchMask)
+	if err != nil {
+		log.Printf("Unable to watch %s: %v", globalPath, err)
+		return
+	}
+
+	w.mutex.Lock()
+	w.dirs[int32(wd)] = globalPath
+	w.mutex.Unlock()
+
+	infos, err := fsReadDir(fullPath)
+	if err != nil {
+		return
+	}
+
+	for _, info := range infos {
+		childPath := filepath.Join(globalPath, info.Name())
+		if info.IsDir() && isIndexable(filepath.Join(fullPath, info.Name()), childPath) && !isMountPoint(childPath) {
+			w.addTree(childPath)
+		}
+	}
+}
+
+func (w *indexWatcher) run() {
+	buffer := make([]byte, 64*1024)
+	for {
+		count, err := syscall.Read(w.fd, buffer)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			log.Print("Unable to read index notifications: ", err)
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buffer[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			w.handle(event.Wd, event.Mask, name)
+		}
+	}
+}
+
+func (w *indexWatcher) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		log.Print("Index notification queue overflowed; waiting for the next rescan")
+		return
+	}
+
+	w.mutex.Lock()
+	dir, present := w.dirs[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+	}
+	w.mutex.Unlock()
+
+	if !present || name == "" {
+		return
+	}
+
+	globalPath := filepath.Join(dir, name)
+	if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		w.addTree(globalPath)
+	}
+
+	refreshIndexPath(globalPath, w.options)
+}
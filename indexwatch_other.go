@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+func watchIndex(options IndexConfig) error {
+	return errors.New("filesystem notifications are not supported on this platform")
+}
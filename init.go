@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/iwehrman/serve/users"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type prompter struct {
+	reader *bufio.Reader
+}
+
+func (p *prompter) ask(question, defaultValue string) string {
+	if defaultValue != "" {
+		fmt.Printf("%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	answer, err := p.reader.ReadString('\n')
+	if err != nil && answer == "" {
+		log.Fatal("Unable to read answer:", err)
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return defaultValue
+	}
+
+	return answer
+}
+
+func (p *prompter) confirm(question string, defaultValue bool) bool {
+	choices := "y/N"
+	if defaultValue {
+		choices = "Y/n"
+	}
+
+	answer := strings.ToLower(p.ask(question+" ("+choices+")", ""))
+	if answer == "" {
+		return defaultValue
+	}
+
+	return answer == "y" || answer == "yes"
+}
+
+func runInit(args []string) {
+	p := &prompter{reader: bufio.NewReader(os.Stdin)}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Fatal("Unable to determine working directory:", err)
+	}
+
+	configPath, err := filepath.Abs(p.ask("Config file", "serve.json"))
+	if err != nil {
+		log.Fatal("Unable to resolve config path:", err)
+	}
+
+	if _, err := os.Stat(configPath); err == nil {
+		if !p.confirm(configPath+" exists; overwrite?", false) {
+			return
+		}
+	}
+
+	var c Config
+
+	rootPath, err := filepath.Abs(p.ask("Directory to serve", cwd))
+	if err != nil {
+		log.Fatal("Unable to resolve root:", err)
+	}
+	if _, err := validateRoot(rootPath, false); err != nil {
+		log.Fatal("Invalid root: ", err)
+	}
+	c.Root = rootPath
+
+	port := p.ask("Port", strings.TrimPrefix(defaultAddr, ":"))
+	c.Addr = ":" + port
+
+	if p.confirm("Require a login?", true) {
+		usersPath := p.ask("Users file", filepath.Join(filepath.Dir(configPath), "users.json"))
+		store, err := users.Open(usersPath)
+		if err != nil {
+			log.Fatal("Unable to open users file:", err)
+		}
+
+		name := p.ask("Admin user name", "admin")
+		password := p.ask("Admin password", "")
+		if password == "" {
+			log.Fatal("Password must not be empty")
+		}
+
+		if _, err := store.Add(name, "/", password); err != nil {
+			log.Fatal("Unable to add user:", err)
+		}
+		if err := store.SetAdmin(name, true); err != nil {
+			log.Fatal("Unable to add user:", err)
+		}
+		if err := store.Save(); err != nil {
+			log.Fatal("Unable to save users file:", err)
+		}
+
+		c.Users = usersPath
+	}
+
+	if p.confirm("Serve over TLS?", false) {
+		c.TLS.Cert = p.ask("Certificate file", "")
+		c.TLS.Key = p.ask("Key file", "")
+	}
+
+	cachePath := p.ask("Thumbnail cache directory", rootPath)
+	if cachePath != rootPath {
+		c.CacheDir = cachePath
+	}
+
+	if err := writeConfig(configPath, &c); err != nil {
+		log.Fatal("Unable to write config:", err)
+	}
+	fmt.Println("Wrote", configPath)
+
+	if p.confirm("Write a systemd unit?", false) {
+		unit, err := systemdUnit(configPath, false)
+		if err != nil {
+			log.Fatal("Unable to generate systemd unit:", err)
+		}
+
+		unitPath := p.ask("Unit file", "serve.service")
+		if err := ioutil.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+			log.Fatal("Unable to write systemd unit:", err)
+		}
+		fmt.Println("Wrote", unitPath)
+	}
+
+	fmt.Println("Start the server with: serve -config", configPath)
+}
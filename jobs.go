@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const jobsPrefix = "/jobs/"
+const jobRetention = time.Hour
+
+const (
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+type job struct {
+	ID       string     `json:"id"`
+	Kind     string     `json:"kind"`
+	User     string     `json:"user,omitempty"`
+	Path     string     `json:"path"`
+	Status   string     `json:"status"`
+	Done     int64      `json:"done"`
+	Total    int64      `json:"total,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Result   *Stats     `json:"result,omitempty"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	cancel   context.CancelFunc
+}
+
+type jobFunc func(ctx context.Context, j *job) (*Stats, error)
+
+var jobsMutex sync.Mutex
+var jobs = make(map[string]*job)
+
+func pruneJobs() {
+	cutoff := now().Add(-jobRetention)
+	for id, j := range jobs {
+		if j.Finished != nil && j.Finished.Before(cutoff) {
+			delete(jobs, id)
+		}
+	}
+}
+
+func startJob(r *http.Request, kind, path string, run jobFunc) (*job, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		ID:      hex.EncodeToString(buf),
+		Kind:    kind,
+		Path:    path,
+		Status:  jobRunning,
+		Started: now(),
+		cancel:  cancel}
+
+	if user := getUserFromRequest(r); user != nil {
+		j.User = user.Name
+	}
+
+	jobsMutex.Lock()
+	pruneJobs()
+	jobs[j.ID] = j
+	jobsMutex.Unlock()
+
+	go func() {
+		defer cancel()
+
+		result, err := run(ctx, j)
+
+		jobsMutex.Lock()
+		defer jobsMutex.Unlock()
+
+		finished := now()
+		j.Finished = &finished
+		switch {
+		case ctx.Err() != nil:
+			j.Status = jobCanceled
+		case err != nil:
+			j.Status = jobFailed
+			j.Error = err.Error()
+			log.Printf("Job %s (%s %s) failed: %v", j.ID, kind, path, err)
+		default:
+			j.Status = jobDone
+			j.Result = result
+		}
+	}()
+
+	return j, nil
+}
+
+func (j *job) snapshot() job {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	return *j
+}
+
+func (j *job) setTotal(total int64) {
+	jobsMutex.Lock()
+	j.Total = total
+	jobsMutex.Unlock()
+}
+
+func (j *job) addProgress(count int64) {
+	jobsMutex.Lock()
+	j.Done += count
+	jobsMutex.Unlock()
+}
+
+type progressReader struct {
+	io.Reader
+	job *job
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	count, err := p.Reader.Read(buf)
+	p.job.addProgress(int64(count))
+	return count, err
+}
+
+func (j *job) reader(reader io.Reader) io.Reader {
+	if j == nil {
+		return reader
+	}
+
+	return &progressReader{Reader: reader, job: j}
+}
+
+func serveJobStarted(w http.ResponseWriter, j *job) {
+	header := w.Header()
+	header.Set("Location", jobsPrefix+j.ID)
+	exposeHeaders(header, "Location")
+
+	writeJSON(w, http.StatusAccepted, j.snapshot())
+}
+
+func getJob(r *http.Request, id string) (*job, bool) {
+	jobsMutex.Lock()
+	j, present := jobs[id]
+	jobsMutex.Unlock()
+
+	if !present {
+		return nil, false
+	}
+
+	if user := getUserFromRequest(r); user != nil && user.Name != j.User {
+		return nil, false
+	}
+
+	return j, true
+}
+
+func listJobs(r *http.Request) []job {
+	var user string
+	if u := getUserFromRequest(r); u != nil {
+		user = u.Name
+	}
+
+	jobsMutex.Lock()
+	list := make([]job, 0, len(jobs))
+	for _, j := range jobs {
+		if j.User == user {
+			list = append(list, *j)
+		}
+	}
+	jobsMutex.Unlock()
+
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].Started.Before(list[k].Started)
+	})
+
+	return list
+}
+
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+	if id == "" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, listJobs(r))
+		return
+	}
+
+	j, ok := getJob(r, id)
+	if !ok {
+		http.Error(w, "Job not found: "+id, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, j.snapshot())
+	case "DELETE":
+		j.cancel()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
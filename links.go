@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const linkPolicyDeny = "deny"
+
+type jailRoot struct {
+	path string
+	dir  string
+}
+
+func getJailRoots(r *http.Request) []jailRoot {
+	home := mapPath(r, "/")
+	roots := []jailRoot{{path: "/", dir: resolvePath(home)}}
+
+	prefix := strings.TrimSuffix(home, "/") + "/"
+	for _, mount := range listMounts() {
+		if strings.HasPrefix(mount.Path, prefix) {
+			path := filepath.Join("/", strings.TrimPrefix(mount.Path, home))
+			roots = append(roots, jailRoot{path: path, dir: mount.Dir})
+		}
+	}
+
+	return roots
+}
+
+func getVirtualPath(r *http.Request, realPath string) (string, bool) {
+	var match *jailRoot
+	var matchDir, matchRel string
+
+	for _, jail := range getJailRoots(r) {
+		dir, err := fsEvalSymlinks(jail.dir)
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(dir, realPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+
+		if match == nil || len(dir) > len(matchDir) {
+			current := jail
+			match, matchDir, matchRel = &current, dir, rel
+		}
+	}
+
+	if match == nil {
+		return "", false
+	}
+
+	return filepath.Join(match.path, matchRel), true
+}
+
+func getLinkTarget(r *http.Request, fullPath string) string {
+	target, err := fsEvalSymlinks(fullPath)
+	if err != nil {
+		return ""
+	}
+
+	path, _ := getVirtualPath(r, target)
+	return path
+}
+
+func hasHard(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["hard"]
+	return present
+}
+
+func canonicalizeHard(query url.Values) bool {
+	return canonicalizeBoolean(query, "hard")
+}
+
+func canonicalizeLink(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizePathParam(query, "target") && canon
+	canon = canonicalizeHard(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	configMutex.RLock()
+	policy := config.LinkPolicy
+	configMutex.RUnlock()
+
+	if policy == linkPolicyDeny {
+		http.Error(w, "Link creation is disabled", http.StatusForbidden)
+		return
+	}
+
+	canonicalizeLink(r.URL)
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+	target := r.URL.Query().Get("target")
+	targetPath := resolvePath(mapPath(r, target))
+
+	if path == "/" || path == target {
+		http.Error(w, "Invalid link path", http.StatusBadRequest)
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, path)) {
+		return
+	}
+
+	realTarget, err := fsEvalSymlinks(targetPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if _, ok := getVirtualPath(r, realTarget); !ok {
+		http.Error(w, "Link target is outside of the root", http.StatusForbidden)
+		return
+	}
+
+	if !isServable(realTarget) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if hasHard(r) {
+		targetInfo, err := fsStat(realTarget)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+
+		if !targetInfo.Mode().IsRegular() {
+			http.Error(w, "Hardlink target must be a file", http.StatusBadRequest)
+			return
+		}
+
+		err = runWithTimeout("link", fullPath, func() error {
+			return os.Link(realTarget, fullPath)
+		})
+		if errors.Is(err, syscall.EXDEV) {
+			http.Error(w, "Hardlink target is on another device", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+	} else {
+		linkText, err := filepath.Rel(filepath.Dir(fullPath), targetPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = runWithTimeout("symlink", fullPath, func() error {
+			return os.Symlink(linkText, fullPath)
+		})
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+
+	linkInfo, err := fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newStats(r, fullPath, path, linkInfo))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const formatV2 = "v2"
+
+type breadcrumb struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type directoryListing struct {
+	Dir         json.RawMessage `json:"dir"`
+	Parent      string          `json:"parent,omitempty"`
+	Breadcrumbs []*breadcrumb   `json:"breadcrumbs"`
+	Entries     json.RawMessage `json:"entries"`
+}
+
+func hasV2Format(r *http.Request) bool {
+	return r.URL.Query().Get("format") == formatV2
+}
+
+func getBreadcrumbs(dirPath string) []*breadcrumb {
+	crumbs := []*breadcrumb{{Name: "/", Path: "/"}}
+
+	path := "/"
+	for _, name := range strings.Split(strings.Trim(filepath.Clean(dirPath), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		path = filepath.Join(path, name)
+		crumbs = append(crumbs, &breadcrumb{Name: name, Path: path})
+	}
+
+	return crumbs
+}
+
+func newDirectoryListing(r *http.Request, fullPath, dirPath string, entries []byte) (*directoryListing, error) {
+	info, err := fsLstat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	clean := filepath.Clean("/" + dirPath)
+	dir := newStats(r, fullPath, clean, info)
+	dir.Name = filepath.Base(clean)
+
+	encodedDir, err := marshalSelectedStats(r, dir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &directoryListing{
+		Dir:         encodedDir,
+		Breadcrumbs: getBreadcrumbs(clean),
+		Entries:     entries}
+	if clean != "/" {
+		listing.Parent = filepath.Dir(clean)
+	}
+
+	return listing, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type result struct {
+	latency time.Duration
+	bytes   int64
+	status  int
+	err     error
+}
+
+func buildRequest(base, pattern, path string, size int64, rangeSize int64) (*http.Request, error) {
+	query := url.Values{}
+	query.Set("path", path)
+
+	endpoint := "/read"
+	switch pattern {
+	case "stat":
+		endpoint = "/stat"
+	case "readdir":
+		endpoint = "/readdir"
+	case "preview":
+		query.Set("preview", "1")
+	}
+
+	request, err := http.NewRequest("GET", base+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if pattern == "range" && size > rangeSize {
+		start := rand.Int63n(size - rangeSize)
+		request.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(start+rangeSize-1, 10))
+	}
+
+	return request, nil
+}
+
+func fetchSize(client *http.Client, base, path string) int64 {
+	query := url.Values{}
+	query.Set("path", path)
+
+	response, err := client.Get(base + "/stat?" + query.Encode())
+	if err != nil {
+		log.Fatal("Unable to stat target: ", err)
+	}
+	defer response.Body.Close()
+
+	var stats struct {
+		Size int64 `json:"size"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&stats); err != nil {
+		log.Fatal("Unable to decode stat response: ", err)
+	}
+
+	return stats.Size
+}
+
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+
+	index := int(float64(len(latencies)-1) * p)
+	return latencies[index]
+}
+
+func main() {
+	base := flag.String("url", "http://localhost:9595", "server base URL")
+	path := flag.String("path", "/", "path to request")
+	pattern := flag.String("pattern", "readdir", "request pattern: stat, readdir, read, range, or preview")
+	concurrency := flag.Int("concurrency", 16, "number of concurrent clients")
+	duration := flag.Duration("duration", 10*time.Second, "test duration")
+	rangeSize := flag.Int64("range", 64<<10, "bytes per range request")
+	flag.Parse()
+
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}}
+
+	var size int64
+	if *pattern == "range" {
+		size = fetchSize(client, *base, *path)
+	}
+
+	results := make(chan result, *concurrency*16)
+	deadline := time.Now().Add(*duration)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for time.Now().Before(deadline) {
+				request, err := buildRequest(*base, *pattern, *path, size, *rangeSize)
+				if err != nil {
+					log.Fatal("Unable to build request: ", err)
+				}
+
+				start := time.Now()
+				response, err := client.Do(request)
+				if err != nil {
+					results <- result{latency: time.Since(start), err: err}
+					continue
+				}
+
+				count, err := io.Copy(ioutil.Discard, response.Body)
+				response.Body.Close()
+				results <- result{latency: time.Since(start), bytes: count, status: response.StatusCode, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var latencies []time.Duration
+	var totalBytes int64
+	var failures int
+	statuses := make(map[int]int)
+
+	for result := range results {
+		latencies = append(latencies, result.latency)
+		totalBytes = totalBytes + result.bytes
+		if result.err != nil {
+			failures++
+		} else {
+			statuses[result.status]++
+		}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	seconds := duration.Seconds()
+	fmt.Printf("requests:   %d (%.1f/s)\n", len(latencies), float64(len(latencies))/seconds)
+	fmt.Printf("throughput: %.1f MB/s\n", float64(totalBytes)/seconds/(1<<20))
+	fmt.Printf("failures:   %d\n", failures)
+	fmt.Printf("statuses:   %v\n", statuses)
+	fmt.Printf("latency:    p50=%v p90=%v p99=%v max=%v\n",
+		percentile(latencies, 0.5),
+		percentile(latencies, 0.9),
+		percentile(latencies, 0.99),
+		percentile(latencies, 1))
+}
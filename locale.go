@@ -0,0 +1,486 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultLocale = "en"
+
+type localeLabels struct {
+	Name          string
+	Size          string
+	Modified      string
+	Parent        string
+	Theme         string
+	Apply         string
+	Skip          string
+	Contents      string
+	List          string
+	Gallery       string
+	Upload        string
+	Select        string
+	Zip           string
+	Edit          string
+	Save          string
+	Saved         string
+	Conflict      string
+	RotateLeft    string
+	RotateRight   string
+	Delete        string
+	Move          string
+	ConfirmDelete string
+	MoveTo        string
+	Share         string
+	SendFiles     string
+	Comments      string
+	AddComment    string
+}
+
+type locale struct {
+	Tag        string
+	DateLayout string
+	Decimal    string
+	Units      []string
+	Labels     localeLabels
+}
+
+var byteUnits = []string{"B", "KB", "MB", "GB", "TB", "PB"}
+var octetUnits = []string{"o", "Ko", "Mo", "Go", "To", "Po"}
+
+var locales = map[string]*locale{
+	"en": {
+		Tag:        "en",
+		DateLayout: "Jan 2, 2006 3:04 PM",
+		Decimal:    ".",
+		Units:      byteUnits,
+		Labels: localeLabels{
+			Name:          "Name",
+			Size:          "Size",
+			Modified:      "Modified",
+			Parent:        "Parent directory",
+			Theme:         "Theme",
+			Apply:         "Apply",
+			Skip:          "Skip to contents",
+			Contents:      "Directory contents",
+			List:          "List",
+			Gallery:       "Gallery",
+			Upload:        "Upload files",
+			Select:        "Select all",
+			Zip:           "Download as zip",
+			Edit:          "Edit",
+			Save:          "Save",
+			Saved:         "Saved",
+			Conflict:      "The file was changed by someone else. Reload to see the latest version.",
+			RotateLeft:    "Rotate left",
+			RotateRight:   "Rotate right",
+			Delete:        "Delete",
+			Move:          "Move",
+			ConfirmDelete: "Delete the selected items?",
+			MoveTo:        "Move to folder:",
+			Share:         "Share links",
+			SendFiles:     "Send files",
+			Comments:      "Comments",
+			AddComment:    "Add comment",
+		}},
+	"en-gb": {
+		Tag:        "en-GB",
+		DateLayout: "2 Jan 2006 15:04",
+		Decimal:    ".",
+		Units:      byteUnits,
+		Labels: localeLabels{
+			Name:          "Name",
+			Size:          "Size",
+			Modified:      "Modified",
+			Parent:        "Parent directory",
+			Theme:         "Theme",
+			Apply:         "Apply",
+			Skip:          "Skip to contents",
+			Contents:      "Directory contents",
+			List:          "List",
+			Gallery:       "Gallery",
+			Upload:        "Upload files",
+			Select:        "Select all",
+			Zip:           "Download as zip",
+			Edit:          "Edit",
+			Save:          "Save",
+			Saved:         "Saved",
+			Conflict:      "The file was changed by someone else. Reload to see the latest version.",
+			RotateLeft:    "Rotate left",
+			RotateRight:   "Rotate right",
+			Delete:        "Delete",
+			Move:          "Move",
+			ConfirmDelete: "Delete the selected items?",
+			MoveTo:        "Move to folder:",
+			Share:         "Share links",
+			SendFiles:     "Send files",
+			Comments:      "Comments",
+			AddComment:    "Add comment",
+		}},
+	"de": {
+		Tag:        "de",
+		DateLayout: "02.01.2006 15:04",
+		Decimal:    ",",
+		Units:      byteUnits,
+		Labels: localeLabels{
+			Name:          "Name",
+			Size:          "Größe",
+			Modified:      "Geändert",
+			Parent:        "Übergeordneter Ordner",
+			Theme:         "Design",
+			Apply:         "Anwenden",
+			Skip:          "Zum Inhalt springen",
+			Contents:      "Ordnerinhalt",
+			List:          "Liste",
+			Gallery:       "Galerie",
+			Upload:        "Dateien hochladen",
+			Select:        "Alle auswählen",
+			Zip:           "Als ZIP herunterladen",
+			Edit:          "Bearbeiten",
+			Save:          "Speichern",
+			Saved:         "Gespeichert",
+			Conflict:      "Die Datei wurde zwischenzeitlich geändert. Neu laden, um die aktuelle Version zu sehen.",
+			RotateLeft:    "Nach links drehen",
+			RotateRight:   "Nach rechts drehen",
+			Delete:        "Löschen",
+			Move:          "Verschieben",
+			ConfirmDelete: "Ausgewählte Elemente löschen?",
+			MoveTo:        "In Ordner verschieben:",
+			Share:         "Freigabelinks",
+			SendFiles:     "Dateien senden",
+			Comments:      "Kommentare",
+			AddComment:    "Kommentar hinzufügen",
+		}},
+	"fr": {
+		Tag:        "fr",
+		DateLayout: "02/01/2006 15:04",
+		Decimal:    ",",
+		Units:      octetUnits,
+		Labels: localeLabels{
+			Name:          "Nom",
+			Size:          "Taille",
+			Modified:      "Modifié",
+			Parent:        "Dossier parent",
+			Theme:         "Thème",
+			Apply:         "Appliquer",
+			Skip:          "Aller au contenu",
+			Contents:      "Contenu du dossier",
+			List:          "Liste",
+			Gallery:       "Galerie",
+			Upload:        "Téléverser des fichiers",
+			Select:        "Tout sélectionner",
+			Zip:           "Télécharger en zip",
+			Edit:          "Modifier",
+			Save:          "Enregistrer",
+			Saved:         "Enregistré",
+			Conflict:      "Le fichier a été modifié entre-temps. Rechargez pour voir la dernière version.",
+			RotateLeft:    "Pivoter à gauche",
+			RotateRight:   "Pivoter à droite",
+			Delete:        "Supprimer",
+			Move:          "Déplacer",
+			ConfirmDelete: "Supprimer les éléments sélectionnés ?",
+			MoveTo:        "Déplacer vers le dossier :",
+			Share:         "Liens de partage",
+			SendFiles:     "Envoyer des fichiers",
+			Comments:      "Commentaires",
+			AddComment:    "Ajouter un commentaire",
+		}},
+	"es": {
+		Tag:        "es",
+		DateLayout: "02/01/2006 15:04",
+		Decimal:    ",",
+		Units:      byteUnits,
+		Labels: localeLabels{
+			Name:          "Nombre",
+			Size:          "Tamaño",
+			Modified:      "Modificado",
+			Parent:        "Carpeta superior",
+			Theme:         "Tema",
+			Apply:         "Aplicar",
+			Skip:          "Saltar al contenido",
+			Contents:      "Contenido de la carpeta",
+			List:          "Lista",
+			Gallery:       "Galería",
+			Upload:        "Subir archivos",
+			Select:        "Seleccionar todo",
+			Zip:           "Descargar como zip",
+			Edit:          "Editar",
+			Save:          "Guardar",
+			Saved:         "Guardado",
+			Conflict:      "El archivo ha sido modificado. Recargue para ver la versión más reciente.",
+			RotateLeft:    "Girar a la izquierda",
+			RotateRight:   "Girar a la derecha",
+			Delete:        "Eliminar",
+			Move:          "Mover",
+			ConfirmDelete: "¿Eliminar los elementos seleccionados?",
+			MoveTo:        "Mover a la carpeta:",
+			Share:         "Enlaces para compartir",
+			SendFiles:     "Enviar archivos",
+			Comments:      "Comentarios",
+			AddComment:    "Añadir comentario",
+		}},
+	"it": {
+		Tag:        "it",
+		DateLayout: "02/01/2006 15:04",
+		Decimal:    ",",
+		Units:      byteUnits,
+		Labels: localeLabels{
+			Name:          "Nome",
+			Size:          "Dimensione",
+			Modified:      "Modificato",
+			Parent:        "Cartella superiore",
+			Theme:         "Tema",
+			Apply:         "Applica",
+			Skip:          "Vai al contenuto",
+			Contents:      "Contenuto della cartella",
+			List:          "Elenco",
+			Gallery:       "Galleria",
+			Upload:        "Carica file",
+			Select:        "Seleziona tutto",
+			Zip:           "Scarica come zip",
+			Edit:          "Modifica",
+			Save:          "Salva",
+			Saved:         "Salvato",
+			Conflict:      "Il file è stato modificato. Ricarica per vedere la versione più recente.",
+			RotateLeft:    "Ruota a sinistra",
+			RotateRight:   "Ruota a destra",
+			Delete:        "Elimina",
+			Move:          "Sposta",
+			ConfirmDelete: "Eliminare gli elementi selezionati?",
+			MoveTo:        "Sposta nella cartella:",
+			Share:         "Link di condivisione",
+			SendFiles:     "Invia file",
+			Comments:      "Commenti",
+			AddComment:    "Aggiungi commento",
+		}},
+	"nl": {
+		Tag:        "nl",
+		DateLayout: "02-01-2006 15:04",
+		Decimal:    ",",
+		Units:      byteUnits,
+		Labels: localeLabels{
+			Name:          "Naam",
+			Size:          "Grootte",
+			Modified:      "Gewijzigd",
+			Parent:        "Bovenliggende map",
+			Theme:         "Thema",
+			Apply:         "Toepassen",
+			Skip:          "Naar inhoud",
+			Contents:      "Inhoud van map",
+			List:          "Lijst",
+			Gallery:       "Galerij",
+			Upload:        "Bestanden uploaden",
+			Select:        "Alles selecteren",
+			Zip:           "Downloaden als zip",
+			Edit:          "Bewerken",
+			Save:          "Opslaan",
+			Saved:         "Opgeslagen",
+			Conflict:      "Het bestand is intussen gewijzigd. Herlaad om de nieuwste versie te zien.",
+			RotateLeft:    "Linksom draaien",
+			RotateRight:   "Rechtsom draaien",
+			Delete:        "Verwijderen",
+			Move:          "Verplaatsen",
+			ConfirmDelete: "Geselecteerde items verwijderen?",
+			MoveTo:        "Verplaatsen naar map:",
+			Share:         "Deellinks",
+			SendFiles:     "Bestanden verzenden",
+			Comments:      "Opmerkingen",
+			AddComment:    "Opmerking toevoegen",
+		}},
+	"sv": {
+		Tag:        "sv",
+		DateLayout: "2006-01-02 15:04",
+		Decimal:    ",",
+		Units:      byteUnits,
+		Labels: localeLabels{
+			Name:          "Namn",
+			Size:          "Storlek",
+			Modified:      "Ändrad",
+			Parent:        "Överordnad mapp",
+			Theme:         "Tema",
+			Apply:         "Använd",
+			Skip:          "Hoppa till innehåll",
+			Contents:      "Mappens innehåll",
+			List:          "Lista",
+			Gallery:       "Galleri",
+			Upload:        "Ladda upp filer",
+			Select:        "Markera alla",
+			Zip:           "Ladda ner som zip",
+			Edit:          "Redigera",
+			Save:          "Spara",
+			Saved:         "Sparad",
+			Conflict:      "Filen har ändrats av någon annan. Ladda om för att se den senaste versionen.",
+			RotateLeft:    "Rotera åt vänster",
+			RotateRight:   "Rotera åt höger",
+			Delete:        "Ta bort",
+			Move:          "Flytta",
+			ConfirmDelete: "Ta bort de markerade objekten?",
+			MoveTo:        "Flytta till mapp:",
+			Share:         "Delningslänkar",
+			SendFiles:     "Skicka filer",
+			Comments:      "Kommentarer",
+			AddComment:    "Lägg till kommentar",
+		}},
+	"ja": {
+		Tag:        "ja",
+		DateLayout: "2006/01/02 15:04",
+		Decimal:    ".",
+		Units:      byteUnits,
+		Labels: localeLabels{
+			Name:          "名前",
+			Size:          "サイズ",
+			Modified:      "更新日時",
+			Parent:        "親フォルダ",
+			Theme:         "テーマ",
+			Apply:         "適用",
+			Skip:          "コンテンツへ移動",
+			Contents:      "フォルダの内容",
+			List:          "リスト",
+			Gallery:       "ギャラリー",
+			Upload:        "ファイルをアップロード",
+			Select:        "すべて選択",
+			Zip:           "ZIPでダウンロード",
+			Edit:          "編集",
+			Save:          "保存",
+			Saved:         "保存しました",
+			Conflict:      "ファイルは他で変更されました。最新版を表示するには再読み込みしてください。",
+			RotateLeft:    "左に回転",
+			RotateRight:   "右に回転",
+			Delete:        "削除",
+			Move:          "移動",
+			ConfirmDelete: "選択した項目を削除しますか?",
+			MoveTo:        "移動先フォルダ:",
+			Share:         "共有リンク",
+			SendFiles:     "ファイルを送信",
+			Comments:      "コメント",
+			AddComment:    "コメントを追加",
+		}},
+	"zh": {
+		Tag:        "zh",
+		DateLayout: "2006/01/02 15:04",
+		Decimal:    ".",
+		Units:      byteUnits,
+		Labels: localeLabels{
+			Name:          "名称",
+			Size:          "大小",
+			Modified:      "修改时间",
+			Parent:        "上级文件夹",
+			Theme:         "主题",
+			Apply:         "应用",
+			Skip:          "跳到内容",
+			Contents:      "文件夹内容",
+			List:          "列表",
+			Gallery:       "图库",
+			Upload:        "上传文件",
+			Select:        "全选",
+			Zip:           "下载为 zip",
+			Edit:          "编辑",
+			Save:          "保存",
+			Saved:         "已保存",
+			Conflict:      "文件已被他人修改。请重新加载以查看最新版本。",
+			RotateLeft:    "向左旋转",
+			RotateRight:   "向右旋转",
+			Delete:        "删除",
+			Move:          "移动",
+			ConfirmDelete: "删除所选项目?",
+			MoveTo:        "移动到文件夹:",
+			Share:         "分享链接",
+			SendFiles:     "发送文件",
+			Comments:      "评论",
+			AddComment:    "添加评论",
+		}},
+}
+
+func lookupLocale(tag string) (*locale, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if loc, present := locales[tag]; present {
+		return loc, true
+	}
+
+	if index := strings.IndexAny(tag, "-_"); index > 0 {
+		loc, present := locales[tag[:index]]
+		return loc, present
+	}
+
+	return nil, false
+}
+
+func canonicalizeLang(query url.Values) bool {
+	lang, present := query["lang"]
+	if !present {
+		return true
+	}
+
+	loc, ok := lookupLocale(lang[0])
+	if !ok {
+		query.Del("lang")
+		return false
+	}
+
+	if len(lang) > 1 || lang[0] != strings.ToLower(loc.Tag) {
+		query.Set("lang", strings.ToLower(loc.Tag))
+		return false
+	}
+
+	return true
+}
+
+func negotiateLocale(r *http.Request) *locale {
+	if loc, ok := lookupLocale(r.URL.Query().Get("lang")); ok {
+		return loc
+	}
+
+	accepted := parseQualityValues(r.Header.Get("Accept-Language"))
+	tags := make([]string, 0, len(accepted))
+	for tag, quality := range accepted {
+		if quality > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if accepted[tags[i]] != accepted[tags[j]] {
+			return accepted[tags[i]] > accepted[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+
+	for _, tag := range tags {
+		if loc, ok := lookupLocale(tag); ok {
+			return loc
+		}
+	}
+
+	configMutex.RLock()
+	configured := config.UI.Locale
+	configMutex.RUnlock()
+
+	if loc, ok := lookupLocale(configured); ok {
+		return loc
+	}
+
+	return locales[defaultLocale]
+}
+
+func (l *locale) formatSize(size int64) string {
+	if size < 1024 {
+		return strconv.FormatInt(size, 10) + " " + l.Units[0]
+	}
+
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(l.Units)-1 {
+		value = value / 1024
+		unit++
+	}
+
+	number := strconv.FormatFloat(value, 'f', 1, 64)
+	return strings.Replace(number, ".", l.Decimal, 1) + " " + l.Units[unit]
+}
+
+func (l *locale) formatTime(t time.Time) string {
+	return t.Local().Format(l.DateLayout)
+}
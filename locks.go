@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const lockTokenHeader = "Lock-Token"
+const defaultLockTimeout = 5 * time.Minute
+const maxLockTimeout = time.Hour
+
+var errInvalidTimeout = errors.New("Invalid lock timeout")
+
+type lock struct {
+	Path    string    `json:"path"`
+	Owner   string    `json:"owner,omitempty"`
+	Token   string    `json:"token,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+var locks = make(map[string]*lock)
+var locksMutex sync.Mutex
+
+func (l *lock) expired() bool {
+	return !now().Before(l.Expires)
+}
+
+func (l *lock) ownedBy(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(l.Token), []byte(token)) == 1
+}
+
+func getLockTimeout(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("timeout")
+	if value == "" {
+		return defaultLockTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 || timeout > maxLockTimeout {
+		return 0, errInvalidTimeout
+	}
+
+	return timeout, nil
+}
+
+func pruneLocks() {
+	for global, l := range locks {
+		if l.expired() {
+			delete(locks, global)
+		}
+	}
+}
+
+func conflictingLock(global, token string) *lock {
+	for lockGlobal, l := range locks {
+		if (isWithin(global, lockGlobal) || isWithin(lockGlobal, global)) && !l.ownedBy(token) {
+			return l
+		}
+	}
+
+	return nil
+}
+
+func checkLock(w http.ResponseWriter, r *http.Request, global string) bool {
+	locksMutex.Lock()
+	pruneLocks()
+	l := conflictingLock(global, r.Header.Get(lockTokenHeader))
+	locksMutex.Unlock()
+
+	if l == nil {
+		return true
+	}
+
+	http.Error(w, "Path is locked", http.StatusLocked)
+	return false
+}
+
+func canonicalizeLock(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleLock(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if !canonicalizeLock(r.URL) && allowsRedirects(r) {
+			redirect(w, r)
+			return
+		}
+		serveLock(w, r)
+	case "POST":
+		if !requireFeature(w, r, featureWrite) {
+			return
+		}
+		canonicalizeLock(r.URL)
+		acquireLock(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func serveLock(w http.ResponseWriter, r *http.Request) {
+	global := getGlobalPathFromRequest(r)
+
+	locksMutex.Lock()
+	pruneLocks()
+	l, present := locks[global]
+	var info lock
+	if present {
+		info = *l
+	}
+	locksMutex.Unlock()
+
+	if !present {
+		http.Error(w, "Not locked", http.StatusNotFound)
+		return
+	}
+
+	info.Token = ""
+	writeJSON(w, http.StatusOK, info)
+}
+
+func acquireLock(w http.ResponseWriter, r *http.Request) {
+	timeout, err := getLockTimeout(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+	if isProtectedPath(r, path, fullPath) {
+		http.Error(w, "Refusing to lock protected path", http.StatusForbidden)
+		return
+	}
+
+	global := mapPath(r, path)
+	token := r.Header.Get(lockTokenHeader)
+
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	pruneLocks()
+	if l, present := locks[global]; present && l.ownedBy(token) {
+		l.Expires = now().Add(timeout)
+		writeJSON(w, http.StatusOK, l)
+		return
+	}
+
+	if conflictingLock(global, "") != nil {
+		http.Error(w, "Path is locked", http.StatusLocked)
+		return
+	}
+
+	token, err = randomHex(16)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	l := &lock{
+		Path:    path,
+		Owner:   getUserName(r),
+		Token:   token,
+		Expires: now().Add(timeout)}
+	locks[global] = l
+
+	writeJSON(w, http.StatusCreated, l)
+}
+
+func handleUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeLock(r.URL)
+
+	global := getGlobalPathFromRequest(r)
+
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	pruneLocks()
+	l, present := locks[global]
+	if !present {
+		http.Error(w, "Not locked", http.StatusConflict)
+		return
+	}
+
+	if !l.ownedBy(r.Header.Get(lockTokenHeader)) {
+		http.Error(w, "Path is locked", http.StatusLocked)
+		return
+	}
+
+	delete(locks, global)
+	w.WriteHeader(http.StatusNoContent)
+}
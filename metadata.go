@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/iwehrman/serve/convert"
+	"net/http"
+	"net/url"
+)
+
+const maxMetadataSize = 64 * 1024
+
+type metadataRequest struct {
+	convert.Metadata
+	Order []string `json:"order"`
+}
+
+func canonicalizeMetadata(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeMetadata(r.URL)
+
+	var metadata metadataRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMetadataSize)).Decode(&metadata); err != nil {
+		http.Error(w, "Invalid metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if metadata.Order != nil {
+		serveDirectoryOrder(w, r, metadata.Order)
+		return
+	}
+
+	replaceImage(w, r, func(src, dst string) error {
+		return convert.ApplyMetadata(src, dst, metadata.Metadata)
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultContentType = "application/octet-stream"
+const sniffLength = 512
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	return ext
+}
+
+func contentTypeForName(name string) string {
+	ext := normalizeExt(filepath.Ext(name))
+	if ext == "" {
+		return ""
+	}
+
+	configMutex.RLock()
+	for key, contentType := range config.ContentTypes {
+		if normalizeExt(key) == ext {
+			configMutex.RUnlock()
+			return contentType
+		}
+	}
+	configMutex.RUnlock()
+
+	return mime.TypeByExtension(ext)
+}
+
+// isActiveContentType reports whether a browser would run scripts in a
+// document of this type when it is opened directly.
+func isActiveContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "image/svg+xml", "text/xml", "application/xml":
+		return true
+	}
+
+	return false
+}
+
+func hasSniff(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["sniff"]
+	return present
+}
+
+func canonicalizeSniff(query url.Values) bool {
+	return canonicalizeBoolean(query, "sniff")
+}
+
+func sniffAllowed(size int64) bool {
+	configMutex.RLock()
+	sniff := config.Sniff
+	configMutex.RUnlock()
+
+	if sniff.Disabled {
+		return false
+	}
+
+	return sniff.MaxSize <= 0 || size <= sniff.MaxSize
+}
+
+func sniffContentType(reader io.Reader) string {
+	buf := make([]byte, sniffLength)
+	count, err := io.ReadFull(reader, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return defaultContentType
+	}
+
+	return http.DetectContentType(buf[:count])
+}
+
+func contentTypeForFile(fullPath string, fileInfo os.FileInfo) string {
+	if !fileInfo.Mode().IsRegular() {
+		return ""
+	}
+
+	if contentType := contentTypeForName(fileInfo.Name()); contentType != "" {
+		return contentType
+	}
+
+	if !sniffAllowed(fileInfo.Size()) {
+		return defaultContentType
+	}
+
+	file, err := fsOpen(fullPath)
+	if err != nil {
+		return defaultContentType
+	}
+	defer file.Close()
+
+	return sniffContentType(file)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+)
+
+func hasParents(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["parents"]
+	return present
+}
+
+func canonicalizeParents(query url.Values) bool {
+	return canonicalizeBoolean(query, "parents")
+}
+
+func canonicalizeMkdir(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeParents(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleMkdir(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeMkdir(r.URL)
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	if !checkLock(w, r, mapPath(r, path)) {
+		return
+	}
+
+	if _, err := fsLstat(fullPath); err == nil {
+		http.Error(w, "Path already exists: "+path, http.StatusConflict)
+		return
+	} else if !os.IsNotExist(err) {
+		serveError(w, err)
+		return
+	}
+
+	err := runWithTimeout("mkdir", fullPath, func() error {
+		if hasParents(r) {
+			return os.MkdirAll(fullPath, 0755)
+		}
+		return os.Mkdir(fullPath, 0755)
+	})
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	fileInfo, err := fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newStats(r, fullPath, path, fileInfo))
+}
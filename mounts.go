@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errMountExists = errors.New("mount already exists")
+var errMountNotFound = errors.New("mount not found")
+
+func findMount(path string) (Mount, bool) {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	var match *Mount
+	for i := range config.Mounts {
+		mount := &config.Mounts[i]
+		if path == mount.Path || strings.HasPrefix(path, mount.Path+"/") {
+			if match == nil || len(mount.Path) > len(match.Path) {
+				match = mount
+			}
+		}
+	}
+
+	if match == nil {
+		return Mount{}, false
+	}
+
+	return *match, true
+}
+
+func resolvePath(path string) string {
+	if mount, ok := findMount(path); ok {
+		return mount.Dir + strings.TrimPrefix(path, mount.Path)
+	}
+
+	return root + path
+}
+
+// isResolvedWithinRoot reports whether globalPath resolves inside the root,
+// or inside the directory of the mount that serves it.
+func isResolvedWithinRoot(globalPath string) bool {
+	dir := root
+	if mount, ok := findMount(globalPath); ok {
+		dir = mount.Dir
+	}
+
+	return isWithin(filepath.Clean(resolvePath(globalPath)), dir)
+}
+
+func listMounts() []Mount {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	mounts := make([]Mount, len(config.Mounts))
+	copy(mounts, config.Mounts)
+
+	return mounts
+}
+
+func addMount(path, dir string) (Mount, error) {
+	path = filepath.Join("/", path)
+	if path == "/" {
+		return Mount{}, errors.New("cannot mount over the root")
+	}
+
+	if !filepath.IsAbs(dir) {
+		return Mount{}, errors.New("mount directory must be absolute: " + dir)
+	}
+
+	dir = filepath.Clean(dir)
+	if fileInfo, err := os.Stat(dir); err != nil {
+		return Mount{}, err
+	} else if !fileInfo.IsDir() {
+		return Mount{}, errors.New("not a directory: " + dir)
+	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	for _, mount := range config.Mounts {
+		if mount.Path == path {
+			return Mount{}, errMountExists
+		}
+	}
+
+	mount := Mount{Path: path, Dir: dir}
+	config.Mounts = append(config.Mounts, mount)
+
+	return mount, nil
+}
+
+func removeMount(path string) error {
+	path = filepath.Join("/", path)
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	for i, mount := range config.Mounts {
+		if mount.Path == path {
+			config.Mounts = append(config.Mounts[:i], config.Mounts[i+1:]...)
+			return nil
+		}
+	}
+
+	return errMountNotFound
+}
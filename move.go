@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func canonicalizeTransfer(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizePathParam(query, "target") && canon
+	canon = canonicalizeOverwrite(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+func getStagingPath(fullPath string) string {
+	dir, base := filepath.Split(fullPath)
+	return filepath.Join(dir, "."+base+stagingMarker+strconv.FormatInt(rand.Int63(), 36))
+}
+
+func copyFile(src, dst string, fileInfo os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil && fsyncEnabled() {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(dst, fileInfo.ModTime(), fileInfo.ModTime())
+}
+
+func copyEntry(src, dst string, fileInfo os.FileInfo) error {
+	switch {
+	case fileInfo.IsDir():
+		return os.Mkdir(dst, fileInfo.Mode().Perm())
+	case fileInfo.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, dst)
+	case fileInfo.Mode().IsRegular():
+		return copyFile(src, dst, fileInfo)
+	}
+
+	return nil
+}
+
+func copyTree(src, dst string) error {
+	var dirs []string
+	var dirInfos []os.FileInfo
+
+	err := filepath.Walk(src, func(walkPath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if isCachePath(walkPath) {
+			if fileInfo.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, walkPath)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if fileInfo.IsDir() {
+			dirs = append(dirs, target)
+			dirInfos = append(dirInfos, fileInfo)
+		}
+
+		return copyEntry(walkPath, target, fileInfo)
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		mtime := dirInfos[i].ModTime()
+		if err := os.Chtimes(dirs[i], mtime, mtime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func stageCopy(src, dst string, fileInfo os.FileInfo) (string, error) {
+	staging := getStagingPath(dst)
+
+	var err error
+	if fileInfo.IsDir() {
+		err = copyTree(src, staging)
+	} else {
+		err = copyEntry(src, staging, fileInfo)
+	}
+
+	if err != nil {
+		os.RemoveAll(staging)
+		return "", err
+	}
+
+	return staging, nil
+}
+
+func commitStaged(staging, dst string, overwrite bool) error {
+	if !overwrite {
+		if _, err := os.Lstat(dst); err == nil {
+			os.RemoveAll(staging)
+			return &os.PathError{Op: "rename", Path: dst, Err: os.ErrExist}
+		}
+	}
+
+	if err := os.Rename(staging, dst); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+
+	return nil
+}
+
+func copyPath(src, dst string, fileInfo os.FileInfo, overwrite bool) error {
+	staging, err := stageCopy(src, dst, fileInfo)
+	if err != nil {
+		return err
+	}
+
+	return commitStaged(staging, dst, overwrite)
+}
+
+func movePath(src, dst string, fileInfo os.FileInfo, overwrite bool) error {
+	if !overwrite {
+		if _, err := os.Lstat(dst); err == nil {
+			return &os.PathError{Op: "rename", Path: dst, Err: os.ErrExist}
+		}
+	}
+
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyPath(src, dst, fileInfo, overwrite); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+func moveThumbnails(fromGlobal, toGlobal string) {
+	for _, dir := range listThumbDirs() {
+		from := cacheDir + dir + fromGlobal
+		to := cacheDir + dir + toGlobal
+		os.RemoveAll(from + jpegPreviewSuffix)
+		os.RemoveAll(to + jpegPreviewSuffix)
+
+		if _, err := os.Lstat(from); err != nil {
+			continue
+		}
+
+		os.RemoveAll(to)
+		err := os.MkdirAll(filepath.Dir(to), 0755)
+		if err == nil {
+			err = os.Rename(from, to)
+		}
+		if err != nil {
+			log.Printf("Unable to move thumbnails %s: %v", from, err)
+			os.RemoveAll(from)
+		}
+	}
+}
+
+func handleTransfer(w http.ResponseWriter, r *http.Request, move bool) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeTransfer(r.URL)
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+	target := r.URL.Query().Get("target")
+	targetGlobal := mapPath(r, target)
+	targetPath := resolvePath(targetGlobal)
+	overwrite := hasOverwrite(r)
+
+	if !isServable(path) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if (move && isProtectedPath(r, path, fullPath)) || isProtectedPath(r, target, targetPath) {
+		http.Error(w, "Refusing to modify protected path", http.StatusForbidden)
+		return
+	}
+
+	if isWithin(targetPath, fullPath) {
+		http.Error(w, "Target is inside the source path", http.StatusBadRequest)
+		return
+	}
+
+	fileInfo, err := fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	targetInfo, err := fsLstat(targetPath)
+	existed := err == nil
+	if existed && (targetInfo.IsDir() || !overwrite) {
+		http.Error(w, "Target already exists: "+target, http.StatusConflict)
+		return
+	}
+
+	preconditionInfo := fileInfo
+	if !move {
+		preconditionInfo = targetInfo
+	}
+	if !checkPreconditions(w, r, preconditionInfo) {
+		return
+	}
+
+	if move && !checkLock(w, r, getGlobalPathFromRequest(r)) {
+		return
+	}
+
+	if !checkLock(w, r, targetGlobal) {
+		return
+	}
+
+	op := "copy"
+	if move {
+		op = "move"
+	}
+
+	err = runWithTimeout(op, fullPath, func() error {
+		if move {
+			return movePath(fullPath, targetPath, fileInfo, overwrite)
+		}
+		return copyPath(fullPath, targetPath, fileInfo, overwrite)
+	})
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if existed {
+		removeThumbnails(targetGlobal)
+	}
+	if move {
+		moveThumbnails(getGlobalPathFromRequest(r), targetGlobal)
+		moveExpiry(getGlobalPathFromRequest(r), targetGlobal)
+		moveComments(getGlobalPathFromRequest(r), targetGlobal)
+		moveOrder(getGlobalPathFromRequest(r), targetGlobal)
+		moveTags(getGlobalPathFromRequest(r), targetGlobal)
+	} else if existed {
+		clearExpiry(targetGlobal)
+		clearComments(targetGlobal)
+		clearOrder(targetGlobal)
+		clearTags(targetGlobal)
+	}
+
+	targetInfo, err = fsLstat(targetPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if existed {
+		status = http.StatusOK
+	}
+
+	writeJSON(w, status, newStats(r, targetPath, target, targetInfo))
+}
+
+func handleMove(w http.ResponseWriter, r *http.Request) {
+	handleTransfer(w, r, true)
+}
+
+func handleCopy(w http.ResponseWriter, r *http.Request) {
+	handleTransfer(w, r, false)
+}
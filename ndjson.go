@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net/http"
+)
+
+const formatNDJSON = "ndjson"
+const ndjsonFlushInterval = 256
+
+func hasNDJSONFormat(r *http.Request) bool {
+	return r.URL.Query().Get("format") == formatNDJSON
+}
+
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	buffer  *bufio.Writer
+	pending int
+	written bool
+}
+
+func newNDJSONWriter(w http.ResponseWriter, r *http.Request) *ndjsonWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	return &ndjsonWriter{w: w, r: r, buffer: bufio.NewWriter(w)}
+}
+
+func (n *ndjsonWriter) write(stats []*Stats) error {
+	for _, stat := range stats {
+		encoded, err := marshalStats(n.r, stat)
+		if err != nil {
+			return err
+		}
+		n.buffer.Write(encoded)
+		if err := n.buffer.WriteByte('\n'); err != nil {
+			return err
+		}
+		n.written = true
+
+		n.pending++
+		if n.pending >= ndjsonFlushInterval {
+			if err := n.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n *ndjsonWriter) flush() error {
+	n.pending = 0
+	if err := n.buffer.Flush(); err != nil {
+		return err
+	}
+
+	if flusher, ok := n.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+func serveStatsNDJSON(w http.ResponseWriter, r *http.Request, stats []*Stats) {
+	writer := newNDJSONWriter(w, r)
+	if err := writer.write(stats); err != nil {
+		log.Print("Unable to write NDJSON: ", err)
+		return
+	}
+
+	if err := writer.buffer.Flush(); err != nil {
+		log.Print("Unable to write NDJSON: ", err)
+	}
+}
+
+// streamStatsNDJSON writes entries as the tree is walked, flushing after
+// each directory so clients can render before the walk completes.
+func streamStatsNDJSON(w http.ResponseWriter, r *http.Request, fullPath, dirPath string, depth int, filter *statsFilter) {
+	writer := newNDJSONWriter(w, r)
+
+	err := walkTree(r, fullPath, dirPath, depth, filter, func(stats []*Stats) error {
+		if err := writer.write(stats); err != nil {
+			return err
+		}
+		return writer.flush()
+	})
+
+	if err != nil && !writer.written {
+		if errors.Is(err, errTooManyEntries) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			serveError(w, err)
+		}
+		return
+	}
+
+	if err != nil {
+		log.Print("Unable to stream NDJSON: ", err)
+		return
+	}
+
+	if err := writer.buffer.Flush(); err != nil {
+		log.Print("Unable to write NDJSON: ", err)
+	}
+}
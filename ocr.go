@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultOCRWorkers = 1
+const defaultOCRLanguage = "eng"
+const ocrQueueSize = 10000
+const ocrTimeout = 5 * time.Minute
+const maxOCRText = 64 * 1024
+
+type OCRConfig struct {
+	Enabled   bool     `json:"enabled,omitempty"`
+	Languages []string `json:"languages,omitempty"`
+	Workers   int      `json:"workers,omitempty"`
+}
+
+var errNoPDFRenderer = errors.New("pdftoppm is not installed")
+
+var ocrQueue chan *indexEntry
+var ocrPendingMutex sync.Mutex
+var ocrPending = make(map[string]bool)
+
+func isOCRCandidate(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".tif", ".tiff", ".pdf":
+		return true
+	default:
+		return false
+	}
+}
+
+func initOCR(c OCRConfig) {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		log.Print("OCR is enabled but tesseract is not installed")
+		return
+	}
+
+	languages := c.Languages
+	if len(languages) == 0 {
+		languages = []string{defaultOCRLanguage}
+	}
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = defaultOCRWorkers
+	}
+
+	ocrQueue = make(chan *indexEntry, ocrQueueSize)
+	for i := 0; i < workers; i++ {
+		go runOCRWorker(strings.Join(languages, "+"))
+	}
+}
+
+// queueOCR schedules text extraction for indexed entries that have not been
+// through OCR yet. When the queue is full the entry waits for the next scan.
+func queueOCR(entries []*indexEntry) {
+	if ocrQueue == nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.OCR || !isOCRCandidate(entry.Path) {
+			continue
+		}
+
+		ocrPendingMutex.Lock()
+		if ocrPending[entry.Path] {
+			ocrPendingMutex.Unlock()
+			continue
+		}
+		ocrPending[entry.Path] = true
+		ocrPendingMutex.Unlock()
+
+		select {
+		case ocrQueue <- entry:
+		default:
+			ocrPendingMutex.Lock()
+			delete(ocrPending, entry.Path)
+			ocrPendingMutex.Unlock()
+			return
+		}
+	}
+}
+
+func runOCRWorker(languages string) {
+	for entry := range ocrQueue {
+		ctx, cancel := context.WithTimeout(context.Background(), ocrTimeout)
+		text, err := extractText(ctx, resolvePath(entry.Path), languages)
+		cancel()
+
+		ocrPendingMutex.Lock()
+		delete(ocrPending, entry.Path)
+		ocrPendingMutex.Unlock()
+
+		if err != nil {
+			log.Printf("Unable to extract text from %s: %v", entry.Path, err)
+		}
+		setIndexText(entry, text)
+	}
+}
+
+func runTesseract(ctx context.Context, imagePath, languages string) (string, error) {
+	output, err := exec.CommandContext(ctx, "tesseract", imagePath, "stdout", "-l", languages).Output()
+	return string(output), err
+}
+
+func extractText(ctx context.Context, fullPath, languages string) (string, error) {
+	var text string
+	var err error
+	if strings.ToLower(filepath.Ext(fullPath)) == ".pdf" {
+		text, err = extractPDFText(ctx, fullPath, languages)
+	} else {
+		text, err = runTesseract(ctx, fullPath, languages)
+	}
+
+	text = strings.TrimSpace(text)
+	if len(text) > maxOCRText {
+		text = text[:maxOCRText]
+	}
+
+	return text, err
+}
+
+// extractPDFText renders each page of a PDF to an image and runs OCR on the
+// pages in order.
+func extractPDFText(ctx context.Context, fullPath, languages string) (string, error) {
+	if _, err := exec.LookPath("pdftoppm"); err != nil {
+		return "", errNoPDFRenderer
+	}
+
+	dir, err := ioutil.TempDir("", "serve-ocr")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := exec.CommandContext(ctx, "pdftoppm", "-r", "300", "-png", fullPath, filepath.Join(dir, "page")).Run(); err != nil {
+		return "", err
+	}
+
+	pages, err := filepath.Glob(filepath.Join(dir, "page*.png"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(pages)
+
+	var text strings.Builder
+	for _, page := range pages {
+		pageText, err := runTesseract(ctx, page, languages)
+		if err != nil {
+			return text.String(), err
+		}
+		text.WriteString(pageText)
+		if text.Len() > maxOCRText {
+			break
+		}
+	}
+
+	return text.String(), nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const orderFile = "/.order.json"
+const sortManual = "manual"
+
+var orderMutex sync.Mutex
+var orders = make(map[string][]string)
+
+func getOrderPath() string {
+	return cacheDir + orderFile
+}
+
+func initOrder() {
+	data, err := ioutil.ReadFile(getOrderPath())
+	if err == nil {
+		err = json.Unmarshal(data, &orders)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal("Unable to load order file:", err)
+	}
+}
+
+func saveOrder() error {
+	data, err := json.MarshalIndent(orders, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := getOrderPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, getOrderPath())
+}
+
+func hasManualSort(r *http.Request) bool {
+	return r.URL.Query().Get("sort") == sortManual
+}
+
+func canonicalizeSort(query url.Values) bool {
+	if _, present := query["sort"]; !present {
+		return true
+	}
+
+	if query.Get("sort") == sortManual && len(query["sort"]) == 1 {
+		return true
+	}
+
+	if query.Get("sort") == sortManual {
+		query.Set("sort", sortManual)
+	} else {
+		query.Del("sort")
+	}
+
+	return false
+}
+
+func setOrder(globalPath string, names []string) error {
+	orderMutex.Lock()
+	defer orderMutex.Unlock()
+
+	if len(names) == 0 {
+		delete(orders, globalPath)
+	} else {
+		orders[globalPath] = names
+	}
+
+	return saveOrder()
+}
+
+func getOrder(globalPath string) []string {
+	orderMutex.Lock()
+	defer orderMutex.Unlock()
+
+	return orders[globalPath]
+}
+
+func clearOrder(globalPath string) {
+	orderMutex.Lock()
+	defer orderMutex.Unlock()
+
+	changed := false
+	for path := range orders {
+		if isWithin(path, globalPath) {
+			delete(orders, path)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := saveOrder(); err != nil {
+			log.Print("Unable to save order file: ", err)
+		}
+	}
+}
+
+func moveOrder(src, dst string) {
+	orderMutex.Lock()
+	defer orderMutex.Unlock()
+
+	moved := make(map[string][]string)
+	for path, names := range orders {
+		if isWithin(path, src) {
+			moved[dst+strings.TrimPrefix(path, src)] = names
+			delete(orders, path)
+		} else if isWithin(path, dst) {
+			delete(orders, path)
+		}
+	}
+
+	if len(moved) == 0 {
+		return
+	}
+
+	for path, names := range moved {
+		orders[path] = names
+	}
+
+	if err := saveOrder(); err != nil {
+		log.Print("Unable to save order file: ", err)
+	}
+}
+
+// sortManually orders stats by the saved ordering of their directory.
+// Entries missing from the ordering follow the ordered ones by name.
+func sortManually(globalPath string, stats []*Stats) {
+	names := getOrder(globalPath)
+	if len(names) == 0 {
+		return
+	}
+
+	rank := make(map[string]int, len(names))
+	for i, name := range names {
+		if _, present := rank[name]; !present {
+			rank[name] = i
+		}
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		ri, iok := rank[stats[i].Name]
+		rj, jok := rank[stats[j].Name]
+		switch {
+		case iok && jok:
+			return ri < rj
+		case iok != jok:
+			return iok
+		default:
+			return stats[i].Name < stats[j].Name
+		}
+	})
+}
+
+func validateOrder(names []string) bool {
+	for _, name := range names {
+		if name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func serveDirectoryOrder(w http.ResponseWriter, r *http.Request, names []string) {
+	path := getPathFromRequest(r)
+	global := mapPath(r, path)
+	fullPath := resolvePath(global)
+
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !fileInfo.IsDir() {
+		http.Error(w, "Not a directory", http.StatusBadRequest)
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	if !checkLock(w, r, global) {
+		return
+	}
+
+	if !validateOrder(names) {
+		http.Error(w, "Invalid order", http.StatusBadRequest)
+		return
+	}
+
+	if err := setOrder(global, names); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newStats(r, fullPath, path, fileInfo))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const totalCountHeader = "X-Total-Count"
+
+func statsCursorKey(stats *Stats) string {
+	return stats.Path + "\x00" + stats.TrashID
+}
+
+func encodeCursor(stats *Stats) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(statsCursorKey(stats)))
+}
+
+func decodeCursor(cursor string) (string, bool) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.Contains(string(key), "\x00") {
+		return "", false
+	}
+
+	return string(key), true
+}
+
+func getCursor(r *http.Request) (string, bool) {
+	query := r.URL.Query()
+	if _, present := query["cursor"]; !present {
+		return "", false
+	}
+
+	return decodeCursor(query.Get("cursor"))
+}
+
+func canonicalizeCursor(query url.Values) bool {
+	if _, present := query["cursor"]; !present {
+		return true
+	}
+
+	cursor := query.Get("cursor")
+	if _, ok := decodeCursor(cursor); !ok || query.Get("sort") == sortManual {
+		query.Del("cursor")
+		return false
+	}
+
+	if _, present := query["offset"]; present {
+		query.Del("offset")
+		return false
+	}
+
+	if len(query["cursor"]) > 1 {
+		query.Set("cursor", cursor)
+		return false
+	}
+
+	return true
+}
+
+func cursorURL(r *http.Request, cursor string) string {
+	url := *r.URL
+	query := url.Query()
+	query.Del("offset")
+	query.Set("cursor", cursor)
+	url.RawQuery = query.Encode()
+
+	return url.RequestURI()
+}
+
+func isPaginated(r *http.Request) bool {
+	query := r.URL.Query()
+	for _, key := range []string{"offset", "limit", "cursor"} {
+		if _, present := query[key]; present {
+			return true
+		}
+	}
+
+	return false
+}
+
+func paginationURL(r *http.Request, offset int) string {
+	url := *r.URL
+	query := url.Query()
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	} else {
+		query.Del("offset")
+	}
+	url.RawQuery = query.Encode()
+
+	return url.RequestURI()
+}
+
+func paginateStats(w http.ResponseWriter, r *http.Request, stats []*Stats) []*Stats {
+	total := len(stats)
+	offset := getCount(r, "offset", 0)
+	limit := getCount(r, "limit", 0)
+
+	header := w.Header()
+	header.Set(totalCountHeader, strconv.Itoa(total))
+	exposeHeaders(header, totalCountHeader, "Link")
+
+	if _, present := r.URL.Query()["cursor"]; present || (offset == 0 && limit > 0 && !hasManualSort(r)) {
+		return paginateStatsByCursor(header, r, stats, limit)
+	}
+
+	if offset == 0 && limit == 0 {
+		return stats
+	}
+
+	if offset > total {
+		offset = total
+	}
+
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+		addLink(header, paginationURL(r, end), "next")
+	}
+
+	if offset > 0 && limit > 0 {
+		previous := offset - limit
+		if previous < 0 {
+			previous = 0
+		}
+		addLink(header, paginationURL(r, previous), "prev")
+	}
+
+	return stats[offset:end]
+}
+
+func addLink(header http.Header, target, rel string) {
+	header.Add("Link", "<"+target+">; rel=\""+rel+"\"")
+}
+
+// paginateStatsByCursor pages through stats ordered by path, resuming after
+// the entry named by the cursor so that concurrent changes to the directory
+// never cause entries to be skipped or repeated.
+func paginateStatsByCursor(header http.Header, r *http.Request, stats []*Stats, limit int) []*Stats {
+	sort.SliceStable(stats, func(i, j int) bool {
+		return statsCursorKey(stats[i]) < statsCursorKey(stats[j])
+	})
+
+	start := 0
+	if after, ok := getCursor(r); ok {
+		start = sort.Search(len(stats), func(i int) bool {
+			return statsCursorKey(stats[i]) > after
+		})
+	}
+
+	end := len(stats)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+		addLink(header, cursorURL(r, encodeCursor(stats[end-1])), "next")
+	}
+
+	return stats[start:end]
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const imageHashWidth = 9
+const imageHashHeight = 8
+const defaultImageHashDistance = 10
+const maxImageHashDistance = 64
+
+type similarImage struct {
+	*indexEntry
+	Distance int `json:"distance"`
+}
+
+func hasImageHash(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	default:
+		return false
+	}
+}
+
+func formatImageHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+func parseImageHash(value string) (uint64, bool) {
+	hash, err := strconv.ParseUint(value, 16, 64)
+	return hash, err == nil
+}
+
+// luminanceGrid averages the brightness of an image over a coarse grid.
+// JPEG luma is read directly; other formats go through the color model.
+func luminanceGrid(img image.Image) [imageHashHeight][imageHashWidth]float64 {
+	var sums [imageHashHeight][imageHashWidth]float64
+	var counts [imageHashHeight][imageHashWidth]int
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	ycbcr, isYCbCr := img.(*image.YCbCr)
+
+	for y := 0; y < height; y++ {
+		row := y * imageHashHeight / height
+		for x := 0; x < width; x++ {
+			column := x * imageHashWidth / width
+
+			var luma float64
+			if isYCbCr {
+				luma = float64(ycbcr.Y[ycbcr.YOffset(bounds.Min.X+x, bounds.Min.Y+y)])
+			} else {
+				r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				luma = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+			}
+
+			sums[row][column] += luma
+			counts[row][column]++
+		}
+	}
+
+	for row := range sums {
+		for column := range sums[row] {
+			if counts[row][column] > 0 {
+				sums[row][column] /= float64(counts[row][column])
+			}
+		}
+	}
+
+	return sums
+}
+
+// imageHash computes a 64-bit difference hash: each bit records whether a
+// grid cell is brighter than its right-hand neighbour, so that resized or
+// recompressed copies of a shot land within a few bits of each other.
+func imageHash(fullPath string) (uint64, error) {
+	file, err := fsOpen(fullPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, err
+	}
+
+	if img.Bounds().Dx() < imageHashWidth || img.Bounds().Dy() < imageHashHeight {
+		return 0, errNoDimensions
+	}
+
+	grid := luminanceGrid(img)
+	var hash uint64
+	for row := 0; row < imageHashHeight; row++ {
+		for column := 0; column < imageHashWidth-1; column++ {
+			hash <<= 1
+			if grid[row][column] > grid[row][column+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash, nil
+}
+
+func listSimilar(w http.ResponseWriter, r *http.Request) {
+	if !getIndexConfig().Similar {
+		http.Error(w, "Similar image search is disabled", http.StatusConflict)
+		return
+	}
+
+	if !isServable(getPathFromRequest(r)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	global := getGlobalPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+	if _, err := fsStat(fullPath); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !hasImageHash(global) {
+		http.Error(w, "Not a supported image", http.StatusBadRequest)
+		return
+	}
+
+	var target uint64
+	entry, present := lookupIndexEntry(global)
+	if present && entry.DHash != "" {
+		target, _ = parseImageHash(entry.DHash)
+	} else {
+		hash, err := imageHash(fullPath)
+		if err != nil {
+			http.Error(w, "Unable to hash image: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		target = hash
+	}
+
+	distance := getCount(r, "distance", defaultImageHashDistance)
+	limit := getCount(r, "limit", defaultIndexLimit)
+
+	indexMutex.RLock()
+	matches := make([]*similarImage, 0)
+	for path, candidate := range indexEntries {
+		if path == global || candidate.DHash == "" {
+			continue
+		}
+
+		hash, ok := parseImageHash(candidate.DHash)
+		if !ok {
+			continue
+		}
+
+		difference := bits.OnesCount64(hash ^ target)
+		if difference > distance {
+			continue
+		}
+
+		virtualPath, ok := unmapPath(r, path)
+		if !ok || !isIndexResultVisible(r, virtualPath) {
+			continue
+		}
+
+		result := *candidate
+		result.Path = virtualPath
+		matches = append(matches, &similarImage{indexEntry: &result, Distance: difference})
+	}
+	indexMutex.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].Path < matches[j].Path
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, matches)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+type sidecar struct {
+	encoding string
+	ext      string
+}
+
+var sidecars = []sidecar{
+	{encoding: "br", ext: ".br"},
+	{encoding: "zstd", ext: ".zst"},
+	{encoding: "gzip", ext: ".gz"},
+}
+
+func addListHeader(header http.Header, key, value string) {
+	for _, list := range header.Values(key) {
+		for _, field := range strings.Split(list, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+
+	header.Add(key, value)
+}
+
+func addVary(header http.Header, value string) {
+	addListHeader(header, "Vary", value)
+}
+
+func exposeHeaders(header http.Header, values ...string) {
+	for _, value := range values {
+		addListHeader(header, "Access-Control-Expose-Headers", value)
+	}
+}
+
+func servePrecompressed(fullPath string, w http.ResponseWriter, r *http.Request) bool {
+	accepted := parseQualityValues(r.Header.Get("Accept-Encoding"))
+	if len(accepted) == 0 {
+		return false
+	}
+
+	fileInfo, err := fsStat(fullPath)
+	if err != nil || !fileInfo.Mode().IsRegular() {
+		return false
+	}
+
+	var best *sidecar
+	bestQuality := 0.0
+	for i := range sidecars {
+		if quality := accepted[sidecars[i].encoding]; quality > bestQuality {
+			if sidecarInfo, err := fsStat(fullPath + sidecars[i].ext); err == nil &&
+				sidecarInfo.Mode().IsRegular() &&
+				!sidecarInfo.ModTime().Before(fileInfo.ModTime()) {
+				best, bestQuality = &sidecars[i], quality
+			}
+		}
+	}
+
+	header := w.Header()
+	addVary(header, "Accept-Encoding")
+
+	if best == nil {
+		return false
+	}
+
+	file, err := fsOpen(fullPath + best.ext)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	sidecarInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	contentType := contentTypeForName(fullPath)
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Encoding", best.encoding)
+	serveFile(file, sidecarInfo, fileInfo.Name(), w, r)
+
+	return true
+}
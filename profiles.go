@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const jpegPreviewSuffix = ".jpg"
+
+type ClientProfile struct {
+	Name          string `json:"name"`
+	UserAgent     string `json:"userAgent"`
+	NoRedirects   bool   `json:"noRedirects,omitempty"`
+	JPEGPreviews  bool   `json:"jpegPreviews,omitempty"`
+	NoCompression bool   `json:"noCompression,omitempty"`
+}
+
+type clientProfile struct {
+	ClientProfile
+	pattern *regexp.Regexp
+}
+
+var clientProfiles []*clientProfile
+
+func initProfiles(profiles []ClientProfile) error {
+	clientProfiles = nil
+	for _, profile := range profiles {
+		if profile.UserAgent == "" {
+			return fmt.Errorf("%s: missing userAgent", profile.Name)
+		}
+
+		pattern, err := regexp.Compile(profile.UserAgent)
+		if err != nil {
+			return fmt.Errorf("%s: %v", profile.Name, err)
+		}
+
+		clientProfiles = append(clientProfiles, &clientProfile{ClientProfile: profile, pattern: pattern})
+	}
+
+	return nil
+}
+
+func withClientProfile(r *http.Request) *http.Request {
+	userAgent := r.Header.Get("User-Agent")
+	if userAgent == "" {
+		return r
+	}
+
+	for _, profile := range clientProfiles {
+		if profile.pattern.MatchString(userAgent) {
+			ctx := context.WithValue(r.Context(), profileKey, profile)
+			return r.WithContext(ctx)
+		}
+	}
+
+	return r
+}
+
+func getClientProfile(r *http.Request) *clientProfile {
+	profile, _ := r.Context().Value(profileKey).(*clientProfile)
+	if profile == nil {
+		return &clientProfile{}
+	}
+
+	return profile
+}
+
+func allowsRedirects(r *http.Request) bool {
+	return !getClientProfile(r).NoRedirects
+}
+
+func needsJPEGPreview(r *http.Request, path string) bool {
+	if !getClientProfile(r).JPEGPreviews {
+		return false
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return false
+	}
+
+	return true
+}
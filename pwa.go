@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+var appStarted = time.Now()
+
+func serveUIAsset(w http.ResponseWriter, r *http.Request, name, contentType string) {
+	data, err := uiFiles.ReadFile("ui/" + name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", "no-cache")
+
+	http.ServeContent(w, r, name, appStarted, bytes.NewReader(data))
+}
+
+func handleManifest(w http.ResponseWriter, r *http.Request) {
+	serveUIAsset(w, r, "manifest.webmanifest", "application/manifest+json")
+}
+
+func handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	serveUIAsset(w, r, "sw.js", "text/javascript; charset=utf-8")
+}
+
+func handleIcon(w http.ResponseWriter, r *http.Request) {
+	serveUIAsset(w, r, "icon.svg", "image/svg+xml")
+}
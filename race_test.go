@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const raceWorkers = 32
+const raceIterations = 20
+
+const fakeConvert = `#!/bin/sh
+# convert -thumbnail DIMxDIM INPUT OUTPUT, written slowly to widen write races.
+head -c 512 "$3" > "$4"
+sleep 0.02
+tail -c +513 "$3" >> "$4"
+`
+
+func installFakeConvert(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "convert"), []byte(fakeConvert), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func noRedirectClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func hammer(t *testing.T, fn func(worker, iteration int) error) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, raceWorkers*raceIterations)
+
+	for worker := 0; worker < raceWorkers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for iteration := 0; iteration < raceIterations; iteration++ {
+				if err := fn(worker, iteration); err != nil {
+					errs <- err
+				}
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentThumbnails(t *testing.T) {
+	installFakeConvert(t)
+	server := newTestServer(t)
+
+	originals := make([][]byte, 4)
+	for i := range originals {
+		originals[i] = make([]byte, 64<<10)
+		rand.New(rand.NewSource(int64(i))).Read(originals[i])
+
+		name := filepath.Join(root, fmt.Sprintf("photo%d.jpg", i))
+		if err := ioutil.WriteFile(name, originals[i], 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hammer(t, func(worker, iteration int) error {
+		index := (worker + iteration) % len(originals)
+		target := testURL(server, "/read", fmt.Sprintf("/photo%d.jpg", index)) + "&preview=1"
+		if worker%2 == 0 {
+			target = target + "&retina=1"
+		}
+
+		response, err := http.Get(target)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET %s: %s", target, response.Status)
+		}
+
+		if !bytes.Equal(body, originals[index]) {
+			return fmt.Errorf("GET %s: got %d bytes of a partially written thumbnail", target, len(body))
+		}
+
+		return nil
+	})
+}
+
+func TestConcurrentCanonicalRedirects(t *testing.T) {
+	server := newTestServer(t)
+	client := noRedirectClient()
+
+	cases := []struct {
+		request  string
+		location string
+	}{
+		{"/stat?path=a/b", "/stat?path=%2Fa%2Fb"},
+		{"/readdir?path=/a/../b/", "/readdir?path=%2Fb"},
+		{"/read?path=/x.jpg&preview=yes", "/read?path=%2Fx.jpg&preview=1"},
+		{"/read?path=/x.jpg&preview=0&retina=", "/read?path=%2Fx.jpg"},
+		{"/read?retina=1&path=/x.jpg", "/read?path=%2Fx.jpg&retina=1"},
+	}
+
+	hammer(t, func(worker, iteration int) error {
+		c := cases[(worker+iteration)%len(cases)]
+
+		response, err := client.Get(server.URL + c.request)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusMovedPermanently {
+			return fmt.Errorf("GET %s: %s", c.request, response.Status)
+		}
+
+		if location := response.Header.Get("Location"); location != c.location {
+			return fmt.Errorf("GET %s: redirected to %s, want %s", c.request, location, c.location)
+		}
+
+		return nil
+	})
+}
+
+func TestConcurrentConditionalGets(t *testing.T) {
+	server := newTestServer(t)
+
+	content := []byte("conditional content")
+	fullPath := filepath.Join(root, "file.txt")
+	if err := ioutil.WriteFile(fullPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	older := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			mtime := older
+			if i%2 == 1 {
+				mtime = newer
+			}
+			os.Chtimes(fullPath, mtime, mtime)
+		}
+	}()
+	defer close(done)
+
+	hammer(t, func(worker, iteration int) error {
+		endpoint := "/read"
+		if worker%2 == 1 {
+			endpoint = "/stat"
+		}
+
+		request, err := http.NewRequest("GET", testURL(server, endpoint, "/file.txt"), nil)
+		if err != nil {
+			return err
+		}
+
+		request.Header.Set("If-Modified-Since", older.Format(http.TimeFormat))
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		switch response.StatusCode {
+		case http.StatusNotModified:
+			if len(body) != 0 {
+				return fmt.Errorf("GET %s: 304 with a body", endpoint)
+			}
+		case http.StatusOK:
+			if endpoint == "/read" && !bytes.Equal(body, content) {
+				return fmt.Errorf("GET %s: unexpected body %q", endpoint, body)
+			}
+			if _, err := http.ParseTime(response.Header.Get("Last-Modified")); err != nil {
+				return fmt.Errorf("GET %s: invalid Last-Modified: %v", endpoint, err)
+			}
+		default:
+			return fmt.Errorf("GET %s: %s", endpoint, response.Status)
+		}
+
+		return nil
+	})
+}
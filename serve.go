@@ -2,14 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"github.com/iwehrman/serve/convert"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,14 +19,127 @@ import (
 const thumbDir string = "/.thumbs"
 const retinaThumbDir string = "/.thumbs@2x"
 
+const defaultAddr string = ":9595"
+
 var root string
+var cacheDir string
 
 type Stats struct {
-	Name  string    `json:"name"`
-	Path  string    `json:"path"`
-	Size  int64     `json:"size"`
-	Mtime time.Time `json:"mtime"`
-	IsDir bool      `json:"isDir"`
+	Name   string     `json:"name"`
+	Path   string     `json:"path"`
+	Size   int64      `json:"size"`
+	Mtime  time.Time  `json:"mtime"`
+	Btime  *time.Time `json:"btime,omitempty"`
+	IsDir  bool       `json:"isDir"`
+	Type   string     `json:"type"`
+	IsLink bool       `json:"isLink,omitempty"`
+	Target string     `json:"target,omitempty"`
+	Links  uint64     `json:"links,omitempty"`
+	Mime   string     `json:"mime,omitempty"`
+	Width  int        `json:"width,omitempty"`
+	Height int        `json:"height,omitempty"`
+	Mode   string     `json:"mode,omitempty"`
+	Owner  string     `json:"owner,omitempty"`
+	Group  string     `json:"group,omitempty"`
+	Dev    uint64     `json:"dev,omitempty"`
+	Ino    uint64     `json:"ino,omitempty"`
+
+	Deleted   bool              `json:"deleted,omitempty"`
+	TrashID   string            `json:"trashId,omitempty"`
+	URLs      *StatsURLs        `json:"urls,omitempty"`
+	Expires   *time.Time        `json:"expires,omitempty"`
+	Comments  int               `json:"comments,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Children  *int              `json:"childCount,omitempty"`
+	Latitude  *float64          `json:"lat,omitempty"`
+	Longitude *float64          `json:"lon,omitempty"`
+	Checksums map[string]string `json:"checksums,omitempty"`
+	Xattrs    map[string]string `json:"xattrs,omitempty"`
+	Git       *gitInfo          `json:"git,omitempty"`
+	DiskUsage *diskUsage        `json:"du,omitempty"`
+	Sidecars  []*Stats          `json:"sidecars,omitempty"`
+	Burst     []*Stats          `json:"burst,omitempty"`
+}
+
+func newStats(r *http.Request, fullPath, path string, info os.FileInfo) *Stats {
+	stats := &Stats{
+		Name:  info.Name(),
+		Path:  path,
+		Size:  info.Size(),
+		Mtime: modTime(info),
+		IsDir: info.IsDir(),
+		Type:  fileType(info.Mode())}
+
+	globalPath := mapPath(r, path)
+	if wantsField(r, "expires") {
+		if expires, present := getExpiry(globalPath); present {
+			stats.Expires = &expires
+		}
+	}
+
+	if wantsField(r, "comments") {
+		stats.Comments = commentCount(globalPath)
+	}
+
+	if wantsField(r, "tags") {
+		stats.Tags = getTags(globalPath)
+	}
+
+	if count := linkCount(info); count > 1 && info.Mode().IsRegular() {
+		stats.Links = count
+	}
+
+	fileInfo := info
+	if info.Mode()&os.ModeSymlink != 0 {
+		stats.IsLink = true
+		stats.Target = getLinkTarget(r, fullPath)
+
+		if targetInfo, err := fsStat(fullPath); err == nil {
+			stats.Size = targetInfo.Size()
+			stats.Mtime = modTime(targetInfo)
+			stats.IsDir = targetInfo.IsDir()
+			fileInfo = targetInfo
+		}
+	}
+
+	if wantsField(r, "btime") {
+		if btime, ok := birthTime(fullPath, fileInfo); ok {
+			stats.Btime = &btime
+		}
+	}
+
+	if hasDetail(r) {
+		addStatsDetail(stats, fileInfo)
+	}
+
+	if fileInfo.Mode().IsRegular() && (wantsField(r, "width") || wantsField(r, "height")) {
+		if hasConsistencyToken(r) {
+			invalidateDimensions(fullPath)
+		}
+		if dimensions, err := getDimensions(fullPath, fileInfo); err == nil {
+			stats.Width = dimensions.Width
+			stats.Height = dimensions.Height
+		}
+	}
+
+	if fileInfo.Mode().IsRegular() && hasExif(fullPath) && (wantsField(r, "lat") || wantsField(r, "lon")) {
+		if exif, err := getExif(fullPath, fileInfo); err == nil && exif.HasLocation {
+			stats.Latitude = &exif.Latitude
+			stats.Longitude = &exif.Longitude
+		}
+	}
+
+	if fileInfo.Mode().IsRegular() && wantsField(r, "mime") {
+		if hasSniff(r) {
+			stats.Mime = contentTypeForFile(fullPath, fileInfo)
+		} else {
+			stats.Mime = contentTypeForName(path)
+		}
+	}
+
+	stats.URLs = newStatsURLs(stats)
+
+	return stats
 }
 
 func hasPreview(r *http.Request) bool {
@@ -40,48 +155,52 @@ func hasRetina(r *http.Request) bool {
 }
 
 func getPathFromRequest(r *http.Request) string {
-	query := r.URL.Query()
-	path, err := url.QueryUnescape(query.Get("path"))
-
-	if err != nil {
-		log.Println("Unable to parse query: %v", path)
-	}
-
-	return path
+	return r.URL.Query().Get("path")
 }
 
-func getFullPathFromRequest(r *http.Request) string {
+func getGlobalPathFromRequest(r *http.Request) string {
 	path := getPathFromRequest(r)
-	return root + path
+	return mapPath(r, path)
 }
 
-func getThumbPathFromRequest(r *http.Request) (string, bool) {
-	retina := hasRetina(r)
-	path := getPathFromRequest(r)
-	ext := strings.ToLower(filepath.Ext(path))
-
-	var thumbPath string
+func getFullPathFromRequest(r *http.Request) string {
+	path := getGlobalPathFromRequest(r)
+	return resolvePath(path)
+}
 
+func isThumbnailable(ext string) bool {
 	switch ext {
 	case ".jpg", ".jpeg", ".gif", ".png", ".webp":
-		thumbPath = root
+		return true
+	default:
+		return false
+	}
+}
 
-		if retina {
-			thumbPath = thumbPath + retinaThumbDir
-		} else {
-			thumbPath = thumbPath + thumbDir
-		}
+func getThumbPathFromRequest(r *http.Request) (string, int) {
+	dimension := getThumbDimension(r)
+	path := getGlobalPathFromRequest(r)
 
-		thumbPath = thumbPath + path
-	default:
+	var thumbPath string
+
+	if previewerForName(path) == previewerThumbnail {
+		thumbPath = cacheDir + thumbDirForDimension(dimension) + path
+		if needsJPEGPreview(r, path) || !isThumbnailable(strings.ToLower(filepath.Ext(path))) {
+			thumbPath = thumbPath + jpegPreviewSuffix
+		}
+	} else {
 		thumbPath = getFullPathFromRequest(r)
 	}
 
-	return thumbPath, retina
+	return thumbPath, dimension
 }
 
 func canonicalizePath(query url.Values) bool {
-	path := query.Get("path")
+	return canonicalizePathParam(query, "path")
+}
+
+func canonicalizePathParam(query url.Values, key string) bool {
+	path := query.Get(key)
 	isCanon := true
 
 	if len(path) == 0 || string([]rune(path)[0]) != "/" {
@@ -93,7 +212,7 @@ func canonicalizePath(query url.Values) bool {
 	isCanon = isCanon && (path == canonPath)
 
 	if !isCanon {
-		query.Set("path", canonPath)
+		query.Set(key, canonPath)
 	}
 
 	return isCanon
@@ -116,6 +235,39 @@ func canonicalizeBoolean(query url.Values, key string) bool {
 	return canon
 }
 
+func getCount(r *http.Request, key string, fallback int) int {
+	count, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil {
+		return fallback
+	}
+
+	return count
+}
+
+func canonicalizeCount(query url.Values, key string, max int) bool {
+	if _, present := query[key]; !present {
+		return true
+	}
+
+	count, err := strconv.Atoi(query.Get(key))
+	if err != nil || count <= 0 {
+		query.Del(key)
+		return false
+	}
+
+	if max > 0 && count > max {
+		count = max
+	}
+
+	value := strconv.Itoa(count)
+	if len(query[key]) == 1 && query.Get(key) == value {
+		return true
+	}
+
+	query.Set(key, value)
+	return false
+}
+
 func canonicalizeRetina(query url.Values) bool {
 	return canonicalizeBoolean(query, "retina")
 }
@@ -137,6 +289,13 @@ func canonicalizeStat(url *url.URL) bool {
 	query := url.Query()
 
 	canon = canonicalizePath(query) && canon
+	canon = canonicalizeFields(query) && canon
+	canon = canonicalizeTimeFormat(query) && canon
+	canon = canonicalizeSniff(query) && canon
+	canon = canonicalizeDetail(query) && canon
+	canon = canonicalizeXattrs(query) && canon
+	canon = canonicalizeDiskUsage(query) && canon
+	canon = canonicalizeConsistency(query) && canon
 	canon = canonicalizeQuery(url, query) && canon
 
 	return canon
@@ -147,6 +306,24 @@ func canonicalizeReaddir(url *url.URL) bool {
 	query := url.Query()
 
 	canon = canonicalizePath(query) && canon
+	canon = canonicalizeIncludeDeleted(query) && canon
+	canon = canonicalizeHidden(query) && canon
+	canon = canonicalizeGitignore(query) && canon
+	canon = canonicalizeChildCount(query) && canon
+	canon = canonicalizePairs(query) && canon
+	canon = canonicalizeBursts(query) && canon
+	canon = canonicalizeFormat(query) && canon
+	canon = canonicalizeDepth(query) && canon
+	canon = canonicalizeFilter(query) && canon
+	canon = canonicalizeFields(query) && canon
+	canon = canonicalizeTimeFormat(query) && canon
+	canon = canonicalizeSniff(query) && canon
+	canon = canonicalizeSort(query) && canon
+	canon = canonicalizeDetail(query) && canon
+	canon = canonicalizeConsistency(query) && canon
+	canon = canonicalizeCount(query, "offset", 0) && canon
+	canon = canonicalizeCount(query, "limit", maxReaddirEntries) && canon
+	canon = canonicalizeCursor(query) && canon
 	canon = canonicalizeQuery(url, query) && canon
 
 	return canon
@@ -159,6 +336,9 @@ func canonicalizeRead(url *url.URL) bool {
 	canon = canonicalizePath(query) && canon
 	canon = canonicalizePreview(query) && canon
 	canon = canonicalizeRetina(query) && canon
+	canon = canonicalizeThumbSize(query) && canon
+	canon = canonicalizeDownload(query) && canon
+	canon = canonicalizeRef(query) && canon
 	canon = canonicalizeQuery(url, query) && canon
 
 	return canon
@@ -167,11 +347,11 @@ func canonicalizeRead(url *url.URL) bool {
 func isModified(fileInfo os.FileInfo, header http.Header) bool {
 	if _, present := header["If-Modified-Since"]; present {
 		lastModified := header.Get("If-Modified-Since")
-		lmTime, err := time.Parse(time.RFC1123, lastModified)
+		lmTime, err := http.ParseTime(lastModified)
 
 		if err != nil {
 			log.Printf("Failed to parse if-modified-since header: %s - %s", lastModified, err.Error())
-		} else if !lmTime.Before(fileInfo.ModTime()) {
+		} else if !lmTime.Before(modTime(fileInfo).Truncate(time.Second)) {
 			return false
 		}
 	}
@@ -180,22 +360,57 @@ func isModified(fileInfo os.FileInfo, header http.Header) bool {
 }
 
 func setCacheHeaders(fileInfo os.FileInfo, header *http.Header) {
-	header.Set("Last-Modified", fileInfo.ModTime().Format(time.RFC1123))
+	header.Set("Last-Modified", modTime(fileInfo).UTC().Format(http.TimeFormat))
 	header.Set("Cache-Control", "private, max-age=0, no-cache")
 }
 
+func errorStatus(err error) int {
+	switch {
+	case isTimeout(err):
+		return http.StatusServiceUnavailable
+	case os.IsNotExist(err):
+		return http.StatusNotFound
+	case os.IsExist(err):
+		return http.StatusConflict
+	case os.IsPermission(err):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func serveError(w http.ResponseWriter, err error) {
+	if isTimeout(err) {
+		w.Header().Set("Retry-After", "30")
+	}
+
+	http.Error(w, err.Error(), errorStatus(err))
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if count, err := w.Write(encoded); err != nil {
+		log.Printf("Only wrote %v bytes before error: %v\n", count, err)
+	}
+}
+
 func serveStatAtPath(fullPath string, w http.ResponseWriter, r *http.Request) {
-	fileInfo, err := os.Stat(fullPath)
+	fileInfo, err := fsStat(fullPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		serveError(w, err)
 		return
 	}
 
-	if header := r.Header; !isModified(fileInfo, header) {
+	fresh := hasConsistencyToken(r)
+	if header := r.Header; !fresh && !hasDiskUsage(r) && !isModified(fileInfo, header) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
@@ -203,24 +418,39 @@ func serveStatAtPath(fullPath string, w http.ResponseWriter, r *http.Request) {
 	header := w.Header()
 	header.Set("Content-Type", "application/json")
 	header.Set("Access-Control-Allow-Origin", "*")
-	setCacheHeaders(fileInfo, &header)
+	exposeHeaders(header, "ETag")
+	header.Set("ETag", fileETag(fileInfo))
+	if fresh {
+		header.Set("Cache-Control", "no-store")
+	} else {
+		setCacheHeaders(fileInfo, &header)
+	}
 
-	name := fileInfo.Name()
-	path, err := filepath.Rel(root, fullPath)
+	linkInfo, err := fsLstat(fullPath)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serveError(w, err)
 		return
 	}
 
-	path = filepath.Join("/", path)
-	stats := &Stats{
-		Name:  name,
-		Path:  path,
-		Size:  fileInfo.Size(),
-		Mtime: fileInfo.ModTime(),
-		IsDir: fileInfo.IsDir()}
+	path := getPathFromRequest(r)
+	stats := newStats(r, fullPath, path, linkInfo)
+	if wantsField(r, "mime") && !hasSniff(r) {
+		stats.Mime = contentTypeForFile(fullPath, fileInfo)
+	}
+
+	if hasXattrs(r) {
+		stats.Xattrs = readSelectedXattrs(fullPath)
+	}
+
+	if fileInfo.IsDir() && gitEnabled() {
+		stats.Git = getGitInfo(r, fullPath)
+	}
+
+	if fileInfo.IsDir() && hasDiskUsage(r) && wantsField(r, "du") {
+		stats.DiskUsage = getDiskUsage(r, fullPath)
+	}
 
-	encodedStats, err := json.Marshal(stats)
+	encodedStats, err := marshalStats(r, stats)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -231,14 +461,66 @@ func serveStatAtPath(fullPath string, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func serveDirectoryAtPath(fullPath string, w http.ResponseWriter, r *http.Request) {
-	fileInfo, err := os.Stat(fullPath)
+func listDirectory(r *http.Request, fullPath, dirPath string) ([]*Stats, error) {
+	infos, err := fsReadDir(fullPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+
+	stats := make([]*Stats, 0, len(infos))
+	showHidden := hasHidden(r)
+
+	for _, info := range infos {
+		name := info.Name()
+		if isStagingName(name) {
+			continue
+		}
+
+		if !showHidden && isHiddenName(fullPath, name) {
+			continue
+		}
+
+		path := filepath.Join(dirPath, name)
+		stat := newStats(r, filepath.Join(fullPath, name), path, info)
+		if stat.IsDir && hasChildCount(r) && wantsField(r, "childCount") {
+			if count, err := countChildren(filepath.Join(fullPath, name), showHidden); err == nil {
+				stat.Children = &count
+			}
+		}
+		stats = append(stats, stat)
+	}
+
+	if hasGitignore(r) {
+		stats = filterGitignored(r, fullPath, stats)
+	}
+
+	if hasIncludeDeleted(r) {
+		trashed, err := listTrashedEntries(r, dirPath)
+		if err != nil {
+			return nil, err
 		}
+		stats = append(stats, trashed...)
+	}
+
+	if hasManualSort(r) {
+		sortManually(mapPath(r, dirPath), stats)
+	}
+
+	if hasPairs(r) {
+		stats = groupPairs(stats)
+	}
+
+	if hasBursts(r) {
+		stats = groupBursts(r, stats)
+	}
+
+	return stats, nil
+}
+
+func serveDirectoryAtPath(fullPath string, w http.ResponseWriter, r *http.Request) {
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
 		return
 	}
 
@@ -247,7 +529,9 @@ func serveDirectoryAtPath(fullPath string, w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if header := r.Header; !isModified(fileInfo, header) {
+	depth := getDepth(r)
+	fresh := depth > 1 || hasConsistencyToken(r) || hasChildCount(r)
+	if header := r.Header; !fresh && !isModified(fileInfo, header) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
@@ -255,81 +539,114 @@ func serveDirectoryAtPath(fullPath string, w http.ResponseWriter, r *http.Reques
 	header := w.Header()
 	header.Set("Content-Type", "application/json")
 	header.Set("Access-Control-Allow-Origin", "*")
-	setCacheHeaders(fileInfo, &header)
+	if fresh {
+		header.Set("Cache-Control", "no-store")
+	} else {
+		setCacheHeaders(fileInfo, &header)
+	}
 
-	infos, err := ioutil.ReadDir(fullPath)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	filter := getStatsFilter(r)
+	if filter != nil {
+		if err := filter.validate(); err != nil {
+			http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	dirPath := getPathFromRequest(r)
+	if hasNDJSONFormat(r) && !isPaginated(r) {
+		streamStatsNDJSON(w, r, fullPath, dirPath, depth, filter)
 		return
 	}
 
-	stats := make([]*Stats, len(infos))
+	stats, err := listTree(r, fullPath, dirPath, depth, filter)
+	if errors.Is(err, errTooManyEntries) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
 
-	for index, info := range infos {
-		name := info.Name()
-		path, err := filepath.Rel(root, fullPath)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	stats = paginateStats(w, r, stats)
 
-		path = filepath.Join("/", path, name)
-		stat := &Stats{
-			Name:  info.Name(),
-			Path:  path,
-			Size:  info.Size(),
-			Mtime: info.ModTime(),
-			IsDir: info.IsDir()}
+	if hasCSVFormat(r) {
+		serveStatsCSV(w, r, dirPath, stats)
+		return
+	}
 
-		stats[index] = stat
+	if hasNDJSONFormat(r) {
+		serveStatsNDJSON(w, r, stats)
+		return
 	}
 
-	encodedStats, err := json.Marshal(stats)
+	encodedStats, err := marshalStatsList(r, stats)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if hasV2Format(r) {
+		listing, err := newDirectoryListing(r, fullPath, dirPath, encodedStats)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+
+		encodedStats, err = json.Marshal(listing)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	if count, err := w.Write(encodedStats); err != nil {
 		log.Printf("Only wrote %v bytes before error: %v\n", count, err)
 	}
 }
 
-func serveFile(file *os.File, fileInfo os.FileInfo, w http.ResponseWriter, r *http.Request) {
-	if header := r.Header; !isModified(fileInfo, header) {
-		w.WriteHeader(http.StatusNotModified)
-		return
-	}
-
+func serveFile(file io.ReadSeeker, fileInfo os.FileInfo, name string, w http.ResponseWriter, r *http.Request) {
 	header := w.Header()
 	setCacheHeaders(fileInfo, &header)
+	header.Set("ETag", fileETag(fileInfo))
 	header.Set("Access-Control-Allow-Origin", "*")
-	header.Set("Content-Disposition", "filename=\""+fileInfo.Name()+"\"")
+	exposeHeaders(header, "Accept-Ranges", "Content-Disposition", "Content-Encoding", "Content-Length", "Content-Range", "ETag")
+	header.Set("Content-Disposition", contentDisposition(r, name))
+
+	if header.Get("Content-Type") == "" {
+		contentType := contentTypeForName(name)
+		if contentType == "" {
+			contentType = defaultContentType
+			if sniffAllowed(fileInfo.Size()) {
+				contentType = sniffContentType(file)
+				if _, err := file.Seek(0, io.SeekStart); err != nil {
+					serveError(w, err)
+					return
+				}
+			}
+		}
+		header.Set("Content-Type", contentType)
+	}
 
-	if count, err := io.Copy(w, file); err != nil {
-		log.Printf("Only wrote %v of %v bytes before error: %v\n", count, fileInfo.Size(), err)
+	// Uploaded documents share an origin with the API, so active content is
+	// sandboxed rather than allowed to run scripts as the viewer.
+	header.Set("X-Content-Type-Options", "nosniff")
+	if isActiveContentType(header.Get("Content-Type")) {
+		header.Set("Content-Security-Policy", "sandbox")
 	}
+
+	http.ServeContent(w, r, name, modTime(fileInfo), file)
 }
 
 func serveFileAtPath(fullPath string, fileInfoPtr *os.FileInfo, w http.ResponseWriter, r *http.Request) {
-	file, err := os.Open(fullPath)
-	defer file.Close()
-	if err != nil {
-		if os.IsNotExist(err) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
-		return
-	}
-
 	var fileInfo os.FileInfo
+	var err error
 	if fileInfoPtr != nil {
 		fileInfo = *fileInfoPtr
 	} else {
-		fileInfo, err = file.Stat()
+		fileInfo, err = fsStat(fullPath)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 	}
@@ -339,12 +656,27 @@ func serveFileAtPath(fullPath string, fileInfoPtr *os.FileInfo, w http.ResponseW
 		return
 	}
 
-	serveFile(file, fileInfo, w, r)
+	if !fileInfo.Mode().IsRegular() {
+		http.Error(w, "Not a regular file: "+fileType(fileInfo.Mode()), http.StatusBadRequest)
+		return
+	}
+
+	file, err := fsOpen(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	defer file.Close()
+
+	serveFile(file, fileInfo, fileInfo.Name(), w, r)
 }
 
 func makeThumb(r *http.Request) (string, os.FileInfo, error) {
-	thumbPath, retina := getThumbPathFromRequest(r)
-	fileInfo, err := os.Stat(thumbPath)
+	thumbPath, dimension := getThumbPathFromRequest(r)
+	fileInfo, err := fsStat(thumbPath)
+	if err == nil && thumbPath != getFullPathFromRequest(r) && chaosMiss(cacheThumbs, thumbPath) {
+		fileInfo, err = nil, os.ErrNotExist
+	}
 
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -353,13 +685,6 @@ func makeThumb(r *http.Request) (string, os.FileInfo, error) {
 				return thumbPath, nil, err
 			}
 
-			var dimension int
-			if retina {
-				dimension = 400
-			} else {
-				dimension = 200
-			}
-
 			fullPath := getFullPathFromRequest(r)
 			if err := convert.MakeThumbnail(fullPath, thumbPath, dimension); err != nil {
 				log.Print("Unable to create thumbnail", err)
@@ -387,7 +712,7 @@ func redirect(w http.ResponseWriter, r *http.Request) {
 func handleStat(w http.ResponseWriter, r *http.Request) {
 	url := r.URL
 	canon := canonicalizeStat(url)
-	if !canon {
+	if !canon && allowsRedirects(r) {
 		redirect(w, r)
 		return
 	}
@@ -400,7 +725,7 @@ func handleStat(w http.ResponseWriter, r *http.Request) {
 func handleReaddir(w http.ResponseWriter, r *http.Request) {
 	url := r.URL
 	canon := canonicalizeReaddir(url)
-	if !canon {
+	if !canon && allowsRedirects(r) {
 		redirect(w, r)
 		return
 	}
@@ -411,19 +736,53 @@ func handleReaddir(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "PUT" {
+		handlePut(w, r)
+		return
+	}
+
 	url := r.URL
 	canon := canonicalizeRead(url)
-	if !canon {
+	if !canon && allowsRedirects(r) {
 		redirect(w, r)
 		return
 	}
 
+	path := getPathFromRequest(r)
+	if !isServable(path) || !isServableTarget(getFullPathFromRequest(r)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if getRef(r) != "" {
+		if !gitEnabled() {
+			http.Error(w, "Git browsing is disabled", http.StatusForbidden)
+			return
+		}
+		serveGitFile(w, r)
+		return
+	}
+
 	var fileInfoPtr *os.FileInfo
 	var fullPath string
 	if hasPreview(r) {
+		switch previewerForName(path) {
+		case previewerNone:
+			http.Error(w, "No preview available", http.StatusNotFound)
+			return
+		case previewerArchive:
+			serveArchivePreview(w, r)
+			return
+		}
+
+		if !isAllowedThumbSize(getThumbSize(r)) {
+			http.Error(w, "Invalid size", http.StatusBadRequest)
+			return
+		}
+
 		thumbPath, fileInfo, err := makeThumb(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			serveError(w, err)
 			return
 		}
 
@@ -436,6 +795,9 @@ func handleRead(w http.ResponseWriter, r *http.Request) {
 
 	} else {
 		fullPath = getFullPathFromRequest(r)
+		if servePrecompressed(fullPath, w, r) {
+			return
+		}
 		fileInfoPtr = nil
 	}
 
@@ -443,7 +805,7 @@ func handleRead(w http.ResponseWriter, r *http.Request) {
 }
 
 func initThumbDir() {
-	thumbPath := root + thumbDir
+	thumbPath := cacheDir + thumbDir
 	if _, err := os.Stat(thumbPath); err != nil {
 		if os.IsNotExist(err) {
 			if err := os.Mkdir(thumbPath, 0755); err != nil {
@@ -463,12 +825,46 @@ func handlerWrapper(handler requestHandler) requestHandler {
 		method := r.Method
 
 		header := w.Header()
-		header.Set("Access-Control-Allow-Origin", "*")
+		if !isAdminPath(r.URL.Path) {
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
 
 		log.Printf("%s: %s\n", method, uri)
 		if method == "OPTIONS" {
-			header.Set("Access-Control-Allow-Headers", "Accept-Encoding,DNT")
-			header.Set("Access-Control-Allow-Methods", "GET,POST")
+			header.Set("Access-Control-Allow-Headers", "Accept-Encoding,Authorization,Content-MD5,Content-Type,Digest,DNT,If-Match,If-None-Match,If-Range,If-Unmodified-Since,Lock-Token,Range,Tus-Resumable,Upload-Length,Upload-Metadata,Upload-Offset")
+			header.Set("Access-Control-Allow-Methods", "GET,HEAD,POST,PUT,PATCH,DELETE")
+			return
+		}
+
+		r, ok := authenticate(w, r)
+		if !ok {
+			recordAudit(r, http.StatusUnauthorized)
+			return
+		}
+
+		if len(clientProfiles) > 0 {
+			addVary(header, "User-Agent")
+			r = withClientProfile(r)
+		}
+
+		if isMutation(r) {
+			setConsistencyToken(header)
+		}
+
+		if auditLogger != nil {
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer func() { recordAudit(r, recorder.status) }()
+			w = recorder
+		}
+
+		if compressor, ok := newCompressWriter(w, r); ok {
+			defer compressor.Close()
+			w = compressor
+		}
+
+		if err := checkMountHealth(r); err != nil {
+			header.Set("Retry-After", "30")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 			return
 		}
 
@@ -476,24 +872,214 @@ func handlerWrapper(handler requestHandler) requestHandler {
 	}
 }
 
+func newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stat", handlerWrapper(handleStat))
+	mux.HandleFunc("/read", handlerWrapper(handleRead))
+	mux.HandleFunc("/readdir", handlerWrapper(handleReaddir))
+	mux.HandleFunc("/tree", handlerWrapper(handleTree))
+	mux.HandleFunc("/grep", handlerWrapper(handleGrep))
+	mux.HandleFunc("/index", handlerWrapper(handleIndex))
+	mux.HandleFunc("/index/", handlerWrapper(handleIndex))
+	mux.HandleFunc("/link", handlerWrapper(handleLink))
+	mux.HandleFunc("/write", handlerWrapper(handleWrite))
+	mux.HandleFunc("/append", handlerWrapper(handleAppend))
+	mux.HandleFunc("/fetch", handlerWrapper(handleFetch))
+	mux.HandleFunc("/jobs", handlerWrapper(handleJobs))
+	mux.HandleFunc("/jobs/", handlerWrapper(handleJobs))
+	mux.HandleFunc("/drops", handlerWrapper(handleDrops))
+	mux.HandleFunc("/drops/", handlerWrapper(handleDrops))
+	mux.HandleFunc("/drop/", handlerWrapper(handleDrop))
+	mux.HandleFunc("/shares", handlerWrapper(handleShares))
+	mux.HandleFunc("/shares/", handlerWrapper(handleShares))
+	mux.HandleFunc("/share/", handlerWrapper(handleShare))
+	mux.HandleFunc("/mkdir", handlerWrapper(handleMkdir))
+	mux.HandleFunc("/touch", handlerWrapper(handleTouch))
+	mux.HandleFunc("/expire", handlerWrapper(handleExpire))
+	mux.HandleFunc("/lock", handlerWrapper(handleLock))
+	mux.HandleFunc("/unlock", handlerWrapper(handleUnlock))
+	mux.HandleFunc("/comments", handlerWrapper(handleComments))
+	mux.HandleFunc("/comments/", handlerWrapper(handleComments))
+	mux.HandleFunc("/activity", handlerWrapper(handleActivity))
+	mux.HandleFunc("/metadata", handlerWrapper(handleMetadata))
+	mux.HandleFunc("/tags", handlerWrapper(handleTags))
+	mux.HandleFunc("/xattr", handlerWrapper(handleXattr))
+	mux.HandleFunc("/trash", handlerWrapper(handleTrash))
+	mux.HandleFunc("/trash/", handlerWrapper(handleTrash))
+	mux.HandleFunc("/delete", handlerWrapper(handleDelete))
+	mux.HandleFunc("/move", handlerWrapper(handleMove))
+	mux.HandleFunc("/copy", handlerWrapper(handleCopy))
+	mux.HandleFunc("/extract", handlerWrapper(handleExtract))
+	mux.HandleFunc("/archive", handlerWrapper(handleArchive))
+	mux.HandleFunc("/batch", handlerWrapper(handleBatch))
+	mux.HandleFunc("/thumbnails", handlerWrapper(handleThumbnails))
+	mux.HandleFunc("/uploads", handlerWrapper(handleUploads))
+	mux.HandleFunc("/uploads/", handlerWrapper(handleUploads))
+	mux.HandleFunc("/browse", handlerWrapper(handleBrowse))
+	mux.HandleFunc("/edit", handlerWrapper(handleEdit))
+	mux.HandleFunc("/zip", handlerWrapper(handleZip))
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/manifest.webmanifest", handleManifest)
+	mux.HandleFunc("/sw.js", handleServiceWorker)
+	mux.HandleFunc("/icon.svg", handleIcon)
+	mux.HandleFunc("/capabilities", handlerWrapper(handleCapabilities))
+	mux.HandleFunc("/about", handlerWrapper(handleAbout))
+	mux.HandleFunc("/about/licenses", handlerWrapper(handleLicenses))
+	mux.HandleFunc("/about/sbom", handlerWrapper(handleSBOM))
+	mux.HandleFunc("/admin/users", handlerWrapper(handleAdminUsers))
+	mux.HandleFunc("/admin/tokens", handlerWrapper(handleAdminTokens))
+	mux.HandleFunc("/admin/mounts", handlerWrapper(handleAdminMounts))
+	mux.HandleFunc("/admin/features", handlerWrapper(handleAdminFeatures))
+
+	return mux
+}
+
 func serve() {
-	http.HandleFunc("/stat", handlerWrapper(handleStat))
-	http.HandleFunc("/read", handlerWrapper(handleRead))
-	http.HandleFunc("/readdir", handlerWrapper(handleReaddir))
+	mux := newServeMux()
+
+	addr := config.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
 
-	log.Fatal(http.ListenAndServe(":9595", nil))
+	log.Println("Listening:", addr)
+	if config.TLS.Cert != "" {
+		tlsConfig, err := newTLSConfig(config.TLS)
+		if err != nil {
+			log.Fatal("Invalid TLS: ", err)
+		}
+
+		server := &http.Server{Addr: addr, Handler: mux, TLSConfig: tlsConfig}
+		log.Fatal(server.ListenAndServeTLS(config.TLS.Cert, config.TLS.Key))
+	} else {
+		log.Fatal(http.ListenAndServe(addr, mux))
+	}
 }
 
 func main() {
-	if _root, err := os.Getwd(); err != nil {
-		log.Fatal("Unable to determine root")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "adduser":
+			runAddUser(os.Args[2:])
+			return
+		case "init":
+			runInit(os.Args[2:])
+			return
+		case "install-service":
+			runInstallService(os.Args[2:])
+			return
+		case "uninstall-service":
+			runUninstallService(os.Args[2:])
+			return
+		case "gen-fixtures":
+			runGenFixtures(os.Args[2:])
+			return
+		}
+	}
+
+	configPath := flag.String("config", "", "path to the config file")
+	rootPath := flag.String("root", "", "directory to serve; defaults to the working directory")
+	addr := flag.String("addr", "", "address to listen on; defaults to "+defaultAddr)
+	allowSystemRoot := flag.Bool("allow-system-root", false, "allow serving the filesystem root")
+	usersFile := flag.String("users", "", "path to the users file; enables authentication")
+	auditFile := flag.String("audit", "", "path to the audit log")
+	flag.Parse()
+
+	if *configPath != "" {
+		if err := loadConfig(*configPath); err != nil {
+			log.Fatal("Unable to load config:", err)
+		}
+	}
+
+	if err := validateExtensions(config.Extensions); err != nil {
+		log.Fatal("Invalid extensions: ", err)
+	}
+
+	if err := validateChaos(config.Chaos); err != nil {
+		log.Fatal("Invalid chaos: ", err)
+	}
+
+	if err := initProfiles(config.Profiles); err != nil {
+		log.Fatal("Invalid profiles: ", err)
+	}
+
+	if _, err := newTLSConfig(config.TLS); err != nil {
+		log.Fatal("Invalid TLS: ", err)
+	}
+
+	if err := validateXattrs(config.Xattrs); err != nil {
+		log.Fatal("Invalid xattrs: ", err)
+	}
+
+	if err := initThumbnails(config.Thumbnails); err != nil {
+		log.Fatal("Invalid thumbnails: ", err)
+	}
+
+	if *usersFile == "" {
+		*usersFile = config.Users
+	}
+
+	if *rootPath != "" {
+		config.Root = *rootPath
+	}
+
+	if config.Root == "" {
+		if cwd, err := os.Getwd(); err != nil {
+			log.Fatal("Unable to determine root")
+		} else {
+			config.Root = cwd
+		}
+	}
+
+	if _root, err := validateRoot(config.Root, *allowSystemRoot); err != nil {
+		log.Fatal("Invalid root: ", err)
 	} else {
 		root = _root
 	}
 
 	log.Println("Root:", root)
 
+	if *addr != "" {
+		config.Addr = *addr
+	}
+
+	cacheDir = root
+	if config.CacheDir != "" {
+		if err := os.MkdirAll(config.CacheDir, 0755); err != nil {
+			log.Fatal("Unable to create cache directory:", err)
+		}
+		cacheDir = config.CacheDir
+	}
+
 	initThumbDir()
+	initUploadDir()
+	initComments()
+	initActivity()
+	initOrder()
+	initTags()
+	initTrash()
+	initIndex()
+	initExpiry()
+
+	if *usersFile != "" {
+		initUsers(*usersFile)
+	}
+
+	if *auditFile != "" {
+		config.Audit.File = *auditFile
+	}
+
+	if config.Audit.File != "" {
+		initAudit(config.Audit)
+	}
+
+	if config.FSTimeout != nil {
+		fsTimeout = config.FSTimeout.Duration
+	}
+
+	initClock(config.Clock)
+	initCompression(config.Compression)
+	initWatchdog(config.Watchdog)
 
 	serve()
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newTestServer(tb testing.TB) *httptest.Server {
+	tb.Helper()
+	log.SetOutput(ioutil.Discard)
+
+	dir := tb.TempDir()
+	root = dir
+	cacheDir = dir
+	initThumbDir()
+
+	server := httptest.NewServer(newServeMux())
+	tb.Cleanup(server.Close)
+
+	return server
+}
+
+func testURL(server *httptest.Server, endpoint, path string) string {
+	query := url.Values{}
+	query.Set("path", path)
+	return server.URL + endpoint + "?" + query.Encode()
+}
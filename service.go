@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const launchdLabel = "com.github.iwehrman.serve"
+
+type serviceOptions struct {
+	name       string
+	configPath string
+	userMode   bool
+}
+
+// systemdQuote quotes an ExecStart argument so that paths containing spaces,
+// quotes or specifiers are passed through unchanged.
+func systemdQuote(arg string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$")
+	return `"` + replacer.Replace(arg) + `"`
+}
+
+// systemdUnit targets default.target in user mode, because the user
+// manager has neither multi-user.target nor network-online.target.
+func systemdUnit(configPath string, userMode bool) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	after := "After=network-online.target\nWants=network-online.target\n"
+	wantedBy := "multi-user.target"
+	if userMode {
+		after = ""
+		wantedBy = "default.target"
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=serve file server
+%s
+[Service]
+ExecStart=%s -config %s
+Restart=on-failure
+
+[Install]
+WantedBy=%s
+`, after, systemdQuote(executable), systemdQuote(configPath), wantedBy), nil
+}
+
+func launchdPlist(label, configPath string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%s</string>
+		<string>-config</string>
+		<string>%s</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+</dict>
+</plist>
+`, label, executable, configPath), nil
+}
+
+func parseServiceOptions(command string, args []string) *serviceOptions {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	name := flags.String("name", "serve", "service name")
+	configPath := flags.String("config", "serve.json", "path to the config file")
+	userMode := flags.Bool("user", false, "install as a per-user service")
+	flags.Parse(args)
+
+	absPath, err := filepath.Abs(*configPath)
+	if err != nil {
+		log.Fatal("Unable to resolve config path:", err)
+	}
+
+	return &serviceOptions{name: *name, configPath: absPath, userMode: *userMode}
+}
+
+func (o *serviceOptions) systemdPath() string {
+	if o.userMode {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatal("Unable to determine home directory:", err)
+		}
+		return filepath.Join(home, ".config", "systemd", "user", o.name+".service")
+	}
+
+	return filepath.Join("/etc/systemd/system", o.name+".service")
+}
+
+func (o *serviceOptions) systemctl(args ...string) error {
+	if o.userMode {
+		args = append([]string{"--user"}, args...)
+	}
+
+	return runCommand("systemctl", args...)
+}
+
+func (o *serviceOptions) launchdLabel() string {
+	if o.name == "serve" {
+		return launchdLabel
+	}
+
+	return launchdLabel + "." + o.name
+}
+
+func (o *serviceOptions) launchdPath() string {
+	if o.userMode {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatal("Unable to determine home directory:", err)
+		}
+		return filepath.Join(home, "Library", "LaunchAgents", o.launchdLabel()+".plist")
+	}
+
+	return filepath.Join("/Library/LaunchDaemons", o.launchdLabel()+".plist")
+}
+
+func runCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+func runInstallService(args []string) {
+	options := parseServiceOptions("install-service", args)
+
+	if _, err := os.Stat(options.configPath); err != nil {
+		log.Fatal("Unable to read config; run serve init first: ", err)
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		unit, err := systemdUnit(options.configPath, options.userMode)
+		if err != nil {
+			log.Fatal("Unable to generate systemd unit:", err)
+		}
+
+		unitPath := options.systemdPath()
+		if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+			log.Fatal("Unable to create unit directory:", err)
+		}
+		if err := ioutil.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+			log.Fatal("Unable to write systemd unit:", err)
+		}
+		log.Println("Wrote", unitPath)
+
+		if err := options.systemctl("daemon-reload"); err != nil {
+			log.Fatal("Unable to reload systemd:", err)
+		}
+		if err := options.systemctl("enable", "--now", options.name+".service"); err != nil {
+			log.Fatal("Unable to enable service:", err)
+		}
+	case "darwin":
+		plist, err := launchdPlist(options.launchdLabel(), options.configPath)
+		if err != nil {
+			log.Fatal("Unable to generate launchd plist:", err)
+		}
+
+		plistPath := options.launchdPath()
+		if err := os.MkdirAll(filepath.Dir(plistPath), 0755); err != nil {
+			log.Fatal("Unable to create plist directory:", err)
+		}
+		if err := ioutil.WriteFile(plistPath, []byte(plist), 0644); err != nil {
+			log.Fatal("Unable to write launchd plist:", err)
+		}
+		log.Println("Wrote", plistPath)
+
+		if err := runCommand("launchctl", "load", "-w", plistPath); err != nil {
+			log.Fatal("Unable to load service:", err)
+		}
+	default:
+		log.Fatal("Service installation is not supported on ", runtime.GOOS)
+	}
+
+	log.Printf("Installed service: %s", options.name)
+}
+
+func runUninstallService(args []string) {
+	options := parseServiceOptions("uninstall-service", args)
+
+	switch runtime.GOOS {
+	case "linux":
+		if err := options.systemctl("disable", "--now", options.name+".service"); err != nil {
+			log.Print("Unable to disable service: ", err)
+		}
+
+		unitPath := options.systemdPath()
+		if err := os.Remove(unitPath); err != nil && !os.IsNotExist(err) {
+			log.Fatal("Unable to remove systemd unit:", err)
+		}
+
+		if err := options.systemctl("daemon-reload"); err != nil {
+			log.Fatal("Unable to reload systemd:", err)
+		}
+	case "darwin":
+		plistPath := options.launchdPath()
+		if err := runCommand("launchctl", "unload", "-w", plistPath); err != nil {
+			log.Print("Unable to unload service: ", err)
+		}
+
+		if err := os.Remove(plistPath); err != nil && !os.IsNotExist(err) {
+			log.Fatal("Unable to remove launchd plist:", err)
+		}
+	default:
+		log.Fatal("Service installation is not supported on ", runtime.GOOS)
+	}
+
+	log.Printf("Uninstalled service: %s", options.name)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sharesFile = "/.shares.json"
+const sharePrefix = "/share/"
+
+type share struct {
+	ID        string     `json:"id"`
+	TokenHash string     `json:"tokenHash,omitempty"`
+	Owner     string     `json:"owner,omitempty"`
+	Path      string     `json:"path"`
+	Created   time.Time  `json:"created"`
+	Expires   *time.Time `json:"expires,omitempty"`
+}
+
+type shareCreated struct {
+	*share
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+var sharesMutex sync.Mutex
+
+func canonicalizeShares(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func getSharesPath() string {
+	return cacheDir + sharesFile
+}
+
+func loadShares() ([]*share, error) {
+	data, err := ioutil.ReadFile(getSharesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var shares []*share
+	if err := json.Unmarshal(data, &shares); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+func saveShares(shares []*share) error {
+	data, err := json.MarshalIndent(shares, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := getSharesPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, getSharesPath())
+}
+
+func findShare(token string) (*share, bool) {
+	if token == "" || strings.Contains(token, "/") {
+		return nil, false
+	}
+
+	sharesMutex.Lock()
+	shares, err := loadShares()
+	sharesMutex.Unlock()
+	if err != nil {
+		log.Print("Unable to load shares: ", err)
+		return nil, false
+	}
+
+	hash := hashDropToken(token)
+	for _, s := range shares {
+		if subtle.ConstantTimeCompare([]byte(s.TokenHash), []byte(hash)) == 1 {
+			return s, !s.expired()
+		}
+	}
+
+	return nil, false
+}
+
+func (s *share) expired() bool {
+	return s.Expires != nil && !now().Before(*s.Expires)
+}
+
+func expireShares() {
+	sharesMutex.Lock()
+	defer sharesMutex.Unlock()
+
+	shares, err := loadShares()
+	if err != nil {
+		log.Print("Unable to load shares: ", err)
+		return
+	}
+
+	current := make([]*share, 0, len(shares))
+	for _, s := range shares {
+		if !s.expired() {
+			current = append(current, s)
+		}
+	}
+
+	if len(current) == len(shares) {
+		return
+	}
+
+	if err := saveShares(current); err != nil {
+		log.Print("Unable to save shares: ", err)
+	}
+}
+
+// authenticateShare grants a request for a share link the identity of the
+// user who created it, so that the shared path maps into their home.
+func authenticateShare(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	s, ok := findShare(strings.TrimPrefix(r.URL.Path, sharePrefix))
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return r, false
+	}
+
+	ctx := context.WithValue(r.Context(), shareKey, s)
+	if s.Owner != "" && userStore != nil {
+		user, present := userStore.Get(s.Owner)
+		if !present {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return r, false
+		}
+		ctx = context.WithValue(ctx, userKey, user)
+	}
+
+	return r.WithContext(ctx), true
+}
+
+func getShareFromRequest(r *http.Request) *share {
+	s, _ := r.Context().Value(shareKey).(*share)
+	return s
+}
+
+func handleShares(w http.ResponseWriter, r *http.Request) {
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	owner := getUserName(r)
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/shares"), "/")
+
+	sharesMutex.Lock()
+	defer sharesMutex.Unlock()
+
+	shares, err := loadShares()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && id == "":
+		list := make([]share, 0, len(shares))
+		for _, s := range shares {
+			if s.Owner == owner {
+				entry := *s
+				entry.TokenHash = ""
+				list = append(list, entry)
+			}
+		}
+		writeJSON(w, http.StatusOK, list)
+	case r.Method == "POST" && id == "":
+		canonicalizeShares(r.URL)
+		path := getPathFromRequest(r)
+		if path == "/" || !isServable(path) || !isResolvedWithinRoot(mapPath(r, path)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if _, err := fsStat(getFullPathFromRequest(r)); err != nil {
+			serveError(w, err)
+			return
+		}
+
+		ttl, err := getTTLFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		shareID, err := randomHex(8)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		token, err := randomHex(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s := &share{
+			ID:        shareID,
+			TokenHash: hashDropToken(token),
+			Owner:     owner,
+			Path:      path,
+			Created:   now()}
+		if ttl > 0 {
+			expires := s.Created.Add(ttl)
+			s.Expires = &expires
+		}
+
+		if err := saveShares(append(shares, s)); err != nil {
+			serveError(w, err)
+			return
+		}
+
+		recordActivity(activityShare, owner, mapPath(r, path))
+
+		entry := *s
+		entry.TokenHash = ""
+		writeJSON(w, http.StatusCreated, &shareCreated{share: &entry, Token: token, URL: sharePrefix + token})
+	case r.Method == "DELETE" && id != "":
+		for i, s := range shares {
+			if s.ID == id && s.Owner == owner {
+				if err := saveShares(append(shares[:i], shares[i+1:]...)); err != nil {
+					serveError(w, err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		http.Error(w, "Share not found: "+id, http.StatusNotFound)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleShare serves the file behind a share link, or a zip of the
+// directory behind it.
+func handleShare(w http.ResponseWriter, r *http.Request) {
+	s := getShareFromRequest(r)
+	if s == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !isServable(s.Path) || !isResolvedWithinRoot(mapPath(r, s.Path)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	fullPath := resolvePath(mapPath(r, s.Path))
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !fileInfo.IsDir() {
+		if !isServableTarget(fullPath) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		serveFileAtPath(fullPath, &fileInfo, w, r)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/zip")
+	header.Set("Content-Disposition", formatDisposition("attachment", filepath.Base(s.Path)+".zip"))
+	header.Set("Cache-Control", "no-store")
+
+	archive := &zipArchive{writer: zip.NewWriter(w)}
+	if err := addPathToArchive(r, archive, fullPath, getArchivePrefix(s.Path)); err != nil {
+		log.Printf("Unable to write shared zip %s: %v", s.Path, err)
+		return
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Print("Unable to finish zip archive: ", err)
+	}
+}
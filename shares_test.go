@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShareCannotEscapeRoot(t *testing.T) {
+	server := newTestServer(t)
+	enableFeature(t, featureWrite)
+
+	outside := root
+	root = filepath.Join(outside, "served")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.Post(server.URL+"/shares?path=/../secret.txt", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		return
+	}
+
+	var created struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	shared, err := http.Get(server.URL + created.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Body.Close()
+
+	body, _ := ioutil.ReadAll(shared.Body)
+	if shared.StatusCode == http.StatusOK && strings.Contains(string(body), "secret") {
+		t.Errorf("GET %s served a file outside the root", created.URL)
+	}
+}
+
+func TestDropCannotEscapeRoot(t *testing.T) {
+	server := newTestServer(t)
+	enableFeature(t, featureWrite)
+
+	outside := root
+	root = filepath.Join(outside, "served")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.Post(server.URL+"/drops?path=/..", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		return
+	}
+
+	var created struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped, err := http.Post(server.URL+created.URL+"?name=x.txt", "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped.Body.Close()
+
+	if _, err := os.Stat(filepath.Join(outside, "x.txt")); err == nil {
+		t.Errorf("POST %s wrote a file outside the root", created.URL)
+	}
+}
+
+func TestDroppedHTMLIsSandboxed(t *testing.T) {
+	server := newTestServer(t)
+	enableFeature(t, featureWrite)
+
+	response, err := http.Post(server.URL+"/drops?path=/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var created struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped, err := http.Post(server.URL+created.URL+"?name=page.html", "text/html", strings.NewReader("<script>alert(1)</script>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped.Body.Close()
+	if dropped.StatusCode != http.StatusCreated {
+		t.Fatalf("POST %s: %s, want 201", created.URL, dropped.Status)
+	}
+
+	read, err := http.Get(testURL(server, "/read", "/page.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read.Body.Close()
+
+	if policy := read.Header.Get("Content-Security-Policy"); policy != "sandbox" {
+		t.Errorf("Content-Security-Policy: %q, want sandbox", policy)
+	}
+	if options := read.Header.Get("X-Content-Type-Options"); options != "nosniff" {
+		t.Errorf("X-Content-Type-Options: %q, want nosniff", options)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var pairRanks = map[string]int{
+	".jpg":  0,
+	".jpeg": 0,
+	".heic": 0,
+	".heif": 0,
+	".png":  0,
+	".webp": 0,
+	".gif":  0,
+	".dng":  1,
+	".cr2":  1,
+	".cr3":  1,
+	".nef":  1,
+	".arw":  1,
+	".raf":  1,
+	".orf":  1,
+	".rw2":  1,
+	".pef":  1,
+	".mov":  2,
+	".mp4":  2,
+	".xmp":  3,
+}
+
+func hasPairs(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["pairs"]
+	return present
+}
+
+func canonicalizePairs(query url.Values) bool {
+	return canonicalizeBoolean(query, "pairs")
+}
+
+func hasSidecars(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["sidecars"]
+	return present
+}
+
+func canonicalizeSidecars(query url.Values) bool {
+	return canonicalizeBoolean(query, "sidecars")
+}
+
+func getPairKey(name string) (string, int, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	rank, present := pairRanks[ext]
+	if !present {
+		return "", 0, false
+	}
+
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	if ext == ".xmp" {
+		if inner := strings.ToLower(filepath.Ext(stem)); inner != "" {
+			if _, present := pairRanks[inner]; present {
+				stem = strings.TrimSuffix(stem, filepath.Ext(stem))
+			}
+		}
+	}
+
+	return strings.ToLower(stem), rank, true
+}
+
+func groupPairs(stats []*Stats) []*Stats {
+	groups := make(map[string][]*Stats)
+	ranks := make(map[*Stats]int)
+
+	for _, stat := range stats {
+		if stat.IsDir {
+			continue
+		}
+
+		if key, rank, ok := getPairKey(stat.Name); ok {
+			groups[key] = append(groups[key], stat)
+			ranks[stat] = rank
+		}
+	}
+
+	absorbed := make(map[*Stats]bool)
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+
+		sort.Slice(members, func(i, j int) bool {
+			if ranks[members[i]] != ranks[members[j]] {
+				return ranks[members[i]] < ranks[members[j]]
+			}
+			return members[i].Name < members[j].Name
+		})
+
+		primary := members[0]
+		for _, member := range members[1:] {
+			if ranks[member] > ranks[primary] {
+				primary.Sidecars = append(primary.Sidecars, member)
+				absorbed[member] = true
+			}
+		}
+	}
+
+	grouped := make([]*Stats, 0, len(stats)-len(absorbed))
+	for _, stat := range stats {
+		if !absorbed[stat] {
+			grouped = append(grouped, stat)
+		}
+	}
+
+	return grouped
+}
+
+func getSidecarPaths(r *http.Request, path string) []string {
+	dirPath := filepath.Dir(path)
+	dirFullPath := resolvePath(mapPath(r, dirPath))
+
+	stats, err := listDirectory(r, dirFullPath, dirPath)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, stat := range groupPairs(stats) {
+		if stat.Path == path {
+			for _, sidecar := range stat.Sidecars {
+				paths = append(paths, sidecar.Path)
+			}
+		}
+	}
+
+	return paths
+}
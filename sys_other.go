@@ -0,0 +1,23 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+func syncDir(dir string) error {
+	return nil
+}
+
+func linkCount(fileInfo os.FileInfo) uint64 {
+	return 0
+}
+
+func fileOwner(fileInfo os.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+func fileIdentity(fileInfo os.FileInfo) (uint64, uint64, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const tagsFile = "/.tags.json"
+const maxTagLength = 64
+const maxTagsPerFile = 100
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+var tagsMutex sync.Mutex
+var tags = make(map[string][]string)
+
+func getTagsPath() string {
+	return cacheDir + tagsFile
+}
+
+func initTags() {
+	data, err := ioutil.ReadFile(getTagsPath())
+	if err == nil {
+		err = json.Unmarshal(data, &tags)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal("Unable to load tags file:", err)
+	}
+}
+
+func saveTags() error {
+	data, err := json.MarshalIndent(tags, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := getTagsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, getTagsPath())
+}
+
+func getTags(globalPath string) []string {
+	tagsMutex.Lock()
+	defer tagsMutex.Unlock()
+
+	return tags[globalPath]
+}
+
+func hasTags(globalPath string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+
+	tagsMutex.Lock()
+	defer tagsMutex.Unlock()
+
+	for _, tag := range wanted {
+		if !containsTag(tags[globalPath], tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsTag(list []string, tag string) bool {
+	i := sort.SearchStrings(list, tag)
+	return i < len(list) && list[i] == tag
+}
+
+func validateTag(tag string) bool {
+	if tag == "" || len(tag) > maxTagLength || strings.TrimSpace(tag) != tag || strings.ContainsRune(tag, ',') {
+		return false
+	}
+
+	for _, r := range tag {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getTagsFromRequest(r *http.Request) []string {
+	return r.URL.Query()["tag"]
+}
+
+func canonicalizeTags(query url.Values) bool {
+	if _, present := query["tag"]; !present {
+		return true
+	}
+
+	seen := make(map[string]bool)
+	var list []string
+	for _, tag := range query["tag"] {
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			list = append(list, tag)
+		}
+	}
+	sort.Strings(list)
+
+	if len(list) == len(query["tag"]) && sort.StringsAreSorted(query["tag"]) {
+		return true
+	}
+
+	if len(list) == 0 {
+		query.Del("tag")
+	} else {
+		query["tag"] = list
+	}
+
+	return false
+}
+
+func canonicalizeTagsURL(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeTags(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func clearTags(globalPath string) {
+	tagsMutex.Lock()
+	defer tagsMutex.Unlock()
+
+	changed := false
+	for path := range tags {
+		if isWithin(path, globalPath) {
+			delete(tags, path)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := saveTags(); err != nil {
+			log.Print("Unable to save tags file: ", err)
+		}
+	}
+}
+
+func moveTags(src, dst string) {
+	tagsMutex.Lock()
+	defer tagsMutex.Unlock()
+
+	moved := make(map[string][]string)
+	for path, list := range tags {
+		if isWithin(path, src) {
+			moved[dst+strings.TrimPrefix(path, src)] = list
+			delete(tags, path)
+		} else if isWithin(path, dst) {
+			delete(tags, path)
+		}
+	}
+
+	if len(moved) == 0 {
+		return
+	}
+
+	for path, list := range moved {
+		tags[path] = list
+	}
+
+	if err := saveTags(); err != nil {
+		log.Print("Unable to save tags file: ", err)
+	}
+}
+
+func handleTags(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if !canonicalizeTagsURL(r.URL) && allowsRedirects(r) {
+			redirect(w, r)
+			return
+		}
+		if len(getTagsFromRequest(r)) == 0 {
+			listTags(w, r)
+		} else {
+			searchTags(w, r)
+		}
+	case "POST", "DELETE":
+		if !requireFeature(w, r, featureWrite) {
+			return
+		}
+		canonicalizeTagsURL(r.URL)
+		updateTags(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listTags counts the tags in use at or below the requested path.
+func listTags(w http.ResponseWriter, r *http.Request) {
+	global := getGlobalPathFromRequest(r)
+
+	counts := make(map[string]int)
+	tagsMutex.Lock()
+	for path, list := range tags {
+		if isWithin(path, global) {
+			for _, tag := range list {
+				counts[tag]++
+			}
+		}
+	}
+	tagsMutex.Unlock()
+
+	list := make([]*tagCount, 0, len(counts))
+	for tag, count := range counts {
+		list = append(list, &tagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Tag < list[j].Tag
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, list)
+}
+
+// searchTags returns the Stats of every file at or below the requested path
+// that carries all of the requested tags.
+func searchTags(w http.ResponseWriter, r *http.Request) {
+	global := getGlobalPathFromRequest(r)
+	wanted := getTagsFromRequest(r)
+
+	var paths []string
+	tagsMutex.Lock()
+	for path := range tags {
+		if isWithin(path, global) {
+			paths = append(paths, path)
+		}
+	}
+	tagsMutex.Unlock()
+	sort.Strings(paths)
+
+	stats := make([]*Stats, 0)
+	for _, path := range paths {
+		if !hasTags(path, wanted) {
+			continue
+		}
+
+		virtualPath, ok := unmapPath(r, path)
+		if !ok {
+			continue
+		}
+
+		fullPath := resolvePath(path)
+		info, err := fsLstat(fullPath)
+		if err != nil {
+			continue
+		}
+		stats = append(stats, newStats(r, fullPath, virtualPath, info))
+	}
+
+	encodedStats, err := marshalStatsList(r, stats)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Cache-Control", "no-store")
+	if count, err := w.Write(encodedStats); err != nil {
+		log.Printf("Only wrote %v bytes before error: %v\n", count, err)
+	}
+}
+
+func updateTags(w http.ResponseWriter, r *http.Request) {
+	global := getGlobalPathFromRequest(r)
+	requested := getTagsFromRequest(r)
+
+	if _, err := fsLstat(resolvePath(global)); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !checkLock(w, r, global) {
+		return
+	}
+
+	for _, tag := range requested {
+		if !validateTag(tag) {
+			http.Error(w, "Invalid tag: "+tag, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if r.Method == "POST" && len(requested) == 0 {
+		http.Error(w, "Missing tag", http.StatusBadRequest)
+		return
+	}
+
+	tagsMutex.Lock()
+	var list []string
+	if r.Method == "POST" {
+		list = append([]string{}, tags[global]...)
+		for _, tag := range requested {
+			if !containsTag(list, tag) {
+				list = append(list, tag)
+				sort.Strings(list)
+			}
+		}
+	} else if len(requested) > 0 {
+		for _, tag := range tags[global] {
+			if !containsTag(requested, tag) {
+				list = append(list, tag)
+			}
+		}
+	}
+
+	if len(list) > maxTagsPerFile {
+		tagsMutex.Unlock()
+		http.Error(w, "Too many tags", http.StatusBadRequest)
+		return
+	}
+
+	if len(list) == 0 {
+		delete(tags, global)
+	} else {
+		tags[global] = list
+	}
+	err := saveTags()
+	tagsMutex.Unlock()
+
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if list == nil {
+		list = []string{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+const defaultTheme = "auto"
+const themeCookie = "theme"
+const themeCookieMaxAge = 365 * 24 * 60 * 60
+
+var builtinThemes = []string{"auto", "light", "dark"}
+
+func themeNames() []string {
+	configMutex.RLock()
+	custom := config.UI.Themes
+	configMutex.RUnlock()
+
+	names := append([]string{}, builtinThemes...)
+	var extra []string
+	for name := range custom {
+		if !isBuiltinTheme(name) {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+
+	return append(names, extra...)
+}
+
+func isBuiltinTheme(name string) bool {
+	for _, builtin := range builtinThemes {
+		if builtin == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isKnownTheme(name string) bool {
+	configMutex.RLock()
+	_, custom := config.UI.Themes[name]
+	configMutex.RUnlock()
+
+	return custom || isBuiltinTheme(name)
+}
+
+func hasTheme(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["theme"]
+	return present
+}
+
+func selectTheme(w http.ResponseWriter, r *http.Request, canonicalize func(*url.URL) bool) {
+	query := r.URL.Query()
+	name := query.Get("theme")
+
+	if isKnownTheme(name) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     themeCookie,
+			Value:    name,
+			Path:     "/",
+			MaxAge:   themeCookieMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode})
+	}
+
+	query.Del("theme")
+	r.URL.RawQuery = query.Encode()
+	canonicalize(r.URL)
+
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+func getThemeFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie(themeCookie); err == nil && isKnownTheme(cookie.Value) {
+		return cookie.Value
+	}
+
+	configMutex.RLock()
+	configured := config.UI.Theme
+	configMutex.RUnlock()
+
+	if isKnownTheme(configured) {
+		return configured
+	}
+
+	return defaultTheme
+}
+
+func loadThemeStyle(name string) template.CSS {
+	base, err := uiFiles.ReadFile("ui/base.css")
+	if err != nil {
+		log.Print("Unable to read base stylesheet: ", err)
+	}
+
+	configMutex.RLock()
+	customPath, custom := config.UI.Themes[name]
+	configMutex.RUnlock()
+
+	var theme []byte
+	if custom {
+		theme, err = ioutil.ReadFile(customPath)
+	} else {
+		theme, err = uiFiles.ReadFile("ui/themes/" + name + ".css")
+	}
+
+	if err != nil {
+		log.Printf("Unable to read theme %s: %v", name, err)
+		theme, _ = uiFiles.ReadFile("ui/themes/" + defaultTheme + ".css")
+	}
+
+	return template.CSS(string(base) + "\n" + string(theme))
+}
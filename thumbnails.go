@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const maxThumbnailBatch = 500
+const maxThumbnailRequestSize = 1024 * 1024
+
+var errNoPreview = errors.New("No preview available")
+
+type thumbnailsRequest struct {
+	Paths  []string `json:"paths"`
+	Retina bool     `json:"retina,omitempty"`
+	Size   int      `json:"size,omitempty"`
+}
+
+func handleThumbnails(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request thumbnailsRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxThumbnailRequestSize)).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if request.Size == 0 {
+		request.Size = defaultThumbSize
+	}
+	if !isAllowedThumbSize(request.Size) {
+		http.Error(w, "Invalid size", http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Paths) > maxThumbnailBatch {
+		http.Error(w, "Too many paths", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	writer := multipart.NewWriter(w)
+	header := w.Header()
+	header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	header.Set("Cache-Control", "no-store")
+	header.Set("Access-Control-Allow-Origin", "*")
+
+	for _, path := range request.Paths {
+		if err := r.Context().Err(); err != nil {
+			return
+		}
+
+		if err := writeThumbnailPart(writer, r, filepath.Join("/", path), request.Retina, request.Size); err != nil {
+			log.Print("Unable to write thumbnail batch: ", err)
+			return
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Print("Unable to write thumbnail batch: ", err)
+	}
+}
+
+func writeThumbnailPart(writer *multipart.Writer, r *http.Request, path string, retina bool, size int) error {
+	query := thumbnailQuery(path, retina, size)
+	partHeader := make(textproto.MIMEHeader)
+	partHeader.Set("Content-Location", "/read?"+query.Encode())
+
+	thumbPath, status, err := makeBatchThumb(r, path, query)
+	if err != nil {
+		return writeThumbnailError(writer, partHeader, status, err.Error())
+	}
+
+	file, err := os.Open(thumbPath)
+	if err != nil {
+		return writeThumbnailError(writer, partHeader, http.StatusInternalServerError, err.Error())
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return writeThumbnailError(writer, partHeader, http.StatusInternalServerError, err.Error())
+	}
+
+	contentType := contentTypeForName(thumbPath)
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	partHeader.Set("Content-Type", contentType)
+	partHeader.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	partHeader.Set("ETag", fileETag(info))
+
+	part, err := writer.CreatePart(partHeader)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(part, file)
+	return err
+}
+
+func thumbnailQuery(path string, retina bool, size int) url.Values {
+	query := url.Values{}
+	query.Set("path", path)
+	query.Set("preview", "1")
+	if retina {
+		query.Set("retina", "1")
+	}
+	if size != defaultThumbSize {
+		query.Set("size", strconv.Itoa(size))
+	}
+
+	return query
+}
+
+func makeBatchThumb(r *http.Request, path string, query url.Values) (string, int, error) {
+	if !isServable(path) {
+		return "", http.StatusForbidden, os.ErrPermission
+	}
+
+	if previewerForName(path) != previewerThumbnail {
+		return "", http.StatusNotFound, errNoPreview
+	}
+
+	request, err := http.NewRequestWithContext(r.Context(), "GET", "/read?"+query.Encode(), nil)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	if _, err := fsStat(getFullPathFromRequest(request)); err != nil {
+		return "", errorStatus(err), err
+	}
+
+	thumbPath, _, err := makeThumb(request)
+	if err != nil {
+		return "", errorStatus(err), err
+	}
+
+	return thumbPath, http.StatusOK, nil
+}
+
+func writeThumbnailError(writer *multipart.Writer, partHeader textproto.MIMEHeader, status int, message string) error {
+	partHeader.Set("Content-Type", "text/plain; charset=utf-8")
+	partHeader.Set("Status", strconv.Itoa(status)+" "+http.StatusText(status))
+
+	part, err := writer.CreatePart(partHeader)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(part, message)
+	return err
+}
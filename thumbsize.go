@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/iwehrman/serve/convert"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const defaultThumbSize = 200
+
+var defaultThumbSizes = []int{64, 128, 200, 400, 800, 1024}
+
+type ThumbnailConfig struct {
+	Sizes   []int  `json:"sizes,omitempty"`
+	Backend string `json:"backend,omitempty"`
+}
+
+func initThumbnails(c ThumbnailConfig) error {
+	requested := c.Backend
+	if requested == "" {
+		requested = convert.BackendImageMagick
+	}
+
+	selected, err := convert.SelectThumbnailBackend(requested)
+	if err != nil {
+		return err
+	}
+
+	if selected != requested {
+		log.Printf("Thumbnail backend %s is not installed; using %s", requested, selected)
+	}
+
+	return nil
+}
+
+func getThumbSizes() []int {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	if len(config.Thumbnails.Sizes) > 0 {
+		return config.Thumbnails.Sizes
+	}
+
+	return defaultThumbSizes
+}
+
+func isAllowedThumbSize(size int) bool {
+	for _, allowed := range getThumbSizes() {
+		if size == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonicalizeThumbSize drops an explicit request for the default size so
+// that it shares a URL with plain preview requests.
+func canonicalizeThumbSize(query url.Values) bool {
+	if query.Get("size") == strconv.Itoa(defaultThumbSize) {
+		query.Del("size")
+		return false
+	}
+
+	return canonicalizeCount(query, "size", 0)
+}
+
+func getThumbSize(r *http.Request) int {
+	return getCount(r, "size", defaultThumbSize)
+}
+
+func getThumbDimension(r *http.Request) int {
+	if hasRetina(r) {
+		return 2 * getThumbSize(r)
+	}
+
+	return getThumbSize(r)
+}
+
+// thumbDirForDimension keeps the historical directories for the 200 and
+// 400 pixel thumbnails and gives every other dimension its own directory.
+func thumbDirForDimension(dimension int) string {
+	switch dimension {
+	case defaultThumbSize:
+		return thumbDir
+	case 2 * defaultThumbSize:
+		return retinaThumbDir
+	default:
+		return thumbDir + "-" + strconv.Itoa(dimension)
+	}
+}
+
+func isSizedThumbPath(fullPath string) bool {
+	rest := strings.TrimPrefix(fullPath, cacheDir+thumbDir+"-")
+	if rest == fullPath {
+		return false
+	}
+
+	_, err := strconv.Atoi(strings.SplitN(rest, "/", 2)[0])
+	return err == nil
+}
+
+func listThumbDirs() []string {
+	dirs := []string{thumbDir, retinaThumbDir}
+	seen := map[string]bool{thumbDir: true, retinaThumbDir: true}
+	for _, size := range getThumbSizes() {
+		for _, dimension := range []int{size, 2 * size} {
+			if dir := thumbDirForDimension(dimension); !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+
+	return dirs
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	timeFormatUnixMs  = "unixms"
+	timeFormatRFC3339 = "rfc3339"
+)
+
+var statsTimeFields = []string{"mtime", "btime", "expires"}
+
+var statsNestedFields = []string{"sidecars", "burst"}
+
+func getTimeFormat(r *http.Request) string {
+	return r.URL.Query().Get("time")
+}
+
+func canonicalizeTimeFormat(query url.Values) bool {
+	if _, present := query["time"]; !present {
+		return true
+	}
+
+	format := query.Get("time")
+	valid := format == timeFormatUnixMs || format == timeFormatRFC3339
+	if valid && len(query["time"]) == 1 {
+		return true
+	}
+
+	if valid {
+		query.Set("time", format)
+	} else {
+		query.Del("time")
+	}
+
+	return false
+}
+
+func formatTimeValue(t time.Time, format string) interface{} {
+	if format == timeFormatUnixMs {
+		return t.UnixMilli()
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// formatStatsTimes rewrites the timestamps of an encoded Stats, including
+// those of its sidecars and burst members, in the requested format.
+func formatStatsTimes(all map[string]json.RawMessage, format string) error {
+	for _, field := range statsTimeFields {
+		raw, present := all[field]
+		if !present {
+			continue
+		}
+
+		var t time.Time
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(formatTimeValue(t, format))
+		if err != nil {
+			return err
+		}
+		all[field] = encoded
+	}
+
+	for _, field := range statsNestedFields {
+		raw, present := all[field]
+		if !present {
+			continue
+		}
+
+		var nested []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &nested); err != nil {
+			return err
+		}
+
+		for _, stat := range nested {
+			if err := formatStatsTimes(stat, format); err != nil {
+				return err
+			}
+		}
+
+		encoded, err := json.Marshal(nested)
+		if err != nil {
+			return err
+		}
+		all[field] = encoded
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func newTLSConfig(c TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:             tls.VersionTLS12,
+		SessionTicketsDisabled: c.DisableSessionTickets}
+
+	if c.MinVersion != "" {
+		version, present := tlsVersions[c.MinVersion]
+		if !present {
+			return nil, fmt.Errorf("unsupported minVersion: %s", c.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(c.Ciphers) > 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+
+		for _, name := range c.Ciphers {
+			id, present := suites[name]
+			if !present {
+				return nil, fmt.Errorf("unsupported cipher: %s", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+
+	return tlsConfig, nil
+}
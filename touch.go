@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+func hasNoCreate(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["nocreate"]
+	return present
+}
+
+func canonicalizeNoCreate(query url.Values) bool {
+	return canonicalizeBoolean(query, "nocreate")
+}
+
+func canonicalizeTouch(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeNoCreate(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func getTouchTime(r *http.Request) (time.Time, error) {
+	value := r.URL.Query().Get("time")
+	if value == "" {
+		return now(), nil
+	}
+
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func handleTouch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeTouch(r.URL)
+
+	mtime, err := getTouchTime(r)
+	if err != nil {
+		http.Error(w, "Invalid time: "+r.URL.Query().Get("time"), http.StatusBadRequest)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+	if isCachePath(fullPath) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	fileInfo, err := fsLstat(fullPath)
+	if err != nil && (!os.IsNotExist(err) || hasNoCreate(r)) {
+		serveError(w, err)
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, path)) {
+		return
+	}
+
+	created := fileInfo == nil
+	err = runWithTimeout("touch", fullPath, func() error {
+		if created {
+			file, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			if err != nil {
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+		}
+
+		return os.Chtimes(fullPath, mtime, mtime)
+	})
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	fileInfo, err = fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	writeJSON(w, status, newStats(r, fullPath, path, fileInfo))
+}
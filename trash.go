@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const trashDir = "/.trash"
+const trashFile = "/.trash.json"
+const trashKeyPrefix = "trash:"
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+type TrashConfig struct {
+	Disabled  bool     `json:"disabled,omitempty"`
+	Retention Duration `json:"retention,omitzero"`
+}
+
+type trashEntry struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"`
+	User    string    `json:"user,omitempty"`
+	Deleted time.Time `json:"deleted"`
+	IsDir   bool      `json:"isDir"`
+	Size    int64     `json:"size"`
+}
+
+type trashItem struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	User    string    `json:"user,omitempty"`
+	Deleted time.Time `json:"deleted"`
+	Purge   time.Time `json:"purge"`
+	IsDir   bool      `json:"isDir"`
+	Size    int64     `json:"size"`
+}
+
+var trashMutex sync.Mutex
+var trash []*trashEntry
+
+func hasIncludeDeleted(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["include_deleted"]
+	return present
+}
+
+func canonicalizeIncludeDeleted(query url.Values) bool {
+	return canonicalizeBoolean(query, "include_deleted")
+}
+
+func getTrashConfig() TrashConfig {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return config.Trash
+}
+
+func getTrashRetention() time.Duration {
+	if retention := getTrashConfig().Retention.Duration; retention > 0 {
+		return retention
+	}
+
+	return defaultTrashRetention
+}
+
+func getTrashFilePath() string {
+	return cacheDir + trashFile
+}
+
+func getTrashItemPath(id string) string {
+	return cacheDir + trashDir + "/" + id
+}
+
+// getTrashKey names a trashed item in the comment, tag, order and expiry
+// stores. It is not a global path, so nothing else can collide with it.
+func getTrashKey(id string) string {
+	return trashKeyPrefix + id
+}
+
+func isTrashKey(key string) bool {
+	return strings.HasPrefix(key, trashKeyPrefix)
+}
+
+func moveMetadata(src, dst string) {
+	moveExpiry(src, dst)
+	moveComments(src, dst)
+	moveOrder(src, dst)
+	moveTags(src, dst)
+}
+
+func clearMetadata(key string) {
+	clearExpiry(key)
+	clearComments(key)
+	clearOrder(key)
+	clearTags(key)
+}
+
+func initTrash() {
+	if err := os.MkdirAll(cacheDir+trashDir, 0700); err != nil {
+		log.Fatal("Unable to create trash directory:", err)
+	}
+
+	data, err := ioutil.ReadFile(getTrashFilePath())
+	if err == nil {
+		err = json.Unmarshal(data, &trash)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal("Unable to load trash file:", err)
+	}
+}
+
+func saveTrash() error {
+	data, err := json.MarshalIndent(trash, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := getTrashFilePath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, getTrashFilePath())
+}
+
+func moveToTrash(r *http.Request, fullPath string, fileInfo os.FileInfo) error {
+	if fileInfo.IsDir() && !hasRecursive(r) {
+		infos, err := fsReadDir(fullPath)
+		if err != nil {
+			return err
+		}
+		if len(infos) > 0 {
+			return &os.PathError{Op: "remove", Path: fullPath, Err: syscall.ENOTEMPTY}
+		}
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+
+	// The entry is recorded first so that a rename that completes after
+	// the timeout still leaves a trashed item that can be restored or purged.
+	trashMutex.Lock()
+	trash = append(trash, &trashEntry{
+		ID:      id,
+		Path:    getGlobalPathFromRequest(r),
+		User:    getUserName(r),
+		Deleted: now(),
+		IsDir:   fileInfo.IsDir(),
+		Size:    fileInfo.Size()})
+	err = saveTrash()
+	trashMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = runWithTimeout("trash", fullPath, func() error {
+		return movePath(fullPath, getTrashItemPath(id), fileInfo, false)
+	})
+	if err != nil {
+		if !isTimeout(err) {
+			trashMutex.Lock()
+			removeTrashEntry(id)
+			if saveErr := saveTrash(); saveErr != nil {
+				log.Print("Unable to save trash file: ", saveErr)
+			}
+			trashMutex.Unlock()
+		}
+		return err
+	}
+
+	moveMetadata(getGlobalPathFromRequest(r), getTrashKey(id))
+	return nil
+}
+
+func removeTrashEntry(id string) *trashEntry {
+	for i, entry := range trash {
+		if entry.ID == id {
+			trash = append(trash[:i:i], trash[i+1:]...)
+			return entry
+		}
+	}
+
+	return nil
+}
+
+func purgeTrash() {
+	trashMutex.Lock()
+	defer trashMutex.Unlock()
+
+	cutoff := now().Add(-getTrashRetention())
+	current := make([]*trashEntry, 0, len(trash))
+	for _, entry := range trash {
+		if entry.Deleted.After(cutoff) {
+			current = append(current, entry)
+			continue
+		}
+
+		if err := os.RemoveAll(getTrashItemPath(entry.ID)); err != nil {
+			log.Printf("Unable to purge trashed %s: %v", entry.Path, err)
+			current = append(current, entry)
+			continue
+		}
+		clearMetadata(getTrashKey(entry.ID))
+		log.Printf("Purged trashed %s", entry.Path)
+	}
+
+	if len(current) == len(trash) {
+		return
+	}
+
+	trash = current
+	if err := saveTrash(); err != nil {
+		log.Print("Unable to save trash file: ", err)
+	}
+}
+
+// listTrashedEntries returns the trashed entries whose original parent is
+// dirPath, flagged as deleted.
+func listTrashedEntries(r *http.Request, dirPath string) ([]*Stats, error) {
+	parent := mapPath(r, dirPath)
+
+	trashMutex.Lock()
+	entries := make([]*trashEntry, 0)
+	for _, entry := range trash {
+		if filepath.Dir(entry.Path) == parent {
+			entries = append(entries, entry)
+		}
+	}
+	trashMutex.Unlock()
+
+	stats := make([]*Stats, 0, len(entries))
+	for _, entry := range entries {
+		itemPath := getTrashItemPath(entry.ID)
+		info, err := fsLstat(itemPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		name := filepath.Base(entry.Path)
+		stat := newStats(r, itemPath, filepath.Join(dirPath, name), info)
+		stat.Name = name
+		stat.Deleted = true
+		stat.TrashID = entry.ID
+		stat.URLs = nil
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+func newTrashItem(entry *trashEntry, path string, retention time.Duration) *trashItem {
+	return &trashItem{
+		ID:      entry.ID,
+		Name:    filepath.Base(path),
+		Path:    path,
+		User:    entry.User,
+		Deleted: entry.Deleted,
+		Purge:   entry.Deleted.Add(retention),
+		IsDir:   entry.IsDir,
+		Size:    entry.Size}
+}
+
+func handleTrash(w http.ResponseWriter, r *http.Request) {
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/trash"), "/")
+
+	switch {
+	case r.Method == "GET" && id == "":
+		listTrash(w, r)
+	case r.Method == "DELETE" && id == "":
+		emptyTrash(w, r)
+	case r.Method == "POST" && id != "":
+		restoreTrash(w, r, id)
+	case r.Method == "DELETE" && id != "":
+		purgeTrashEntry(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listTrash(w http.ResponseWriter, r *http.Request) {
+	retention := getTrashRetention()
+
+	trashMutex.Lock()
+	items := make([]*trashItem, 0, len(trash))
+	for _, entry := range trash {
+		if path, ok := unmapPath(r, entry.Path); ok {
+			items = append(items, newTrashItem(entry, path, retention))
+		}
+	}
+	trashMutex.Unlock()
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Deleted.After(items[j].Deleted)
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, items)
+}
+
+func emptyTrash(w http.ResponseWriter, r *http.Request) {
+	trashMutex.Lock()
+	defer trashMutex.Unlock()
+
+	current := make([]*trashEntry, 0, len(trash))
+	for _, entry := range trash {
+		if _, ok := unmapPath(r, entry.Path); !ok {
+			current = append(current, entry)
+			continue
+		}
+
+		if err := os.RemoveAll(getTrashItemPath(entry.ID)); err != nil {
+			log.Printf("Unable to purge trashed %s: %v", entry.Path, err)
+			current = append(current, entry)
+			continue
+		}
+		clearMetadata(getTrashKey(entry.ID))
+	}
+
+	trash = current
+	if err := saveTrash(); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func findTrashEntry(r *http.Request, id string) (*trashEntry, bool) {
+	for _, entry := range trash {
+		if entry.ID == id {
+			_, ok := unmapPath(r, entry.Path)
+			return entry, ok
+		}
+	}
+
+	return nil, false
+}
+
+func purgeTrashEntry(w http.ResponseWriter, r *http.Request, id string) {
+	trashMutex.Lock()
+	defer trashMutex.Unlock()
+
+	if _, ok := findTrashEntry(r, id); !ok {
+		http.Error(w, "Trashed item not found: "+id, http.StatusNotFound)
+		return
+	}
+
+	if err := os.RemoveAll(getTrashItemPath(id)); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	removeTrashEntry(id)
+	clearMetadata(getTrashKey(id))
+	if err := saveTrash(); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func restoreTrash(w http.ResponseWriter, r *http.Request, id string) {
+	trashMutex.Lock()
+	defer trashMutex.Unlock()
+
+	entry, ok := findTrashEntry(r, id)
+	if !ok {
+		http.Error(w, "Trashed item not found: "+id, http.StatusNotFound)
+		return
+	}
+
+	path, _ := unmapPath(r, entry.Path)
+	if target := r.URL.Query().Get("target"); target != "" {
+		path = filepath.Join("/", target)
+	}
+
+	global := mapPath(r, path)
+	fullPath := resolvePath(global)
+	if isProtectedPath(r, path, fullPath) {
+		http.Error(w, "Refusing to modify protected path", http.StatusForbidden)
+		return
+	}
+
+	if !checkLock(w, r, global) {
+		return
+	}
+
+	itemPath := getTrashItemPath(id)
+	info, err := fsLstat(itemPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	err = runWithTimeout("restore", fullPath, func() error {
+		return movePath(itemPath, fullPath, info, false)
+	})
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	removeTrashEntry(id)
+	if err := saveTrash(); err != nil {
+		log.Print("Unable to save trash file: ", err)
+	}
+
+	removeThumbnails(global)
+	moveMetadata(getTrashKey(id), global)
+
+	restored, err := fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newStats(r, fullPath, path, restored))
+}
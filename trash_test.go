@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func enableFeature(t *testing.T, name string) {
+	t.Helper()
+
+	configMutex.Lock()
+	previous := config.Features
+	config.Features = map[string]FeatureFlag{name: {Enabled: true}}
+	configMutex.Unlock()
+
+	t.Cleanup(func() {
+		configMutex.Lock()
+		config.Features = previous
+		configMutex.Unlock()
+	})
+}
+
+func TestRestoredTrashKeepsMetadata(t *testing.T) {
+	server := newTestServer(t)
+	enableFeature(t, featureWrite)
+
+	trash = nil
+	tags = make(map[string][]string)
+	initTrash()
+
+	if err := ioutil.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tags["/notes.txt"] = []string{"keep"}
+
+	response, err := http.Post(testURL(server, "/delete", "/notes.txt"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST /delete: %s, want 204", response.Status)
+	}
+
+	if len(trash) != 1 {
+		t.Fatalf("%d trashed items, want 1", len(trash))
+	}
+	if list := getTags("/notes.txt"); len(list) != 0 {
+		t.Errorf("tags of a trashed path: %v, want none", list)
+	}
+
+	response, err = http.Post(server.URL+"/trash/"+trash[0].ID, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("POST /trash: %s, want 200", response.Status)
+	}
+
+	if list := getTags("/notes.txt"); len(list) != 1 || list[0] != "keep" {
+		t.Errorf("tags after restore: %v, want [keep]", list)
+	}
+}
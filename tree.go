@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+)
+
+type treeNode struct {
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	Mtime    time.Time   `json:"mtime"`
+	Children []*treeNode `json:"children"`
+}
+
+func canonicalizeTree(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeHidden(query) && canon
+	canon = canonicalizeGitignore(query) && canon
+	canon = canonicalizeDepth(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleTree(w http.ResponseWriter, r *http.Request) {
+	canon := canonicalizeTree(r.URL)
+	if !canon && allowsRedirects(r) {
+		redirect(w, r)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !fileInfo.IsDir() {
+		http.Error(w, "Not a directory", http.StatusBadRequest)
+		return
+	}
+
+	root := &treeNode{Name: filepath.Base(path), Path: path, Mtime: modTime(fileInfo)}
+	count := 0
+	if err := buildTree(r, root, fullPath, getDepth(r), &count); errors.Is(err, errTooManyEntries) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", "*")
+	header.Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, root)
+}
+
+func buildTree(r *http.Request, node *treeNode, fullPath string, depth int, count *int) error {
+	if err := r.Context().Err(); err != nil {
+		return err
+	}
+
+	stats, err := listDirectory(r, fullPath, node.Path)
+	if err != nil {
+		return err
+	}
+
+	node.Children = make([]*treeNode, 0)
+	for _, stat := range stats {
+		if !stat.IsDir || stat.IsLink || stat.Deleted {
+			continue
+		}
+
+		*count++
+		if *count > maxReaddirEntries {
+			return errTooManyEntries
+		}
+
+		child := &treeNode{Name: stat.Name, Path: stat.Path, Mtime: stat.Mtime}
+		node.Children = append(node.Children, child)
+
+		if depth > 1 {
+			if err := buildTree(r, child, filepath.Join(fullPath, stat.Name), depth-1, count); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
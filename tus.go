@@ -0,0 +1,386 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tusVersion = "1.0.0"
+const tusExtensions = "creation,termination"
+const uploadDir = "/.uploads"
+const uploadsPrefix = "/uploads/"
+const uploadExpiry = 24 * time.Hour
+
+type upload struct {
+	ID        string `json:"id"`
+	User      string `json:"user,omitempty"`
+	Path      string `json:"path"`
+	FullPath  string `json:"fullPath"`
+	Length    int64  `json:"length"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+	Global    string `json:"global,omitempty"`
+	TTL       string `json:"ttl,omitempty"`
+}
+
+var uploadsMutex sync.Mutex
+var uploadsBusy = make(map[string]bool)
+
+func initUploadDir() {
+	if err := os.MkdirAll(cacheDir+uploadDir, 0755); err != nil {
+		log.Fatal("Unable to create upload directory:", err)
+	}
+}
+
+func getUploadDataPath(id string) string {
+	return cacheDir + uploadDir + "/" + id
+}
+
+func getUploadInfoPath(id string) string {
+	return getUploadDataPath(id) + ".json"
+}
+
+func parseUploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+
+		value := ""
+		if len(fields) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+
+		metadata[fields[0]] = value
+	}
+
+	return metadata
+}
+
+func loadUpload(r *http.Request, id string) (*upload, error) {
+	if id == "" || strings.ContainsAny(id, "/.") {
+		return nil, os.ErrNotExist
+	}
+
+	data, err := ioutil.ReadFile(getUploadInfoPath(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var info upload
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+
+	user := ""
+	if current := getUserFromRequest(r); current != nil {
+		user = current.Name
+	}
+
+	if info.User != user {
+		return nil, os.ErrNotExist
+	}
+
+	return &info, nil
+}
+
+func removeUpload(id string) {
+	os.Remove(getUploadDataPath(id))
+	os.Remove(getUploadInfoPath(id))
+}
+
+// expireUploads removes uploads that have not received data for
+// uploadExpiry, along with info files whose data file is gone.
+func expireUploads() {
+	names, err := filepath.Glob(getUploadInfoPath("*"))
+	if err != nil {
+		log.Print("Unable to list uploads: ", err)
+		return
+	}
+
+	cutoff := now().Add(-uploadExpiry)
+	for _, name := range names {
+		id := strings.TrimSuffix(filepath.Base(name), ".json")
+		if !acquireUpload(id) {
+			continue
+		}
+
+		fileInfo, err := os.Stat(getUploadDataPath(id))
+		if os.IsNotExist(err) || (err == nil && fileInfo.ModTime().Before(cutoff)) {
+			log.Printf("Removed abandoned upload %s", id)
+			removeUpload(id)
+		}
+		releaseUpload(id)
+	}
+}
+
+func acquireUpload(id string) bool {
+	uploadsMutex.Lock()
+	defer uploadsMutex.Unlock()
+
+	if uploadsBusy[id] {
+		return false
+	}
+
+	uploadsBusy[id] = true
+	return true
+}
+
+func releaseUpload(id string) {
+	uploadsMutex.Lock()
+	delete(uploadsBusy, id)
+	uploadsMutex.Unlock()
+}
+
+func getUploadOffset(id string) (int64, error) {
+	fileInfo, err := fsStat(getUploadDataPath(id))
+	if err != nil {
+		return 0, err
+	}
+
+	return fileInfo.Size(), nil
+}
+
+func createUpload(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	if length > getMaxUploadSize() {
+		http.Error(w, "Upload exceeds maximum size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	path := filepath.Join("/", metadata["path"])
+	if path == "/" {
+		http.Error(w, "Upload-Metadata must include a path", http.StatusBadRequest)
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := parseTTL(metadata["ttl"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	info := &upload{
+		ID:        hex.EncodeToString(buf),
+		Path:      path,
+		FullPath:  resolvePath(mapPath(r, path)),
+		Length:    length,
+		Overwrite: metadata["overwrite"] == "1",
+		Global:    mapPath(r, path),
+		TTL:       metadata["ttl"]}
+
+	if user := getUserFromRequest(r); user != nil {
+		info.User = user.Name
+	}
+
+	if !checkLock(w, r, info.Global) {
+		return
+	}
+
+	if fileInfo, err := fsLstat(info.FullPath); err == nil {
+		if fileInfo.IsDir() || !info.Overwrite {
+			http.Error(w, "File already exists: "+path, http.StatusConflict)
+			return
+		}
+	}
+
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := ioutil.WriteFile(getUploadDataPath(info.ID), nil, 0600); err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if err := ioutil.WriteFile(getUploadInfoPath(info.ID), encoded, 0600); err != nil {
+		removeUpload(info.ID)
+		serveError(w, err)
+		return
+	}
+
+	if length == 0 {
+		if err := finishUpload(info); err != nil {
+			removeUpload(info.ID)
+			serveError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Location", uploadsPrefix+info.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func headUpload(w http.ResponseWriter, r *http.Request, info *upload) {
+	offset, err := getUploadOffset(info.ID)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+func patchUpload(w http.ResponseWriter, r *http.Request, info *upload) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if !acquireUpload(info.ID) {
+		http.Error(w, "Upload is in progress", http.StatusConflict)
+		return
+	}
+	defer releaseUpload(info.ID)
+
+	offset, err := getUploadOffset(info.ID)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	requested, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || requested != offset {
+		http.Error(w, "Upload-Offset does not match", http.StatusConflict)
+		return
+	}
+
+	file, err := os.OpenFile(getUploadDataPath(info.ID), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	written, err := io.Copy(file, http.MaxBytesReader(w, r.Body, info.Length-offset))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	offset += written
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if err != nil && offset < info.Length {
+		serveWriteError(w, err)
+		return
+	}
+
+	if offset == info.Length {
+		if !checkLock(w, r, info.Global) {
+			return
+		}
+
+		if err := finishUpload(info); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func finishUpload(info *upload) error {
+	file, err := os.Open(getUploadDataPath(info.ID))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := writeFile(info.FullPath, file, info.Overwrite, nil); err != nil {
+		return err
+	}
+
+	if ttl, _ := parseTTL(info.TTL); ttl > 0 {
+		if err := setExpiry(info.Global, ttl); err != nil {
+			return err
+		}
+	}
+
+	recordActivity(activityUpload, info.User, info.Global)
+	removeUpload(info.ID)
+	return nil
+}
+
+func handleUploads(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Set("Tus-Resumable", tusVersion)
+	exposeHeaders(header, "Location", "Tus-Resumable", "Upload-Length", "Upload-Offset")
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		header.Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, uploadsPrefix)
+	if r.URL.Path == "/uploads" || id == "" {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		header.Set("Tus-Extension", tusExtensions)
+		createUpload(w, r)
+		return
+	}
+
+	info, err := loadUpload(r, id)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case "HEAD":
+		headUpload(w, r, info)
+	case "PATCH":
+		patchUpload(w, r, info)
+	case "DELETE":
+		if !acquireUpload(info.ID) {
+			http.Error(w, "Upload is in progress", http.StatusConflict)
+			return
+		}
+		removeUpload(info.ID)
+		releaseUpload(info.ID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
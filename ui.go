@@ -0,0 +1,203 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+const viewGallery = "gallery"
+
+var uiTemplates = template.Must(template.ParseFS(uiFiles, "ui/*.html"))
+
+type browseEntry struct {
+	*Stats
+	SizeText     string
+	MtimeText    string
+	MtimeISO     string
+	Href         string
+	PreviewHref  string
+	ContentsHref string
+	EditHref     string
+	RotateHref   string
+}
+
+type browsePage struct {
+	Locale      *locale
+	View        string
+	ListHref    string
+	GalleryHref string
+	CanWrite    bool
+	Theme       string
+	Themes      []string
+	Style       template.CSS
+	Path        string
+	ParentHref  string
+	Entries     []*browseEntry
+}
+
+func endpointURL(endpoint, path string, flags ...string) string {
+	query := url.Values{}
+	query.Set("path", path)
+	for _, flag := range flags {
+		query.Set(flag, "1")
+	}
+
+	return endpoint + "?" + query.Encode()
+}
+
+func browseURL(path, view string) string {
+	query := url.Values{}
+	query.Set("path", path)
+	if view != "" {
+		query.Set("view", view)
+	}
+
+	return "/browse?" + query.Encode()
+}
+
+func canonicalizeView(query url.Values) bool {
+	if _, present := query["view"]; !present {
+		return true
+	}
+
+	if query.Get("view") == viewGallery && len(query["view"]) == 1 {
+		return true
+	}
+
+	if query.Get("view") == viewGallery {
+		query.Set("view", viewGallery)
+	} else {
+		query.Del("view")
+	}
+
+	return false
+}
+
+func canonicalizeBrowse(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeLang(query) && canon
+	canon = canonicalizeView(query) && canon
+	canon = canonicalizeHidden(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func newBrowseEntry(stats *Stats, loc *locale, view string, canWrite bool) *browseEntry {
+	entry := &browseEntry{
+		Stats:     stats,
+		MtimeText: loc.formatTime(stats.Mtime),
+		MtimeISO:  stats.Mtime.Format(time.RFC3339)}
+
+	if stats.IsDir {
+		entry.Href = browseURL(stats.Path, view)
+	} else {
+		entry.SizeText = loc.formatSize(stats.Size)
+		entry.Href = endpointURL("/read", stats.Path)
+		switch previewerForName(stats.Path) {
+		case previewerThumbnail:
+			entry.PreviewHref = endpointURL("/read", stats.Path, "preview")
+		case previewerFile:
+			entry.PreviewHref = entry.Href
+		case previewerArchive:
+			entry.ContentsHref = endpointURL("/read", stats.Path, "preview")
+		}
+		if canWrite && isThumbnailable(strings.ToLower(filepath.Ext(stats.Path))) {
+			entry.RotateHref = endpointURL("/edit", stats.Path)
+		}
+		if canWrite && isEditable(stats.Path) {
+			entry.EditHref = endpointURL("/edit", stats.Path)
+		}
+	}
+
+	return entry
+}
+
+func handleBrowse(w http.ResponseWriter, r *http.Request) {
+	if hasTheme(r) {
+		selectTheme(w, r, canonicalizeBrowse)
+		return
+	}
+
+	url := r.URL
+	canon := canonicalizeBrowse(url)
+	if !canon && allowsRedirects(r) {
+		redirect(w, r)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	fileInfo, err := fsStat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !fileInfo.IsDir() {
+		http.Redirect(w, r, endpointURL("/read", path), http.StatusFound)
+		return
+	}
+
+	stats, err := listDirectory(r, fullPath, path)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	view := r.URL.Query().Get("view")
+	if view == viewGallery {
+		stats = groupBursts(r, stats)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].IsDir != stats[j].IsDir {
+			return stats[i].IsDir
+		}
+		return strings.ToLower(stats[i].Name) < strings.ToLower(stats[j].Name)
+	})
+
+	loc := negotiateLocale(r)
+	theme := getThemeFromRequest(r)
+	page := &browsePage{
+		Locale:      loc,
+		View:        view,
+		ListHref:    browseURL(path, ""),
+		GalleryHref: browseURL(path, viewGallery),
+		CanWrite:    featureEnabled(r, featureWrite),
+		Theme:       theme,
+		Themes:      themeNames(),
+		Style:       loadThemeStyle(theme),
+		Path:        path}
+	if path != "/" {
+		page.ParentHref = browseURL(filepath.Dir(path), view)
+	}
+
+	for _, stat := range stats {
+		page.Entries = append(page.Entries, newBrowseEntry(stat, loc, view, page.CanWrite))
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Language", loc.Tag)
+	addVary(header, "Accept-Language")
+	addVary(header, "Cookie")
+
+	if err := uiTemplates.ExecuteTemplate(w, "browse.html", page); err != nil {
+		log.Print("Unable to render browse page: ", err)
+	}
+}
@@ -0,0 +1,87 @@
+var THUMB_CACHE = "thumbs-v1";
+var PAGE_CACHE = "pages-v1";
+var MAX_THUMBS = 500;
+var MAX_PAGES = 20;
+
+self.addEventListener("install", function () {
+  self.skipWaiting();
+});
+
+self.addEventListener("activate", function (event) {
+  event.waitUntil(caches.keys().then(function (names) {
+    return Promise.all(names.filter(function (name) {
+      return name !== THUMB_CACHE && name !== PAGE_CACHE;
+    }).map(function (name) {
+      return caches.delete(name);
+    }));
+  }).then(function () {
+    return self.clients.claim();
+  }));
+});
+
+function trim(cache, max) {
+  return cache.keys().then(function (keys) {
+    return Promise.all(keys.slice(0, Math.max(0, keys.length - max)).map(function (key) {
+      return cache.delete(key);
+    }));
+  });
+}
+
+function remember(name, max, request, response) {
+  return caches.open(name).then(function (cache) {
+    return cache.delete(request).then(function () {
+      return cache.put(request, response);
+    }).then(function () {
+      return trim(cache, max);
+    });
+  });
+}
+
+function cacheFirst(event) {
+  return caches.match(event.request).then(function (cached) {
+    if (cached) {
+      return cached;
+    }
+
+    return fetch(event.request).then(function (response) {
+      if (response.ok) {
+        event.waitUntil(remember(THUMB_CACHE, MAX_THUMBS, event.request, response.clone()));
+      }
+      return response;
+    });
+  });
+}
+
+function networkFirst(event) {
+  return fetch(event.request).then(function (response) {
+    if (response.ok) {
+      event.waitUntil(remember(PAGE_CACHE, MAX_PAGES, event.request, response.clone()));
+    }
+    return response;
+  }, function (error) {
+    return caches.match(event.request).then(function (cached) {
+      if (cached) {
+        return cached;
+      }
+      throw error;
+    });
+  });
+}
+
+self.addEventListener("fetch", function (event) {
+  var request = event.request;
+  if (request.method !== "GET") {
+    return;
+  }
+
+  var url = new URL(request.url);
+  if (url.origin !== self.location.origin) {
+    return;
+  }
+
+  if (url.pathname === "/read" && url.searchParams.has("preview")) {
+    event.respondWith(cacheFirst(event));
+  } else if (url.pathname === "/browse") {
+    event.respondWith(networkFirst(event));
+  }
+});
@@ -0,0 +1,32 @@
+package main
+
+type StatsURLs struct {
+	Read          string `json:"read,omitempty"`
+	Preview       string `json:"preview,omitempty"`
+	RetinaPreview string `json:"retinaPreview,omitempty"`
+	Download      string `json:"download,omitempty"`
+	Readdir       string `json:"readdir,omitempty"`
+	Browse        string `json:"browse,omitempty"`
+}
+
+func newStatsURLs(stats *Stats) *StatsURLs {
+	if stats.IsDir {
+		return &StatsURLs{
+			Readdir: endpointURL("/readdir", stats.Path),
+			Browse:  browseURL(stats.Path, "")}
+	}
+
+	urls := &StatsURLs{
+		Read:     endpointURL("/read", stats.Path),
+		Download: endpointURL("/read", stats.Path, "download")}
+
+	switch previewerForName(stats.Path) {
+	case previewerThumbnail:
+		urls.Preview = endpointURL("/read", stats.Path, "preview")
+		urls.RetinaPreview = endpointURL("/read", stats.Path, "preview", "retina")
+	case previewerFile, previewerArchive:
+		urls.Preview = endpointURL("/read", stats.Path, "preview")
+	}
+
+	return urls
+}
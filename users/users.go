@@ -0,0 +1,263 @@
+package users
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const hashIterations = 100000
+const hashPrefix = "pbkdf2-sha256"
+
+var ErrExists = errors.New("user already exists")
+var ErrNotFound = errors.New("user not found")
+
+type User struct {
+	Name     string `json:"name"`
+	Home     string `json:"home"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Admin    bool   `json:"admin,omitempty"`
+}
+
+type Store struct {
+	path  string
+	mutex sync.RWMutex
+	users map[string]*User
+}
+
+func Open(path string) (*Store, error) {
+	store := &Store{path: path, users: make(map[string]*User)}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+
+	var list []*User
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	for _, user := range list {
+		store.users[user.Name] = user
+	}
+
+	return store, nil
+}
+
+func (s *Store) Save() error {
+	s.mutex.RLock()
+	list := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		list = append(list, user)
+	}
+	s.mutex.RUnlock()
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *Store) Get(name string) (*User, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	user, present := s.users[name]
+	if !present {
+		return nil, false
+	}
+
+	copy := *user
+	return &copy, true
+}
+
+func (s *Store) List() []User {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		list = append(list, *user)
+	}
+
+	return list
+}
+
+func (s *Store) Add(name, home, password string) (*User, error) {
+	if name == "" || strings.ContainsAny(name, "/:") {
+		return nil, errors.New("invalid user name: " + name)
+	}
+
+	if home == "" {
+		home = name
+	}
+	home = filepath.Join("/", home)
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, present := s.users[name]; present {
+		return nil, ErrExists
+	}
+
+	user := &User{Name: name, Home: home, Password: hash}
+	s.users[name] = user
+
+	copy := *user
+	return &copy, nil
+}
+
+func (s *Store) Remove(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, present := s.users[name]; !present {
+		return ErrNotFound
+	}
+
+	delete(s.users, name)
+	return nil
+}
+
+func (s *Store) SetAdmin(name string, admin bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, present := s.users[name]
+	if !present {
+		return ErrNotFound
+	}
+
+	user.Admin = admin
+	return nil
+}
+
+func (s *Store) RotateToken(name string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, present := s.users[name]
+	if !present {
+		return "", ErrNotFound
+	}
+
+	user.Token = hashToken(token)
+	return token, nil
+}
+
+func (s *Store) Authenticate(name, password string) (*User, bool) {
+	user, present := s.Get(name)
+	if !present || user.Password == "" {
+		return nil, false
+	}
+
+	if !checkPassword(user.Password, password) {
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (s *Store) AuthenticateToken(token string) (*User, bool) {
+	hash := hashToken(token)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, user := range s.users {
+		if user.Token != "" && subtle.ConstantTimeCompare([]byte(user.Token), []byte(hash)) == 1 {
+			copy := *user
+			return &copy, true
+		}
+	}
+
+	return nil, false
+}
+
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, hashIterations, 32)
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawStdEncoding
+	return strings.Join([]string{
+		hashPrefix,
+		strconv.Itoa(hashIterations),
+		encoding.EncodeToString(salt),
+		encoding.EncodeToString(key)}, "$"), nil
+}
+
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != hashPrefix {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+
+	encoding := base64.RawStdEncoding
+	salt, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+
+	expected, err := encoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+func describeCurrentUser() string {
+	current, err := user.Current()
+	if err != nil {
+		return fmt.Sprintf("uid=%d gid=%d", os.Getuid(), os.Getgid())
+	}
+
+	return fmt.Sprintf("%s (uid=%s gid=%s)", current.Username, current.Uid, current.Gid)
+}
+
+func validateRoot(path string, allowSystemRoot bool) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve root %q: %v", path, err)
+	}
+
+	who := describeCurrentUser()
+	log.Printf("Running as %s", who)
+
+	fileInfo, err := os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("root %s does not exist; create it or pass -root with an existing directory", absPath)
+		}
+		if os.IsPermission(err) {
+			return "", fmt.Errorf("root %s is not accessible to %s; check the permissions of its parent directories", absPath, who)
+		}
+		return "", fmt.Errorf("unable to stat root %s: %v", absPath, err)
+	}
+
+	if !fileInfo.IsDir() {
+		return "", fmt.Errorf("root %s is not a directory; pass -root with the directory to serve", absPath)
+	}
+
+	log.Printf("Root permissions: %v", fileInfo.Mode().Perm())
+
+	dir, err := os.Open(absPath)
+	if err != nil {
+		return "", fmt.Errorf("root %s is not readable by %s; grant read and execute permission (e.g. chmod u+rx)", absPath, who)
+	}
+	_, err = dir.Readdirnames(1)
+	dir.Close()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("unable to list root %s as %s: %v", absPath, who, err)
+	}
+
+	probe, err := ioutil.TempFile(absPath, ".serve-probe-")
+	if err != nil {
+		log.Printf("Warning: root %s is not writable by %s; thumbnails and uploads will fail unless the thumbnail directories already exist", absPath, who)
+	} else {
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+
+	if filepath.Dir(absPath) == absPath {
+		if !allowSystemRoot {
+			return "", fmt.Errorf("refusing to serve the filesystem root %s; pass -root with a narrower directory or -allow-system-root to override", absPath)
+		}
+		log.Printf("Warning: serving the entire filesystem from %s", absPath)
+	}
+
+	if home, err := os.UserHomeDir(); err == nil && filepath.Clean(home) == absPath {
+		log.Printf("Warning: serving the home directory %s exposes dotfiles and credentials; consider a subdirectory", absPath)
+	}
+
+	for _, mount := range listMounts() {
+		if fileInfo, err := os.Stat(mount.Dir); err != nil {
+			log.Printf("Warning: mount %s -> %s is unavailable: %v", mount.Path, mount.Dir, err)
+		} else if !fileInfo.IsDir() {
+			log.Printf("Warning: mount %s -> %s is not a directory", mount.Path, mount.Dir)
+		}
+	}
+
+	return absPath, nil
+}
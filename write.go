@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultMaxUploadSize = 1 << 30
+const stagingMarker = ".upload-"
+
+var errMissingUpload = errors.New("multipart body has no file part")
+
+func hasOverwrite(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["overwrite"]
+	return present
+}
+
+func canonicalizeOverwrite(query url.Values) bool {
+	return canonicalizeBoolean(query, "overwrite")
+}
+
+func canonicalizeWrite(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeOverwrite(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func getMaxUploadSize() int64 {
+	configMutex.RLock()
+	maxSize := config.MaxUploadSize
+	configMutex.RUnlock()
+
+	if maxSize == 0 {
+		maxSize = defaultMaxUploadSize
+	}
+
+	return maxSize
+}
+
+func isStagingName(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, stagingMarker)
+}
+
+func fsyncEnabled() bool {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return config.Fsync || config.FsyncDirs
+}
+
+func fsyncDirsEnabled() bool {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return config.FsyncDirs
+}
+
+func getUploadReader(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errMissingUpload
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == "file" || part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+func writeFile(fullPath string, body io.Reader, overwrite bool, expected map[string]string) (map[string]string, error) {
+	dir := filepath.Dir(fullPath)
+	err := runWithTimeout("mkdir", dir, func() error {
+		return os.MkdirAll(dir, 0755)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var temp *os.File
+	err = runWithTimeout("create", dir, func() error {
+		var err error
+		temp, err = ioutil.TempFile(dir, "."+filepath.Base(fullPath)+stagingMarker)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tempPath := temp.Name()
+	defer os.Remove(tempPath)
+
+	checksums := newChecksumWriter()
+	_, err = io.Copy(io.MultiWriter(temp, checksums), body)
+	if err == nil && fsyncEnabled() {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	computed := checksums.sums()
+	if err := verifyChecksums(expected, computed); err != nil {
+		return computed, err
+	}
+
+	if err := os.Chmod(tempPath, 0644); err != nil {
+		return nil, err
+	}
+
+	if overwrite {
+		err = runWithTimeout("rename", fullPath, func() error {
+			return os.Rename(tempPath, fullPath)
+		})
+	} else {
+		err = runWithTimeout("link", fullPath, func() error {
+			return os.Link(tempPath, fullPath)
+		})
+	}
+	if err != nil {
+		return computed, err
+	}
+
+	if fsyncDirsEnabled() {
+		err = runWithTimeout("sync", dir, func() error {
+			return syncDir(dir)
+		})
+	}
+
+	return computed, err
+}
+
+func serveWriteError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var mismatchErr *checksumMismatchError
+	switch {
+	case errors.As(err, &mismatchErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case err == errMissingUpload, err == http.ErrNotMultipart:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		serveError(w, err)
+	}
+}
+
+func limitUploadBody(w http.ResponseWriter, r *http.Request) bool {
+	maxSize := getMaxUploadSize()
+	if r.ContentLength > maxSize {
+		http.Error(w, "Upload exceeds maximum size", http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	return true
+}
+
+func getWriteTarget(w http.ResponseWriter, r *http.Request) (string, string, os.FileInfo, bool) {
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+
+	if path == "" || path == "/" {
+		http.Error(w, "Invalid write path", http.StatusBadRequest)
+		return "", "", nil, false
+	}
+
+	fileInfo, err := fsLstat(fullPath)
+	if err != nil && !os.IsNotExist(err) {
+		serveError(w, err)
+		return "", "", nil, false
+	}
+
+	if fileInfo != nil && fileInfo.IsDir() {
+		http.Error(w, "Path is a directory: "+path, http.StatusConflict)
+		return "", "", nil, false
+	}
+
+	if !checkLock(w, r, mapPath(r, path)) {
+		return "", "", nil, false
+	}
+
+	return path, fullPath, fileInfo, true
+}
+
+func serveWrittenFile(w http.ResponseWriter, r *http.Request, path, fullPath string, existed bool, checksums map[string]string) {
+	fileInfo, err := fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if existed {
+		status = http.StatusOK
+	}
+
+	header := w.Header()
+	header.Set("ETag", fileETag(fileInfo))
+	exposeHeaders(header, "ETag")
+
+	stats := newStats(r, fullPath, path, fileInfo)
+	stats.Checksums = checksums
+	writeJSON(w, status, stats)
+}
+
+func handleWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeWrite(r.URL)
+
+	if !limitUploadBody(w, r) {
+		return
+	}
+
+	path, fullPath, fileInfo, ok := getWriteTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	existed := fileInfo != nil
+	overwrite := hasOverwrite(r)
+	if existed && !overwrite {
+		http.Error(w, "File already exists: "+path, http.StatusConflict)
+		return
+	}
+
+	ttl, err := getTTLFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	expected, err := getExpectedChecksums(r, mediaType != "multipart/form-data")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := getUploadReader(r)
+	if err != nil {
+		serveWriteError(w, err)
+		return
+	}
+
+	checksums, err := writeFile(fullPath, body, overwrite, expected)
+	if err != nil {
+		serveWriteError(w, err)
+		return
+	}
+
+	if ttl > 0 {
+		if err := setExpiry(mapPath(r, path), ttl); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+
+	recordActivity(activityUpload, getUserName(r), mapPath(r, path))
+	serveWrittenFile(w, r, path, fullPath, existed, checksums)
+}
+
+func handlePut(w http.ResponseWriter, r *http.Request) {
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeWrite(r.URL)
+
+	if !limitUploadBody(w, r) {
+		return
+	}
+
+	path, fullPath, fileInfo, ok := getWriteTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	existed := fileInfo != nil
+	if existed && r.Header.Get("If-None-Match") == "*" {
+		http.Error(w, "File already exists: "+path, http.StatusPreconditionFailed)
+		return
+	}
+
+	ttl, err := getTTLFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expected, err := getExpectedChecksums(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	checksums, err := writeFile(fullPath, r.Body, true, expected)
+	if err != nil {
+		serveWriteError(w, err)
+		return
+	}
+
+	if ttl > 0 {
+		if err := setExpiry(mapPath(r, path), ttl); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+
+	recordActivity(activityUpload, getUserName(r), mapPath(r, path))
+	serveWrittenFile(w, r, path, fullPath, existed, checksums)
+}
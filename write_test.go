@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+type interruptedReader struct {
+	data string
+}
+
+func (i *interruptedReader) Read(p []byte) (int, error) {
+	if i.data == "" {
+		return 0, errInterrupted
+	}
+
+	count := copy(p, i.data)
+	i.data = i.data[count:]
+	return count, nil
+}
+
+func setFsyncPolicy(tb testing.TB, fsync, fsyncDirs bool) {
+	tb.Helper()
+
+	configMutex.Lock()
+	previous := config
+	config.Fsync = fsync
+	config.FsyncDirs = fsyncDirs
+	configMutex.Unlock()
+
+	tb.Cleanup(func() {
+		configMutex.Lock()
+		config = previous
+		configMutex.Unlock()
+	})
+}
+
+func assertNoStagingFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, info := range infos {
+		if isStagingName(info.Name()) {
+			t.Errorf("staging file left behind: %s", info.Name())
+		}
+	}
+}
+
+func TestWriteFileInterruptedLeavesNoFile(t *testing.T) {
+	for _, policy := range []struct{ fsync, fsyncDirs bool }{{false, false}, {true, false}, {true, true}} {
+		setFsyncPolicy(t, policy.fsync, policy.fsyncDirs)
+
+		dir := t.TempDir()
+		fullPath := filepath.Join(dir, "upload.bin")
+
+		_, err := writeFile(fullPath, &interruptedReader{data: "partial"}, false, nil)
+		if !errors.Is(err, errInterrupted) {
+			t.Fatalf("fsync=%v fsyncDirs=%v: got error %v, want %v", policy.fsync, policy.fsyncDirs, err, errInterrupted)
+		}
+
+		if _, err := os.Lstat(fullPath); !os.IsNotExist(err) {
+			t.Errorf("fsync=%v fsyncDirs=%v: truncated file visible at final path", policy.fsync, policy.fsyncDirs)
+		}
+		assertNoStagingFiles(t, dir)
+	}
+}
+
+func TestWriteFileInterruptedOverwriteKeepsOriginal(t *testing.T) {
+	setFsyncPolicy(t, true, true)
+
+	dir := t.TempDir()
+	fullPath := filepath.Join(dir, "photo.jpg")
+	if err := ioutil.WriteFile(fullPath, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := writeFile(fullPath, &interruptedReader{data: "replacement"}, true, nil)
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("got error %v, want %v", err, errInterrupted)
+	}
+
+	data, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "original" {
+		t.Errorf("got %q after interrupted overwrite, want %q", data, "original")
+	}
+	assertNoStagingFiles(t, dir)
+}
+
+func TestWriteFileChecksumMismatchLeavesNoFile(t *testing.T) {
+	dir := t.TempDir()
+	fullPath := filepath.Join(dir, "upload.txt")
+
+	expected := map[string]string{"sha256": strings.Repeat("0", 64)}
+	if _, err := writeFile(fullPath, strings.NewReader("content"), false, expected); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+
+	if _, err := os.Lstat(fullPath); !os.IsNotExist(err) {
+		t.Error("file with mismatched checksum visible at final path")
+	}
+	assertNoStagingFiles(t, dir)
+}
+
+func TestWriteFileSyncsDirectory(t *testing.T) {
+	setFsyncPolicy(t, true, true)
+
+	dir := t.TempDir()
+	fullPath := filepath.Join(dir, "nested", "upload.txt")
+
+	if _, err := writeFile(fullPath, io.LimitReader(strings.NewReader("complete"), 8), false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "complete" {
+		t.Errorf("got %q, want %q", data, "complete")
+	}
+	assertNoStagingFiles(t, filepath.Dir(fullPath))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxXattrSize = 64 * 1024
+const xattrBase64Prefix = "base64:"
+
+var errXattrUnsupported = errors.New("Extended attributes are not supported on this platform")
+
+func getXattrPatterns() []string {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return config.Xattrs
+}
+
+func validateXattrs(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New(pattern + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+func isSelectedXattr(name string) bool {
+	for _, pattern := range getXattrPatterns() {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasXattrs(r *http.Request) bool {
+	query := r.URL.Query()
+	_, present := query["xattrs"]
+	return present
+}
+
+func canonicalizeXattrs(query url.Values) bool {
+	return canonicalizeBoolean(query, "xattrs")
+}
+
+func encodeXattr(value []byte) string {
+	if utf8.Valid(value) && !strings.HasPrefix(string(value), xattrBase64Prefix) {
+		return string(value)
+	}
+
+	return xattrBase64Prefix + base64.StdEncoding.EncodeToString(value)
+}
+
+func decodeXattr(value string) ([]byte, error) {
+	if strings.HasPrefix(value, xattrBase64Prefix) {
+		return base64.StdEncoding.DecodeString(strings.TrimPrefix(value, xattrBase64Prefix))
+	}
+
+	return []byte(value), nil
+}
+
+func readSelectedXattrs(fullPath string) map[string]string {
+	if len(getXattrPatterns()) == 0 {
+		return nil
+	}
+
+	names, err := listXattrs(fullPath)
+	if err != nil {
+		return nil
+	}
+
+	xattrs := make(map[string]string)
+	for _, name := range names {
+		if !isSelectedXattr(name) {
+			continue
+		}
+
+		if value, err := getXattr(fullPath, name); err == nil {
+			xattrs[name] = encodeXattr(value)
+		}
+	}
+
+	if len(xattrs) == 0 {
+		return nil
+	}
+
+	return xattrs
+}
+
+func canonicalizeXattr(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePath(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func handleXattr(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !requireFeature(w, r, featureWrite) {
+		return
+	}
+
+	canonicalizeXattr(r.URL)
+
+	name := r.URL.Query().Get("name")
+	if name == "" || !isSelectedXattr(name) {
+		http.Error(w, "Extended attribute not allowed: "+name, http.StatusForbidden)
+		return
+	}
+
+	path := getPathFromRequest(r)
+	fullPath := getFullPathFromRequest(r)
+	if isCachePath(fullPath) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	fileInfo, err := fsLstat(fullPath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if !checkPreconditions(w, r, fileInfo) {
+		return
+	}
+
+	if !checkLock(w, r, mapPath(r, path)) {
+		return
+	}
+
+	if r.Method == "DELETE" {
+		err = removeXattr(fullPath, name)
+	} else {
+		var body []byte
+		body, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxXattrSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var value []byte
+		if value, err = decodeXattr(string(body)); err != nil {
+			http.Error(w, "Invalid value: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = setXattr(fullPath, name, value)
+	}
+
+	if err == errXattrUnsupported {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	stats := newStats(r, fullPath, path, fileInfo)
+	stats.Xattrs = readSelectedXattrs(fullPath)
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"syscall"
+)
+
+func listXattrs(fullPath string) ([]string, error) {
+	size, err := syscall.Listxattr(fullPath, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(fullPath, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+
+	return names, nil
+}
+
+func getXattr(fullPath, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(fullPath, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(fullPath, name, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:size], nil
+}
+
+func setXattr(fullPath, name string, value []byte) error {
+	return syscall.Setxattr(fullPath, name, value, 0)
+}
+
+func removeXattr(fullPath, name string) error {
+	return syscall.Removexattr(fullPath, name)
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+func listXattrs(fullPath string) ([]string, error) {
+	return nil, errXattrUnsupported
+}
+
+func getXattr(fullPath, name string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
+
+func setXattr(fullPath, name string, value []byte) error {
+	return errXattrUnsupported
+}
+
+func removeXattr(fullPath, name string) error {
+	return errXattrUnsupported
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func canonicalizePathList(query url.Values, key string) bool {
+	canon := true
+	seen := make(map[string]bool)
+
+	var paths []string
+	for _, value := range query[key] {
+		path := filepath.Join("/", value)
+		if path != value || seen[path] {
+			canon = false
+		}
+
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	if !canon {
+		query[key] = paths
+	}
+
+	return canon
+}
+
+func canonicalizeZip(url *url.URL) bool {
+	canon := true
+	query := url.Query()
+
+	canon = canonicalizePathList(query, "path") && canon
+	canon = canonicalizeSidecars(query) && canon
+	canon = canonicalizeQuery(url, query) && canon
+
+	return canon
+}
+
+func isCachePath(fullPath string) bool {
+	if isSizedThumbPath(fullPath) {
+		return true
+	}
+
+	for _, dir := range []string{thumbDir, retinaThumbDir, uploadDir, dropsFile, sharesFile, expiryFile, commentsFile, activityFile, orderFile, tagsFile, indexFile, trashDir, trashFile} {
+		cachePath := cacheDir + dir
+		if fullPath == cachePath || strings.HasPrefix(fullPath, cachePath+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+type archiveWriter interface {
+	addDir(name string, fileInfo os.FileInfo) error
+	addFile(fullPath, name string, fileInfo os.FileInfo) error
+	Close() error
+}
+
+type zipArchive struct {
+	writer   *zip.Writer
+	progress *job
+}
+
+func (z *zipArchive) addDir(name string, fileInfo os.FileInfo) error {
+	header, err := zip.FileInfoHeader(fileInfo)
+	if err != nil {
+		return err
+	}
+
+	header.Name = name + "/"
+	header.Modified = modTime(fileInfo)
+	_, err = z.writer.CreateHeader(header)
+	return err
+}
+
+func (z *zipArchive) addFile(fullPath, name string, fileInfo os.FileInfo) error {
+	header, err := zip.FileInfoHeader(fileInfo)
+	if err != nil {
+		return err
+	}
+
+	header.Name = name
+	header.Modified = modTime(fileInfo)
+	header.Method = zip.Store
+	if isCompressibleType(contentTypeForName(fullPath)) {
+		header.Method = zip.Deflate
+	}
+
+	file, err := fsOpen(fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry, err := z.writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, z.progress.reader(file))
+	return err
+}
+
+func (z *zipArchive) Close() error {
+	return z.writer.Close()
+}
+
+func addPathToArchive(r *http.Request, archive archiveWriter, fullPath, prefix string) error {
+	return filepath.Walk(fullPath, func(walkPath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if isCachePath(walkPath) || isStagingName(fileInfo.Name()) {
+			if fileInfo.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(fullPath, walkPath)
+		if err != nil {
+			return err
+		}
+		name := sanitizeArchiveName(filepath.ToSlash(filepath.Join(prefix, rel)))
+
+		switch {
+		case fileInfo.IsDir():
+			if name == "." {
+				return nil
+			}
+			return archive.addDir(name, fileInfo)
+		case !isServable(walkPath):
+			return nil
+		case fileInfo.Mode()&os.ModeSymlink != 0:
+			target, err := fsEvalSymlinks(walkPath)
+			if err != nil {
+				return nil
+			}
+
+			if _, ok := getVirtualPath(r, target); !ok {
+				return nil
+			}
+
+			targetInfo, err := fsStat(target)
+			if err != nil || !targetInfo.Mode().IsRegular() || !isServable(target) {
+				return nil
+			}
+
+			return archive.addFile(target, name, targetInfo)
+		case fileInfo.Mode().IsRegular():
+			return archive.addFile(walkPath, name, fileInfo)
+		}
+
+		return nil
+	})
+}
+
+func expandSidecars(r *http.Request, paths []string) []string {
+	selected := make(map[string]bool)
+	for _, path := range paths {
+		selected[path] = true
+	}
+
+	for _, path := range paths {
+		for _, sidecar := range getSidecarPaths(r, path) {
+			if !selected[sidecar] {
+				selected[sidecar] = true
+				paths = append(paths, sidecar)
+			}
+		}
+	}
+
+	return paths
+}
+
+func getArchivePrefix(path string) string {
+	if path == "/" {
+		return ""
+	}
+
+	return filepath.Base(path)
+}
+
+func handleZip(w http.ResponseWriter, r *http.Request) {
+	url := r.URL
+	canon := canonicalizeZip(url)
+	if !canon && allowsRedirects(r) {
+		redirect(w, r)
+		return
+	}
+
+	paths := url.Query()["path"]
+	if len(paths) == 0 {
+		http.Error(w, "No paths selected", http.StatusBadRequest)
+		return
+	}
+
+	if hasSidecars(r) {
+		paths = expandSidecars(r, paths)
+	}
+
+	fullPaths := make([]string, len(paths))
+	for i, path := range paths {
+		fullPaths[i] = resolvePath(mapPath(r, path))
+		if _, err := fsStat(fullPaths[i]); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+
+	name := "download.zip"
+	if len(paths) == 1 && paths[0] != "/" {
+		name = filepath.Base(paths[0]) + ".zip"
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/zip")
+	header.Set("Content-Disposition", formatDisposition("attachment", name))
+	exposeHeaders(header, "Content-Disposition")
+
+	archive := &zipArchive{writer: zip.NewWriter(w)}
+	for i, path := range paths {
+		if err := addPathToArchive(r, archive, fullPaths[i], getArchivePrefix(path)); err != nil {
+			log.Printf("Unable to write zip entry %s: %v", path, err)
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Print("Unable to finish zip archive: ", err)
+	}
+}